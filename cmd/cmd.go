@@ -1,16 +1,39 @@
 package main
 
 import (
+	"context"
 	"github.com/goMySQLSemiSync/config"
 	"github.com/goMySQLSemiSync/dump"
 	"github.com/wonderivan/logger"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
 	conf, err := config.Read("./base.config")
 	if err != nil {
-		logger.Fatal("read base.conf error, err: ", err.Error())
+		logger.Error("read base.conf error, err: ", err.Error())
+		os.Exit(1)
+	}
+	dumper, err := dump.NewBinlogDumper(conf)
+	if err != nil {
+		logger.Error("create binlog dumper error, err: ", err.Error())
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logger.Info("received signal ", sig.String(), ", shutting down")
+		cancel()
+	}()
+
+	err = dumper.Run(ctx)
+	if err != nil {
+		logger.Error("dump binlog error, err: ", err.Error())
+		os.Exit(1)
 	}
-	dumper := dump.NewBinlogDumper(conf)
-	dumper.Run()
 }
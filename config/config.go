@@ -20,9 +20,24 @@ type Configuration struct {
 	BinlogName string                   // dump_server store binlog name
 	BinlogDir   string                  // dump_server store binlog dir
 	ClusterTag  string                  // dump mysql cluster tag
+	Flavor string                       // master 类型: mysql / mariadb, 为空时为 mysql
 
 	Gtid_mode  bool                     //是否开启gtid模式
 	Gtid_purged string 					//gtid_purged
+
+	SslMode string                      // disabled / require / verify-ca / verify-identity
+	SslCa string                        // CA 证书文件
+	SslCert string                      // 客户端证书文件
+	SslKey string                       // 客户端私钥文件
+	SslServerName string                // verify-identity 校验的主机名, 为空时使用 Host
+
+	Compression string                  // 压缩协议: none / zlib / zstd
+	ZstdLevel int                       // zstd 压缩级别, 为 0 时使用 3
+
+	MaxReconnectAttempts int            // 断线重连最大次数, 0 表示不限
+
+	MetadataDSN string                  // 记录 event 元数据的 MySQL DSN, 为空时不记录
+	MetadataTable string                // 记录 event 元数据的表名, 为空时使用 binlog_event_metadata
 }
 
 func newConfiguration() *Configuration {
@@ -39,8 +54,19 @@ func newConfiguration() *Configuration {
 		BinlogName:      "",
 		BinlogDir:       "",
 		ClusterTag:      "",
+		Flavor:          "",
 		Gtid_mode:       false,
 		Gtid_purged:     "",
+		SslMode:         "",
+		SslCa:           "",
+		SslCert:         "",
+		SslKey:          "",
+		SslServerName:   "",
+		Compression:     "",
+		ZstdLevel:       0,
+		MaxReconnectAttempts: 0,
+		MetadataDSN:     "",
+		MetadataTable:   "",
 	}
 }
 
@@ -54,12 +80,12 @@ func Read(filename string) (*Configuration, error) {
 	if err != nil {
 		return config, err
 	}
+	defer file.Close()
 	decoder := json.NewDecoder(file)
 	err = decoder.Decode(config)
-	if err == nil {
-		logger.Info("Read Config %s", filename)
-	} else {
-		logger.Fatal("Cannot read config file, filename: %s, err: %s", filename, err.Error())
+	if err != nil {
+		return config, fmt.Errorf("cannot read config file, filename: %s, err: %s", filename, err.Error())
 	}
-	return config, err
+	logger.Info("Read Config %s", filename)
+	return config, nil
 }
\ No newline at end of file
@@ -0,0 +1,9 @@
+package constants
+
+var (
+	BINLOG_CHECKSUM_ALG_OFF   = 0
+	BINLOG_CHECKSUM_ALG_CRC32 = 1
+	BINLOG_CHECKSUM_ALG_UNDEF = 255
+
+	BINLOG_CHECKSUM_LEN = 4
+)
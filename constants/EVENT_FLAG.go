@@ -0,0 +1,15 @@
+package constants
+
+// binlog event header 中的 flags
+var (
+	LOG_EVENT_BINLOG_IN_USE_F = 0x1
+	LOG_EVENT_FORCED_ROTATE_F = 0x2
+	LOG_EVENT_THREAD_SPECIFIC_F = 0x4
+	LOG_EVENT_SUPPRESS_USE_F = 0x8
+	LOG_EVENT_UPDATE_TABLE_MAP_VERSION_F = 0x10
+	LOG_EVENT_ARTIFICIAL_F = 0x20
+	LOG_EVENT_RELAY_LOG_F = 0x40
+	LOG_EVENT_IGNORABLE_F = 0x80
+	LOG_EVENT_NO_FILTER_F = 0x100
+	LOG_EVENT_MTS_ISOLATE_F = 0x200
+)
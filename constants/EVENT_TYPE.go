@@ -26,9 +26,9 @@ var (
 	PRE_GA_WRITE_ROWS_EVENT = 20
 	PRE_GA_UPDATE_ROWS_EVENT = 21
 	PRE_GA_DELETE_ROWS_EVENT = 22
-	// WRITE_ROWS_EVENT = 23
-	// UPDATE_ROWS_EVENT = 24
-	// DELETE_ROWS_EVENT = 25
+	WRITE_ROWS_EVENT_V1 = 23
+	UPDATE_ROWS_EVENT_V1 = 24
+	DELETE_ROWS_EVENT_V1 = 25
 	INCIDENT_EVENT = 26
 	HEARTBEAT_LOG_EVENT = 27
 	IGNORABLE_LOG_EVENT = 28
@@ -39,4 +39,16 @@ var (
 	GTID_LOG_EVENT = 33
 	ANONYMOUS_GTID_LOG_EVENT = 34
 	PREVIOUS_GTIDS_LOG_EVENT = 35
+	TRANSACTION_CONTEXT_EVENT = 36
+	VIEW_CHANGE_EVENT = 37
+	XA_PREPARE_LOG_EVENT = 38
+	PARTIAL_UPDATE_ROWS_EVENT = 39
+	TRANSACTION_PAYLOAD_EVENT = 40
+
+	// MariaDB
+	MARIADB_ANNOTATE_ROWS_EVENT = 160
+	MARIADB_BINLOG_CHECKPOINT_EVENT = 161
+	MARIADB_GTID_EVENT = 162
+	MARIADB_GTID_LIST_EVENT = 163
+	MARIADB_START_ENCRYPTION_EVENT = 164
 )
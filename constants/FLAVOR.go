@@ -0,0 +1,21 @@
+package constants
+
+// master 的类型
+var (
+	FLAVOR_MYSQL = "mysql"
+	FLAVOR_MARIADB = "mariadb"
+)
+
+// MariaDB 的 @mariadb_slave_capability
+var (
+	MARIA_SLAVE_CAPABILITY_UNKNOWN = 0
+	MARIA_SLAVE_CAPABILITY_ANNOTATE = 1
+	MARIA_SLAVE_CAPABILITY_TOLERATE_HOLES = 2
+	MARIA_SLAVE_CAPABILITY_BINLOG_CHECKSUM = 3
+	MARIA_SLAVE_CAPABILITY_GTID = 4
+)
+
+// MariaDB COM_BINLOG_DUMP 的 flags, 设置后 master 发送 ANNOTATE_ROWS_EVENT
+var (
+	BINLOG_SEND_ANNOTATE_ROWS_EVENT = 0x02
+)
@@ -0,0 +1,118 @@
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/goMySQLSemiSync/protocol"
+	"sync"
+)
+
+const (
+	AUTH_NATIVE_PASSWORD       = "mysql_native_password"
+	AUTH_CACHING_SHA2_PASSWORD = "caching_sha2_password"
+
+	// caching_sha2_password AuthMoreData 状态字节
+	CACHING_SHA2_REQUEST_PUBLIC_KEY = 0x02
+	CACHING_SHA2_FAST_AUTH_SUCCESS  = 0x03
+	CACHING_SHA2_PERFORM_FULL_AUTH  = 0x04
+)
+
+/*
+* 认证插件, 按 Challenge 中的 auth plugin name 选择
+* Scramble: 生成 HandshakeResponse 中的 auth-response
+* MoreData: 处理服务端返回的 AuthMoreData(0x01) 数据, 返回需要回写给服务端的数据, nil 表示无需回写
+ */
+type Authenticator interface {
+	GetPluginName() string
+	Scramble(password, seed []byte) ([]byte, error)
+	MoreData(password, seed, data []byte, secure bool) ([]byte, error)
+}
+
+var (
+	authenticatorsMu sync.RWMutex
+	authenticators   = make(map[string]Authenticator)
+)
+
+func init() {
+	RegisterAuthenticator(&nativePasswordAuthenticator{})
+	RegisterAuthenticator(&cachingSha2PasswordAuthenticator{})
+}
+
+/*
+* 注册认证插件, 同名插件会被覆盖
+ */
+func RegisterAuthenticator(auth Authenticator) {
+	authenticatorsMu.Lock()
+	defer authenticatorsMu.Unlock()
+	authenticators[auth.GetPluginName()] = auth
+}
+
+/*
+* 按插件名获取认证插件, 插件名为空时使用 mysql_native_password
+ */
+func GetAuthenticator(pluginName string) (Authenticator, error) {
+	if pluginName == "" {
+		pluginName = AUTH_NATIVE_PASSWORD
+	}
+	authenticatorsMu.RLock()
+	defer authenticatorsMu.RUnlock()
+	auth, ok := authenticators[pluginName]
+	if !ok {
+		return nil, fmt.Errorf("unsupported auth plugin: %s", pluginName)
+	}
+	return auth, nil
+}
+
+type nativePasswordAuthenticator struct{}
+
+func (a *nativePasswordAuthenticator) GetPluginName() string {
+	return AUTH_NATIVE_PASSWORD
+}
+
+func (a *nativePasswordAuthenticator) Scramble(password, seed []byte) ([]byte, error) {
+	return protocol.Scramble_native_password(password, seed), nil
+}
+
+func (a *nativePasswordAuthenticator) MoreData(password, seed, data []byte, secure bool) ([]byte, error) {
+	return nil, fmt.Errorf("unexpected auth more data for %s", AUTH_NATIVE_PASSWORD)
+}
+
+/*
+* caching_sha2_password
+* fast auth: 服务端缓存命中, 返回 0x01 0x03, 随后是 OK
+* full auth: 服务端返回 0x01 0x04
+*   TLS 连接: 直接发送明文密码 + NUL
+*   TCP 连接: 发送 0x02 请求公钥, 服务端返回 0x01 + PEM 公钥, 用公钥加密密码后发送
+ */
+type cachingSha2PasswordAuthenticator struct{}
+
+func (a *cachingSha2PasswordAuthenticator) GetPluginName() string {
+	return AUTH_CACHING_SHA2_PASSWORD
+}
+
+func (a *cachingSha2PasswordAuthenticator) Scramble(password, seed []byte) ([]byte, error) {
+	return protocol.Scramble_caching_sha2_password(password, seed), nil
+}
+
+func (a *cachingSha2PasswordAuthenticator) MoreData(password, seed, data []byte, secure bool) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty auth more data for %s", AUTH_CACHING_SHA2_PASSWORD)
+	}
+
+	if len(data) == 1 {
+		switch data[0] {
+		case CACHING_SHA2_FAST_AUTH_SUCCESS:
+			return nil, nil
+		case CACHING_SHA2_PERFORM_FULL_AUTH:
+			if secure {
+				return append(append([]byte{}, password...), 0x00), nil
+			}
+			return []byte{CACHING_SHA2_REQUEST_PUBLIC_KEY}, nil
+		}
+	}
+
+	if bytes.HasPrefix(data, []byte("-----BEGIN")) {
+		return protocol.Encrypt_password_rsa(password, seed, data)
+	}
+	return nil, fmt.Errorf("unexpected auth more data for %s: %v", AUTH_CACHING_SHA2_PASSWORD, data)
+}
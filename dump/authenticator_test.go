@@ -0,0 +1,220 @@
+package dump
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+var testAuthSeed = []byte("0123456789abcdefghij")
+
+/*
+* net.Pipe 另一端模拟 MySQL 服务端的握手
+ */
+type testAuthServer struct {
+	t          *testing.T
+	conn       net.Conn
+	sequenceId int
+}
+
+func (s *testAuthServer) write(payload []byte) {
+	p := protocol.NewPacket()
+	p.SequenceId = s.sequenceId
+	p.Payload = payload
+	s.sequenceId++
+	if _, err := s.conn.Write(p.ToPacket()); err != nil {
+		s.t.Errorf("server write packet error: %v", err)
+	}
+}
+
+func (s *testAuthServer) read() []byte {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(s.conn, header); err != nil {
+		s.t.Errorf("server read packet header error: %v", err)
+		return nil
+	}
+	if int(header[3]) != s.sequenceId {
+		s.t.Errorf("server expect sequence id %d, got %d", s.sequenceId, header[3])
+	}
+	s.sequenceId = int(header[3]) + 1
+	payload := make([]byte, protocol.Get_fixed_int_sniplet(header[0:3]))
+	if _, err := io.ReadFull(s.conn, payload); err != nil {
+		s.t.Errorf("server read packet payload error: %v", err)
+		return nil
+	}
+	return payload
+}
+
+/*
+* 初始握手包, seed 为 testAuthSeed
+ */
+func (s *testAuthServer) writeChallenge(pluginName string, capabilityFlags int) {
+	payload := []byte{10}
+	payload = append(payload, "8.0.36\x00"...)
+	payload = append(payload, 1, 0, 0, 0)
+	payload = append(payload, testAuthSeed[:8]...)
+	payload = append(payload, 0)
+	payload = append(payload, byte(capabilityFlags>>16), byte(capabilityFlags>>24))
+	payload = append(payload, 33, 2, 0)
+	payload = append(payload, byte(capabilityFlags), byte(capabilityFlags>>8))
+	payload = append(payload, 21)
+	payload = append(payload, make([]byte, 10)...)
+	payload = append(payload, testAuthSeed[8:]...)
+	payload = append(payload, 0)
+	payload = append(payload, pluginName...)
+	s.write(append(payload, 0))
+}
+
+/*
+* 读取 HandshakeResponse, 返回其中的 auth-response
+ */
+func (s *testAuthServer) readResponse() []byte {
+	payload := s.read()
+	if len(payload) < 32 {
+		s.t.Errorf("handshake response too short: %d", len(payload))
+		return nil
+	}
+	end := bytes.IndexByte(payload[32:], 0x00)
+	if end < 0 {
+		s.t.Errorf("no username in handshake response")
+		return nil
+	}
+	pos := 32 + end + 1
+	return payload[pos+1 : pos+1+int(payload[pos])]
+}
+
+func (s *testAuthServer) writeOK() {
+	s.write([]byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00})
+}
+
+var testServerCapabilityFlags = protocol.CLIENT_PROTOCOL_41 | protocol.CLIENT_SECURE_CONNECTION | protocol.CLIENT_PLUGIN_AUTH
+
+/*
+* 在 net.Pipe 上运行客户端握手, serve 模拟服务端
+ */
+func runTestHandshake(t *testing.T, server *BinlogServer, serve func(s *testAuthServer)) (*handshake, error) {
+	client, serverConn := net.Pipe()
+	defer client.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer serverConn.Close()
+		serve(&testAuthServer{t: t, conn: serverConn, sequenceId: 0})
+	}()
+	stream := &BaseStream{binlogServer: server, conn: &client, sequenceId: 0}
+	h := newHandshake(stream)
+	err := h.run()
+	client.Close()
+	<-done
+	return h, err
+}
+
+func newTestAuthBinlogServer() *BinlogServer {
+	return &BinlogServer{user: "repl", password: "secret", compression: COMPRESSION_NONE}
+}
+
+func TestCachingSha2MoreData(t *testing.T) {
+	auth, err := GetAuthenticator(AUTH_CACHING_SHA2_PASSWORD)
+	if err != nil {
+		t.Fatalf("get authenticator error: %v", err)
+	}
+	password := []byte("secret")
+	tests := []struct {
+		name   string
+		data   []byte
+		secure bool
+		expect []byte
+		isErr  bool
+	}{
+		{"fast auth", []byte{CACHING_SHA2_FAST_AUTH_SUCCESS}, false, nil, false},
+		{"full auth over tls", []byte{CACHING_SHA2_PERFORM_FULL_AUTH}, true, []byte("secret\x00"), false},
+		{"full auth request public key", []byte{CACHING_SHA2_PERFORM_FULL_AUTH}, false, []byte{CACHING_SHA2_REQUEST_PUBLIC_KEY}, false},
+		{"empty", []byte{}, false, nil, true},
+		{"unknown status", []byte{0x05}, false, nil, true},
+		{"invalid public key", []byte("-----BEGIN PUBLIC KEY-----\nabc\n"), false, nil, true},
+	}
+	for _, tt := range tests {
+		authData, err := auth.MoreData(password, testAuthSeed, tt.data, tt.secure)
+		if (err != nil) != tt.isErr {
+			t.Errorf("%s: expect error %v, got %v", tt.name, tt.isErr, err)
+			continue
+		}
+		if !bytes.Equal(authData, tt.expect) {
+			t.Errorf("%s: expect %v, got %v", tt.name, tt.expect, authData)
+		}
+	}
+
+	native, err := GetAuthenticator("")
+	if err != nil || native.GetPluginName() != AUTH_NATIVE_PASSWORD {
+		t.Fatalf("expect %s for empty plugin name, got %v", AUTH_NATIVE_PASSWORD, err)
+	}
+	if _, err := native.MoreData(password, testAuthSeed, []byte{CACHING_SHA2_FAST_AUTH_SUCCESS}, false); err == nil {
+		t.Errorf("expect error for auth more data of %s", AUTH_NATIVE_PASSWORD)
+	}
+	if _, err := GetAuthenticator("sha256_password"); err == nil {
+		t.Errorf("expect error for unsupported auth plugin")
+	}
+}
+
+func TestCachingSha2FastAuth(t *testing.T) {
+	var authResponse []byte
+	_, err := runTestHandshake(t, newTestAuthBinlogServer(), func(s *testAuthServer) {
+		s.writeChallenge(AUTH_CACHING_SHA2_PASSWORD, testServerCapabilityFlags)
+		authResponse = s.readResponse()
+		s.write([]byte{byte(protocol.AUTH_MORE_DATA), CACHING_SHA2_FAST_AUTH_SUCCESS})
+		s.writeOK()
+	})
+	if err != nil {
+		t.Fatalf("handshake error: %v", err)
+	}
+	if expect := protocol.Scramble_caching_sha2_password([]byte("secret"), testAuthSeed); !bytes.Equal(authResponse, expect) {
+		t.Errorf("expect auth response %x, got %x", expect, authResponse)
+	}
+}
+
+func TestCachingSha2FullAuthWithPublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key error: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal public key error: %v", err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	var password []byte
+	_, err = runTestHandshake(t, newTestAuthBinlogServer(), func(s *testAuthServer) {
+		s.writeChallenge(AUTH_CACHING_SHA2_PASSWORD, testServerCapabilityFlags)
+		s.readResponse()
+		s.write([]byte{byte(protocol.AUTH_MORE_DATA), CACHING_SHA2_PERFORM_FULL_AUTH})
+		// 非 TLS 连接先请求公钥
+		if request := s.read(); !bytes.Equal(request, []byte{CACHING_SHA2_REQUEST_PUBLIC_KEY}) {
+			t.Errorf("expect public key request, got %v", request)
+		}
+		s.write(append([]byte{byte(protocol.AUTH_MORE_DATA)}, pemKey...))
+		plain, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, key, s.read(), nil)
+		if err != nil {
+			t.Errorf("decrypt password error: %v", err)
+		}
+		for i := range plain {
+			plain[i] ^= testAuthSeed[i%protocol.SCRAMBLE_LENGTH]
+		}
+		password = plain
+		s.writeOK()
+	})
+	if err != nil {
+		t.Fatalf("handshake error: %v", err)
+	}
+	if string(password) != "secret\x00" {
+		t.Errorf("expect password secret with NUL, got %q", password)
+	}
+}
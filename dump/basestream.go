@@ -1,110 +1,165 @@
 package dump
 
 import (
-	"encoding/binary"
+	"crypto/tls"
 	"fmt"
-	"github.com/goMySQLSemiSync/packet"
 	"github.com/goMySQLSemiSync/protocol"
-	"github.com/wonderivan/logger"
+	"io"
 	"net"
-	"os"
+	"strconv"
 	"time"
 )
 
 type BaseStream struct {
 	binlogServer *BinlogServer
 	conn         *net.Conn
+	sequenceId   int          // 下一个读取的 packet 的序号
 }
 
-func NewBaseStream(b *BinlogServer) *BaseStream{
+func NewBaseStream(b *BinlogServer) (*BaseStream, error){
 	bs := &BaseStream{
 		binlogServer: b,
 		conn:         nil,
+		sequenceId:   0,
 	}
-	bs.getConn()
-	return bs
+	err := bs.getConn()
+	if err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+/*
+* 发送一个packet, 服务端回复的 packet 序号从该 packet 的序号 + 1 开始
+*/
+func (b *BaseStream) send_packet(buff []byte) error{
+	err := b.send_packet_without_reply(buff)
+	if err != nil {
+		return err
+	}
+	b.sequenceId = (int(buff[3]) + 1) & 0xff
+	return nil
 }
 
-func (b *BaseStream) send_packet(buff []byte) {
+/*
+* 发送一个服务端不会回复的packet (如半同步 ack), 不影响读取的 packet 序号
+*/
+func (b *BaseStream) send_packet_without_reply(buff []byte) error{
 	skt := *(b.conn)
-	skt.Write(buff)
+	var err error
+	if cc, ok := skt.(*compressedConn); ok {
+		_, err = cc.writeWithoutReply(buff)
+	} else {
+		_, err = skt.Write(buff)
+	}
+	if err != nil {
+		return fmt.Errorf("send packet to mysql error, err: %s", err.Error())
+	}
+	return nil
+}
+
+/*
+* 读取一个packet, ERR packet 转换为 error 返回
+*/
+func (b *BaseStream) read_packet() (*protocol.Packet, error){
+	packet, err := b.read_raw_packet()
+	if err != nil {
+		return nil, err
+	}
+	packetType := packet.GetType()
+	if packetType == byte(protocol.ERR) {
+		return nil, protocol.LoadFromPacket(packet)
+	}
+	return packet, nil
 }
 
-func (b *BaseStream) read_packet() *protocol.Packet{
+/*
+* 读取一个packet, 不处理 ERR packet
+* payload 长度为 0xffffff 的 packet 后面还有续包, 合并为一个 packet 返回
+*/
+func (b *BaseStream) read_raw_packet() (*protocol.Packet, error){
 	socketIn := *(b.conn)
-	packet_length := make([]byte, 4)
-	socketIn.Read(packet_length)  // payload_length + seq_id
+	packet := protocol.NewPacket()
+	packet.SequenceId = b.sequenceId
+	payload := make([]byte, 0)
+	for {
+		packet_header := make([]byte, 4)
+		_, err := io.ReadFull(socketIn, packet_header)  // payload_length + seq_id
+		if err != nil {
+			return nil, fmt.Errorf("read packet header from mysql error, err: %s", err.Error())
+		}
 
-	psize := uint(binary.LittleEndian.Uint16(packet_length[:2]))
-	bytes_to_read := psize + uint(packet_length[2:3][0])<<16
+		bytes_to_read := protocol.Get_fixed_int_sniplet(packet_header[0:3])
+		sequenceId := int(packet_header[3])
+		if sequenceId != b.sequenceId {
+			return nil, fmt.Errorf("%w, packets out of order, expect sequence id %d, but got %d", protocol.ErrProtocolViolation, b.sequenceId, sequenceId)
+		}
+		b.sequenceId = (sequenceId + 1) & 0xff
 
-	packet_payload := make([]byte, bytes_to_read)
-	socketIn.Read(packet_payload)  // payload
+		packet_payload := make([]byte, bytes_to_read)
+		_, err = io.ReadFull(socketIn, packet_payload)  // payload
+		if err != nil {
+			return nil, fmt.Errorf("read packet payload from mysql error, err: %s", err.Error())
+		}
+		payload = append(payload, packet_payload...)
 
-	packetSlice := append(packet_length, packet_payload...)
-	packet, err := protocol.ToPacket(packetSlice)
-	if err != nil {
-		logger.Error(err.Error())
+		if bytes_to_read < protocol.MAX_PAYLOAD_LENGTH {
+			break
+		}
 	}
-	packet.Payload = packet.GetPayload()
-	packetType := packet.GetType()
-	if packetType == byte(protocol.ERR) {
-		err := protocol.LoadFromPacket(packet)
-		logger.Error("error, read packet from mysql error, errorCode: ", err.GetErrCode(), " sqlState: ", err.GetSqlState(), " errorMessage: ", err.GetErrorMessage())
-		socketIn.Close()
-		os.Exit(1)
+
+	if len(payload) == 0 {
+		return nil, fmt.Errorf("%w, read empty packet from mysql", protocol.ErrProtocolViolation)
 	}
-	return packet
+	packet.Length = len(payload)
+	packet.Payload = payload
+	return packet, nil
 }
 
-func (b *BaseStream) getConn() {
-	addr := fmt.Sprintf("%s:%d", b.binlogServer.host, b.binlogServer.port)
-	user := b.binlogServer.user
-	schema := ""
+func (b *BaseStream) getConn() error{
+	addr := net.JoinHostPort(b.binlogServer.host, strconv.Itoa(b.binlogServer.port))
 	conn, err := net.DialTimeout("tcp", addr, 1000 * time.Second)
 	if err != nil {
-		logger.Error("conn to mysql error, err: ", err.Error())
+		return fmt.Errorf("conn to mysql %s error, err: %s", addr, err.Error())
 	}
 	b.conn = &conn
 
-	challenge := packet.LoadFromPacket(b.read_packet())
-	challenge1 := challenge.GetChallenge1()
-	challenge2 := challenge.GetChallenge2()
-
-	scramble_password := protocol.Scramble_native_password([]byte(b.binlogServer.password), []byte(fmt.Sprintf("%s%s", challenge1, challenge2)))
-	response := packet.NewResponse()
-	response.SequenceId = 1
-	response.SetCapablityFlag(33531397)
-	response.SetCharacterSet(33)
-	response.SetMaxPacketSize(16777216)
-	clientAttributes := make(map[string]string)
-	clientAttributes["_client_name"] = "gomysql"
-	clientAttributes["_pid"] = string(os.Getpid())
-	clientAttributes["_client_version"] = "5.7"
-	clientAttributes["program_name"] = "mysql"
-	response.SetClientAttributes(clientAttributes)
-	response.SetPluginName(challenge.GetAuthPluginName())
-	//response.SetPluginName("mysql_native_password")
-	response.SetUsername(user)
-	response.SetSchema(schema)
-	response.SetAuthResponse(scramble_password)
-
-	response.RemoveCapablityFlag(protocol.CLIENT_COMPRESS)
-	response.RemoveCapablityFlag(protocol.CLIENT_SSL)
-	response.RemoveCapablityFlag(protocol.CLIENT_LOCAL_FILES)
-	response.Payload = response.GetPayload()
-	b.send_packet(response.ToPacket())
-	//time.Sleep(time.Second * 100)
-	packet := b.read_packet()
-	packetType := packet.GetType()
-	if packetType == byte(protocol.ERR) {
-		err := protocol.LoadFromPacket(packet)
-		logger.Error("error: ", "errorCode: ", err.GetErrCode(), " sqlState: ", err.GetSqlState(), " errorMessage: ", err.GetErrorMessage())
+	err = newHandshake(b).run()
+	if err != nil {
 		b.Close()
-		os.Exit(1)
+		return err
 	}
+	return nil
+}
+
+func (b *BaseStream) isSecure() bool {
+	_, ok := (*b.conn).(*tls.Conn)
+	return ok
+}
+
+/*
+* 中断阻塞中的读取, 用于退出
+*/
+func (b *BaseStream) interrupt() {
+	if b.conn != nil {
+		(*(b.conn)).SetReadDeadline(time.Now())
+	}
+}
+
+/*
+* 发送 COM_QUIT 后关闭连接
+*/
+func (b *BaseStream) Quit() error {
+	quit := protocol.NewPacket()
+	quit.SequenceId = 0
+	quit.Payload = protocol.Build_byte(byte(protocol.COM_QUIT))
+	err := b.send_packet_without_reply(quit.ToPacket())
+	b.Close()
+	return err
 }
 
 func (b *BaseStream) Close() {
-	(*(b.conn)).Close()
+	if b.conn != nil {
+		(*(b.conn)).Close()
+	}
 }
\ No newline at end of file
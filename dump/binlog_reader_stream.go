@@ -1,13 +1,13 @@
 package dump
 
 import (
-	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/goMySQLSemiSync/constants"
+	"github.com/goMySQLSemiSync/event"
 	"github.com/goMySQLSemiSync/packet"
 	"github.com/goMySQLSemiSync/protocol"
 	"github.com/wonderivan/logger"
-	"os"
 )
 
 type BinlogReaderStream struct {
@@ -17,6 +17,12 @@ type BinlogReaderStream struct {
 	auto_position  bool
 	has_register_slave bool
 	binlog_header_fix_length int
+	gtidSet *protocol.GtidSet   // gtid 模式下 dump 的 gtid 集合
+	mariadbGtidSet *protocol.MariadbGtidSet // MariaDB gtid 模式下 dump 的 gtid 位置
+	checksumAlg int             // master 的 binlog_checksum, 不支持 checksum 的 master 为 BINLOG_CHECKSUM_ALG_UNDEF
+	eventChecksumAlg int        // 当前 binlog 文件的 checksum, 取自 FORMAT_DESCRIPTION_EVENT
+	decoder *event.Decoder      // binlog event 解码器
+	need_ack bool               // 半同步复制时 master 要求确认最近一次 Fetchone 返回的 event
 }
 
 func (brs *BinlogReaderStream) SetBasestream(basestream *BaseStream) {
@@ -74,6 +80,12 @@ func newBinlogReaderStream(basestream *BaseStream, currentLogFile string, curren
 		currentLogPos:  currentLogPos,
 		auto_position: auto_position,
 		has_register_slave: false,
+		gtidSet: nil,
+		mariadbGtidSet: nil,
+		checksumAlg: constants.BINLOG_CHECKSUM_ALG_UNDEF,
+		eventChecksumAlg: constants.BINLOG_CHECKSUM_ALG_UNDEF,
+		decoder: event.NewDecoder(),
+		need_ack: false,
 	}
 
 	if brs.binlogServer.semiSync == true {
@@ -84,9 +96,148 @@ func newBinlogReaderStream(basestream *BaseStream, currentLogFile string, curren
 	return brs
 }
 
-func (brs *BinlogReaderStream) Register_slave() {
+/*
+* 设置 gtid 模式下 dump 的 gtid 集合, 为空时使用配置中的 gtid_purged
+*/
+func (brs *BinlogReaderStream) SetGtidSet(gtidSet *protocol.GtidSet) {
+	brs.gtidSet = gtidSet
+}
+
+func (brs *BinlogReaderStream) GetGtidSet() *protocol.GtidSet{
+	return brs.gtidSet
+}
+
+/*
+* 设置 MariaDB gtid 模式下 dump 的 gtid 位置, 为空时使用配置中的 gtid_purged
+*/
+func (brs *BinlogReaderStream) SetMariadbGtidSet(mariadbGtidSet *protocol.MariadbGtidSet) {
+	brs.mariadbGtidSet = mariadbGtidSet
+}
+
+func (brs *BinlogReaderStream) GetMariadbGtidSet() *protocol.MariadbGtidSet{
+	return brs.mariadbGtidSet
+}
+
+func (brs *BinlogReaderStream) execute_query(query string) error {
+	sql := packet.NewQuery()
+	sql.SequenceId = 0
+	sql.SetQuery(query)
+	sql.Payload = sql.GetPayload()
+	err := brs.send_packet(sql.ToPacket())
+	if err != nil {
+		return err
+	}
+	_, err = brs.read_packet()
+	if err != nil {
+		return fmt.Errorf("execute query [%s] error, err: %w", query, err)
+	}
+	return nil
+}
+
+/*
+* 执行查询并读取文本协议结果集
+*/
+func (brs *BinlogReaderStream) execute_select(query string) ([]*packet.TextRow, error) {
+	sql := packet.NewQuery()
+	sql.SequenceId = 0
+	sql.SetQuery(query)
+	sql.Payload = sql.GetPayload()
+	err := brs.send_packet(sql.ToPacket())
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := brs.read_packet()
+	if err != nil {
+		return nil, fmt.Errorf("execute query [%s] error, err: %w", query, err)
+	}
+	columnCount, err := packet.LoadFromPacketToColumnCount(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w, execute query [%s] error, err: %s", protocol.ErrProtocolViolation, query, err.Error())
+	}
+	for i := 0; i < columnCount; i++ {
+		_, err = brs.read_packet()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows := make([]*packet.TextRow, 0)
+	for {
+		p, err = brs.read_packet()
+		if err != nil {
+			return nil, err
+		}
+		if packet.IsEOFPacket(p) {
+			// 没有 CLIENT_DEPRECATE_EOF 时, column definition 之后有一个 5 字节的 EOF
+			// 有 CLIENT_DEPRECATE_EOF 时, 结果集以 0xfe 开头的 OK packet 结束, 至少 7 字节
+			if len(rows) == 0 && p.SequenceId == columnCount + 2 && len(p.Payload) == 5 {
+				continue
+			}
+			return rows, nil
+		}
+		row, err := packet.LoadFromPacketToTextRow(p, columnCount)
+		if err != nil {
+			return nil, fmt.Errorf("%w, execute query [%s] error, err: %s", protocol.ErrProtocolViolation, query, err.Error())
+		}
+		rows = append(rows, row)
+	}
+}
+
+/*
+* 查询 master 的 binlog_checksum 并通过 @master_binlog_checksum 告知 master 本端支持 checksum
+* 不支持 binlog_checksum 的老版本 master 不校验 checksum
+*/
+func (brs *BinlogReaderStream) negotiate_checksum() error {
+	rows, err := brs.execute_select("SELECT @@global.binlog_checksum")
+	if err != nil {
+		var mysqlErr *protocol.Err
+		if errors.As(err, &mysqlErr) {
+			logger.Warn("the master does not support binlog checksum, err: ", err.Error())
+			brs.checksumAlg = constants.BINLOG_CHECKSUM_ALG_UNDEF
+			brs.eventChecksumAlg = constants.BINLOG_CHECKSUM_ALG_UNDEF
+			return nil
+		}
+		return err
+	}
+	if len(rows) != 1 || rows[0].IsNull(0) {
+		return fmt.Errorf("%w, unexpected result of binlog_checksum", protocol.ErrProtocolViolation)
+	}
+	checksumAlg, err := parseChecksumAlg(rows[0].GetValues()[0])
+	if err != nil {
+		return err
+	}
+
+	err = brs.execute_query("SET @master_binlog_checksum = @@global.binlog_checksum")
+	if err != nil {
+		return err
+	}
+	logger.Info("the master binlog_checksum is ", rows[0].GetValues()[0])
+	brs.checksumAlg = checksumAlg
+	brs.eventChecksumAlg = checksumAlg
+	brs.decoder.SetChecksumAlg(checksumAlg)
+	return nil
+}
+
+/*
+* 校验 event 的 checksum, FORMAT_DESCRIPTION_EVENT 决定之后 event 的 checksum 算法
+*/
+func (brs *BinlogReaderStream) verify_checksum(event_type int, event []byte) error {
+	if brs.checksumAlg == constants.BINLOG_CHECKSUM_ALG_UNDEF {
+		return nil
+	}
+	if event_type == constants.FORMAT_DESCRIPTION_EVENT {
+		brs.eventChecksumAlg = getFormatDescriptionChecksumAlg(event)
+	}
+	if brs.eventChecksumAlg != constants.BINLOG_CHECKSUM_ALG_CRC32 {
+		return nil
+	}
+	return verifyEventChecksum(event)
+}
+
+func (brs *BinlogReaderStream) Register_slave() error {
 	if brs.has_register_slave {
-		return
+		return nil
 	}
 
 	masterId := brs.binlogServer.masterId
@@ -95,21 +246,20 @@ func (brs *BinlogReaderStream) Register_slave() {
 	serverUuid := brs.binlogServer.serverUuid
 	heartbeatPeriod := brs.binlogServer.heartbeatPeriod
 
-	sql := packet.NewQuery()
-	sql.SequenceId = 0
-	sql.SetQuery(fmt.Sprintf("SET @slave_uuid= '%s'", serverUuid))
-	sql.Payload = sql.GetPayload()
-	packetToByte := sql.ToPacket()
-	brs.send_packet(packetToByte)
-	brs.read_packet()
+	err := brs.execute_query(fmt.Sprintf("SET @slave_uuid= '%s'", serverUuid))
+	if err != nil {
+		return err
+	}
 
-	sql = packet.NewQuery()
-	sql.SequenceId = 0
-	sql.SetQuery(fmt.Sprintf("SET @master_heartbeat_period= %d", heartbeatPeriod))
-	sql.Payload = sql.GetPayload()
-	packetToByte = sql.ToPacket()
-	brs.send_packet(packetToByte)
-	brs.read_packet()
+	err = brs.execute_query(fmt.Sprintf("SET @master_heartbeat_period= %d", heartbeatPeriod))
+	if err != nil {
+		return err
+	}
+
+	err = brs.negotiate_checksum()
+	if err != nil {
+		return err
+	}
 
 	slave := packet.NewSlave()
 	slave.SetPort(port)
@@ -117,34 +267,47 @@ func (brs *BinlogReaderStream) Register_slave() {
 	slave.SetServerId(serverId)
 	slave.SequenceId = 0
 	payload := slave.GetPayload()
-	brs.send_packet(payload)
-	brs.read_packet()
+	err = brs.send_packet(payload)
+	if err != nil {
+		return err
+	}
+	_, err = brs.read_packet()
+	if err != nil {
+		return fmt.Errorf("register slave error, err: %w", err)
+	}
 
 	//是否启用半同步
 	if brs.binlogServer.semiSync {
-		sql = packet.NewQuery()
-		sql.SequenceId = 0
-		sql.SetQuery("SET @rpl_semi_sync_slave = 1")
-		sql.Payload = sql.GetPayload()
-		packetToByte = sql.ToPacket()
-		brs.send_packet(packetToByte)
-		brs.read_packet()
+		err = brs.execute_query("SET @rpl_semi_sync_slave = 1")
+		if err != nil {
+			return err
+		}
 	}
 
-	if brs.auto_position {
-
+	if brs.binlogServer.isMariadb() {
+		err = brs.dump_mariadb()
+	} else if brs.auto_position {
 		dump := packet.NewDumpGtid()
-		gtid_purged := brs.binlogServer.gtid_purged
-		gtid_set := dump.GetPurgedGtidSet(gtid_purged)
+		gtid_set := brs.gtidSet
+		if gtid_set == nil {
+			gtid_set, err = dump.GetPurgedGtidSet(brs.binlogServer.gtid_purged)
+			if err != nil {
+				return fmt.Errorf("%w, %s", ErrInvalidConfig, err.Error())
+			}
+		}
 
 		dump.SetGtidSet(gtid_set)
 		dump.SetServerId(serverId)
 		dump.SetAuto_position(brs.auto_position)
 		dump.SequenceId = 0
-		packet := dump.GetPayload()
-		brs.send_packet(packet)
-		brs.read_packet()
-		brs.has_register_slave = true
+		packet, err := dump.GetPayload()
+		if err != nil {
+			return fmt.Errorf("%w, %s", ErrInvalidConfig, err.Error())
+		}
+		err = brs.send_packet(packet)
+		if err != nil {
+			return err
+		}
 	} else {
 		dump := packet.NewDumpPos()
 		dump.SetServerId(serverId)
@@ -152,63 +315,107 @@ func (brs *BinlogReaderStream) Register_slave() {
 		dump.SetLogPos(brs.currentLogPos)
 		dump.SequenceId = 0
 		packet := dump.GetPayload()
-		brs.send_packet(packet)
-		brs.read_packet()
-		brs.has_register_slave = true
+		err = brs.send_packet(packet)
+	}
+	if err != nil {
+		return err
 	}
+	// dump 开始后服务端发送的第一个 event 是 fake rotate event, 由 Fetchone 返回
+	brs.has_register_slave = true
+	return nil
 }
 
-func (this *BinlogReaderStream) Fetchone() (uint32, int, uint32, uint32, []byte){
+/*
+* 最近一次 Fetchone 返回的 event 是否需要半同步确认
+*/
+func (this *BinlogReaderStream) NeedAck() bool {
+	return this.need_ack
+}
+
+/*
+* 半同步复制确认 event 已经写入本地文件, logPos 为 event header 中的 log_pos
+*/
+func (this *BinlogReaderStream) SendSemiAck(logFile string, logPos uint32) error {
+	ack := packet.NewSemiAck()
+	ack.SetLogPos(logPos)
+	ack.SetLogFile(logFile)
+	ack.Packet.SequenceId = 0
+	ack.Packet.Payload = ack.GetPayload()
+	return this.send_packet_without_reply(ack.ToPacket())
+}
+
+func isEssentialEvent(event_type int) bool {
+	return event_type == constants.FORMAT_DESCRIPTION_EVENT || event_type == constants.ROTATE_EVENT || event_type == constants.GTID_LOG_EVENT || event_type == constants.MARIADB_GTID_EVENT
+}
+
+/*
+* 关闭连接并释放 event 解码器
+*/
+func (this *BinlogReaderStream) Close() {
+	this.decoder.Close()
+	this.BaseStream.Close()
+}
+
+/*
+* 读取下一个 binlog event 并解码, 跳过 HEARTBEAT_EVENT 和重启后的第一个 FORMAT_DESCRIPTION_EVENT
+*/
+func (this *BinlogReaderStream) Fetchone() (event.Event, error){
 	for {
-		this.Register_slave()
-		packetread := this.read_packet()
-		//sequenceId := packetread.GetSequenceId()
-		packetType := packetread.GetType()
-		packetSlice := packetread.ToPacket()
-		pos := this.binlog_header_fix_length
-
-		// header
-		timestamp := binary.LittleEndian.Uint32(packetSlice[pos:pos + 4])
-		pos += 4
-		event_type := int(packetSlice[pos:pos + 1][0])
-		pos += 1
-		//server_id := binary.LittleEndian.Uint32(packetSlice[pos:pos + 4])
-		_ = binary.LittleEndian.Uint32(packetSlice[pos:pos + 4])
-		pos += 4
-		event_size := binary.LittleEndian.Uint32(packetSlice[pos:pos + 4])
-		pos += 4
-		log_pos := binary.LittleEndian.Uint32(packetSlice[pos:pos + 4])
-		pos += 4
-		//flags := binary.LittleEndian.Uint16(packetSlice[pos:pos+2])
-		_ = binary.LittleEndian.Uint16(packetSlice[pos:pos+2])
+		err := this.Register_slave()
+		if err != nil {
+			return nil, err
+		}
+		packetread, err := this.read_packet()
+		if err != nil {
+			return nil, err
+		}
+		// binlog_header_fix_length 包含 4 字节 packet header
+		header_fix_length := this.binlog_header_fix_length - 4
+		if len(packetread.Payload) < header_fix_length + event.EVENT_HEADER_LENGTH {
+			return nil, fmt.Errorf("%w, binlog event packet too short, length: %d", protocol.ErrProtocolViolation, len(packetread.Payload))
+		}
+		// 半同步复制的 event 前有 magic 和 ack 标志, ack 由调用方在 event 写入本地文件后发送
+		this.need_ack = false
+		if this.binlogServer.semiSync {
+			if packetread.Payload[1] != packet.SEMI_SYNC_MAGIC {
+				return nil, fmt.Errorf("%w, invalid semi sync magic 0x%x", protocol.ErrProtocolViolation, packetread.Payload[1])
+			}
+			this.need_ack = packetread.Payload[2] == packet.SEMI_SYNC_NEED_ACK
+		}
+		packetSlice := packetread.Payload[header_fix_length:]
+		header := event.NewEventHeader()
+		err = header.LoadFromPacket(packetSlice)
+		if err != nil {
+			return nil, fmt.Errorf("%w, %s", protocol.ErrProtocolViolation, err.Error())
+		}
 
 		//跳过HEARTBEAT_EVENT
-		if event_type == constants.HEARTBEAT_EVENT {
-			continue
-		}
-		//跳过重启后的第一个FORMAT_DESCRIPTION_EVENT
-		if event_type == constants.FORMAT_DESCRIPTION_EVENT && log_pos == 0 {
+		if header.EventType == constants.HEARTBEAT_EVENT {
 			continue
 		}
 
-		//如果是半同步复制
-		if this.binlogServer.semiSync {
-			if event_type == constants.XID_EVENT || event_type == constants.QUERY_EVENT {
-				ack := packet.NewSemiAck()
-				ack.SetLogPos(uint32(this.currentLogPos))
-				ack.SetLogFile(this.currentLogFile)
-				ack.Packet.SequenceId = 0
-				ackPacket := ack.ToPacket()
-				this.send_packet(ackPacket)
+		// checksum 校验失败的 event 不写入文件, 返回错误后重连重新获取
+		err = this.verify_checksum(header.EventType, packetSlice)
+		if err != nil {
+			return nil, err
+		}
+		// FORMAT_DESCRIPTION_EVENT 决定之后 event 的解码格式, 即使跳过也要解码
+		ev, err := this.decoder.Decode(packetSlice)
+		if err != nil {
+			// 决定文件格式, 文件切换和事务边界的 event 解码失败时无法继续 dump
+			// 其余 event 解码失败不影响 dump, 原样写入本地文件
+			if !isEssentialEvent(header.EventType) {
+				logger.Warn("decode binlog event error, save raw event, err: ", err.Error())
+				ev = event.NewRawEvent(header, packetSlice)
+			} else {
+				return nil, fmt.Errorf("%w, event type: %d, log_pos: %d, err: %s", ErrDecode, header.EventType, header.LogPos, err.Error())
 			}
 		}
-
-		if packetType == byte(protocol.ERR) {
-			err := protocol.LoadFromPacket(packetread)
-			logger.Error("error: errorcode %d, sqlstate %s, errorMessage %s", err.GetErrCode(), err.GetSqlState(), err.GetErrorMessage())
-			this.Close()
-			os.Exit(1)
+		//跳过重启后的第一个FORMAT_DESCRIPTION_EVENT
+		if header.EventType == constants.FORMAT_DESCRIPTION_EVENT && header.LogPos == 0 {
+			continue
 		}
-		return timestamp, event_type, event_size, log_pos, packetSlice[this.binlog_header_fix_length:]
+
+		return ev, nil
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,74 @@
+package dump
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/goMySQLSemiSync/constants"
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+/*
+* 半同步复制的 binlog event packet: OK, magic, ack 标志, XID_EVENT
+ */
+func newTestSemiSyncPacket(sequenceId int, magic byte, flag byte, logPos uint32) []byte {
+	ev := make([]byte, 19+8)
+	binary.LittleEndian.PutUint32(ev[0:4], 1700000000)
+	ev[4] = byte(constants.XID_EVENT)
+	binary.LittleEndian.PutUint32(ev[5:9], 1)
+	binary.LittleEndian.PutUint32(ev[9:13], uint32(len(ev)))
+	binary.LittleEndian.PutUint32(ev[13:17], logPos)
+	p := protocol.NewPacket()
+	p.SequenceId = sequenceId
+	p.Payload = append([]byte{0x00, magic, flag}, ev...)
+	return p.ToPacket()
+}
+
+func newTestSemiSyncReader(conn net.Conn) *BinlogReaderStream {
+	stream := &BaseStream{binlogServer: &BinlogServer{semiSync: true}, conn: &conn, sequenceId: 0}
+	brs := newBinlogReaderStream(stream, "mysql-bin.000001", 4, false)
+	brs.has_register_slave = true
+	brs.decoder.SetChecksumAlg(constants.BINLOG_CHECKSUM_ALG_OFF)
+	return brs
+}
+
+func TestFetchoneSemiSyncAck(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	brs := newTestSemiSyncReader(client)
+	defer brs.Close()
+
+	go server.Write(newTestSemiSyncPacket(0, 0xef, 0x01, 1234))
+	ev, err := brs.Fetchone()
+	if err != nil {
+		t.Fatalf("fetch event error: %v", err)
+	}
+	if ev.GetHeader().LogPos != 1234 || !brs.NeedAck() {
+		t.Fatalf("expect event at 1234 need ack, got %d, need ack %v", ev.GetHeader().LogPos, brs.NeedAck())
+	}
+
+	// ack 的 pos 为 event header 中的 log_pos, 序号为 0, 不影响读取的序号
+	go brs.SendSemiAck("mysql-bin.000001", ev.GetHeader().LogPos)
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(server, header); err != nil || header[3] != 0 {
+		t.Fatalf("read ack header error: %v, header: %v", err, header)
+	}
+	payload := make([]byte, protocol.Get_fixed_int_sniplet(header[0:3]))
+	io.ReadFull(server, payload)
+	if payload[0] != 0xef || binary.LittleEndian.Uint64(payload[1:9]) != 1234 || string(payload[9:]) != "mysql-bin.000001" {
+		t.Errorf("unexpected ack payload % x", payload)
+	}
+
+	go server.Write(newTestSemiSyncPacket(1, 0xef, 0x00, 1300))
+	if _, err := brs.Fetchone(); err != nil || brs.NeedAck() {
+		t.Errorf("expect event without ack, need ack %v, err: %v", brs.NeedAck(), err)
+	}
+
+	go server.Write(newTestSemiSyncPacket(2, 0x00, 0x01, 1400))
+	if _, err := brs.Fetchone(); !errors.Is(err, protocol.ErrProtocolViolation) {
+		t.Errorf("expect protocol violation for invalid magic, got %v", err)
+	}
+}
@@ -3,12 +3,14 @@ package dump
 import (
 	"bufio"
 	"bytes"
-	"encoding/binary"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"github.com/goMySQLSemiSync/config"
 	"github.com/goMySQLSemiSync/constants"
+	"github.com/goMySQLSemiSync/event"
 	"github.com/goMySQLSemiSync/packet"
+	"github.com/goMySQLSemiSync/protocol"
 	"github.com/goMySQLSemiSync/util"
 	"github.com/wonderivan/logger"
 	"io"
@@ -29,9 +31,24 @@ type BinlogServer struct {
 	binlogName string                   // dump_server store binlog name
 	binlogDir   string                  // dump_server store binlog dir
 	clusterTag  string                  // dump mysql cluster tag
+	flavor string                       // master 类型: mysql / mariadb
 
 	gtid_mode  bool                     //是否开启gtid模式
 	gtid_purged string 					//gtid_purged
+
+	sslMode string                      // disabled / require / verify-ca / verify-identity
+	sslCa string                        // CA 证书文件
+	sslCert string                      // 客户端证书文件
+	sslKey string                       // 客户端私钥文件
+	sslServerName string                // verify-identity 校验的主机名
+
+	compression string                  // 压缩协议: none / zlib / zstd
+	zstdLevel int                       // zstd 压缩级别
+
+	maxReconnectAttempts int            // 断线重连最大次数, 0 表示不限
+
+	metadataDSN string                  // 记录 event 元数据的 MySQL DSN, 为空时不记录
+	metadataTable string                // 记录 event 元数据的表名
 }
 
 type BinlogDumper struct {
@@ -40,40 +57,48 @@ type BinlogDumper struct {
 	lastLogPos   int64  // 在启动过程中自动解析已经dump出来的binlog pos
 
 	lastGtid     string
+	executedGtidSet *protocol.GtidSet // 已完整写入本地文件的 gtid 集合, 重连时用于 auto position
+	executedMariadbGtidSet *protocol.MariadbGtidSet // MariaDB 已完整写入本地文件的 gtid 位置, 重连时用于 @slave_connect_state
+	pendingGtid     string            // 正在写入的事务的 gtid
+
+	safeLogPos     int64 // 最后一个完整事务边界在 master binlog 中的 pos
+	safeFileOffset int64 // 最后一个完整事务边界在本地 binlog 文件中的 offset
 
 	currentLogFile string // 启动后开始dump的binlog文件名
 	currentLogPos  int64  // 启动后开始dump的binlog pos地址
+
+	metadataSink *MetadataSink // event 元数据写入 MySQL, 未配置 metadataDSN 时为 nil
 }
 
-func NewBinlogDumper(conf *config.Configuration) *BinlogDumper{
+func NewBinlogDumper(conf *config.Configuration) (*BinlogDumper, error){
 	masterId := conf.MasterId
 	if masterId == 0 {
-		logger.Fatal("the masterId for dump mysql is 0")
+		return nil, fmt.Errorf("%w, the masterId for dump mysql is 0", ErrInvalidConfig)
 	}
 
 	host := conf.Host
 	if host == "" {
-		logger.Fatal("the master host is empty")
+		return nil, fmt.Errorf("%w, the master host is empty", ErrInvalidConfig)
 	}
 
 	port := conf.Port
 	if port == 0 {
-		logger.Fatal("the master port is 0")
+		return nil, fmt.Errorf("%w, the master port is 0", ErrInvalidConfig)
 	}
 
 	user := conf.User
 	if user == "" {
-		logger.Fatal("the user for connect master is empty")
+		return nil, fmt.Errorf("%w, the user for connect master is empty", ErrInvalidConfig)
 	}
 
 	password := conf.Password
 	if password == "" {
-		logger.Fatal("the password for connect master is empty")
+		return nil, fmt.Errorf("%w, the password for connect master is empty", ErrInvalidConfig)
 	}
 
 	serverId := conf.ServerId
 	if serverId == 0 {
-		logger.Fatal("the sreverId for dump binlog server is 0")
+		return nil, fmt.Errorf("%w, the sreverId for dump binlog server is 0", ErrInvalidConfig)
 	}
 
 	semiSync := conf.SemiSync
@@ -81,34 +106,75 @@ func NewBinlogDumper(conf *config.Configuration) *BinlogDumper{
 
 	serverUuid := conf.ServerUuid
 	if serverUuid == "" {
-		logger.Fatal("the uuid for dump binlog server is empty")
+		return nil, fmt.Errorf("%w, the uuid for dump binlog server is empty", ErrInvalidConfig)
 	}
 
 	heartbeatPeriod := conf.HeartbeatPeriod
 	if heartbeatPeriod == 0 {
-		logger.Fatal("the heartbeatPeriod for dump binlog server is 0")
+		return nil, fmt.Errorf("%w, the heartbeatPeriod for dump binlog server is 0", ErrInvalidConfig)
 	}
 
 	binlogName := conf.BinlogName
 	if binlogName == "" {
-		logger.Fatal("the binlogName for dump binlog server is empty")
+		return nil, fmt.Errorf("%w, the binlogName for dump binlog server is empty", ErrInvalidConfig)
 	}
 
 	clusterTag := conf.ClusterTag
 	if clusterTag == "" {
-		logger.Fatal("the clusterTag for dump binlog server is empty")
+		return nil, fmt.Errorf("%w, the clusterTag for dump binlog server is empty", ErrInvalidConfig)
 	}
 
 	binlogBaseDir := conf.BinlogDir
 	if binlogBaseDir == "" {
-		logger.Fatal("the binlogBaseDir for dump binlog server is empty")
+		return nil, fmt.Errorf("%w, the binlogBaseDir for dump binlog server is empty", ErrInvalidConfig)
 	}
 
+	flavor := conf.Flavor
+	if flavor == "" {
+		flavor = constants.FLAVOR_MYSQL
+	}
+	if !isValidFlavor(flavor) {
+		return nil, fmt.Errorf("%w, the flavor %s for dump binlog server is invalid", ErrInvalidConfig, flavor)
+	}
+	logger.Info("the flavor for dump binlog server is %v", flavor)
+
 	gtid_mode := conf.Gtid_mode
 	logger.Info("the gtid mode for dump binlog server is %v", gtid_mode)
 
 	gtid_purged := conf.Gtid_purged
 	logger.Info("the gtid_purged for dump binlog server is %v", gtid_purged)
+	executedMariadbGtidSet := protocol.NewMariadbGtidSet()
+	if flavor == constants.FLAVOR_MARIADB {
+		var err error
+		executedMariadbGtidSet, err = protocol.ParseMariadbGtidSet(gtid_purged)
+		if err != nil {
+			return nil, fmt.Errorf("%w, the gtid_purged for dump binlog server is invalid, err: %s", ErrInvalidConfig, err.Error())
+		}
+	}
+
+	sslMode := conf.SslMode
+	if !isValidSslMode(sslMode) {
+		return nil, fmt.Errorf("%w, the sslMode %s for dump binlog server is invalid", ErrInvalidConfig, sslMode)
+	}
+	logger.Info("the ssl mode for dump binlog server is %v", sslMode)
+
+	compression := conf.Compression
+	if !isValidCompression(compression) {
+		return nil, fmt.Errorf("%w, the compression %s for dump binlog server is invalid", ErrInvalidConfig, compression)
+	}
+	zstdLevel := conf.ZstdLevel
+	if zstdLevel == 0 {
+		zstdLevel = DEFAULT_ZSTD_LEVEL
+	}
+	logger.Info("the compression for dump binlog server is %v", compression)
+
+	metadataTable := conf.MetadataTable
+	if metadataTable == "" {
+		metadataTable = DEFAULT_METADATA_TABLE
+	}
+	if !isValidMetadataTable(metadataTable) {
+		return nil, fmt.Errorf("%w, the metadataTable %s for dump binlog server is invalid", ErrInvalidConfig, metadataTable)
+	}
 
 	//buffer := new(bytes.Buffer)
 	//buffer.WriteString(binlogBaseDir)
@@ -131,19 +197,63 @@ func NewBinlogDumper(conf *config.Configuration) *BinlogDumper{
 			binlogName:      binlogName,
 			binlogDir:       binlogDir,
 			clusterTag:      clusterTag,
+			flavor:          flavor,
 			gtid_mode:       gtid_mode,
 			gtid_purged:     gtid_purged,
+			sslMode:         sslMode,
+			sslCa:           conf.SslCa,
+			sslCert:         conf.SslCert,
+			sslKey:          conf.SslKey,
+			sslServerName:   conf.SslServerName,
+			compression:     compression,
+			zstdLevel:       zstdLevel,
+			maxReconnectAttempts: conf.MaxReconnectAttempts,
+			metadataDSN:     conf.MetadataDSN,
+			metadataTable:   metadataTable,
 		},
 	}
 
 	binlogDumper.lastGtid = ""
+	binlogDumper.executedGtidSet = protocol.NewGtidSet()
+	if flavor == constants.FLAVOR_MYSQL {
+		executedGtidSet, err := packet.NewDumpGtid().GetPurgedGtidSet(gtid_purged)
+		if err != nil {
+			return nil, fmt.Errorf("%w, the gtid_purged for dump binlog server is invalid, err: %s", ErrInvalidConfig, err.Error())
+		}
+		binlogDumper.executedGtidSet = executedGtidSet
+	}
+	binlogDumper.executedMariadbGtidSet = executedMariadbGtidSet
+	binlogDumper.pendingGtid = ""
 
 	//找到最后一个 / 当前的 binlog file
-	binlogDumper.setLastLogFile()
-	binlogDumper.setLastLogPos()
-	binlogDumper.saveBinlogIndex()
+	err := binlogDumper.setLastLogFile()
+	if err != nil {
+		return nil, err
+	}
+	err = binlogDumper.setLastLogPos()
+	if err != nil {
+		return nil, err
+	}
+	// 配置中的 gtid_purged 之外, 本地已经写入的事务不再重新接收
+	if gtid_mode {
+		err = binlogDumper.restoreExecutedGtidSet()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = binlogDumper.saveBinlogIndex()
+	if err != nil {
+		return nil, err
+	}
+	if conf.MetadataDSN != "" {
+		binlogDumper.metadataSink, err = NewMetadataSink(conf.MetadataDSN, metadataTable, clusterTag)
+		if err != nil {
+			return nil, fmt.Errorf("connect metadata mysql error, err: %w", err)
+		}
+		logger.Info("the event metadata for dump binlog server will be saved into table %v", metadataTable)
+	}
 	logger.Debug(binlogDumper)
-	return binlogDumper
+	return binlogDumper, nil
 }
 
 func (binlogDumper *BinlogDumper) getIndexFile() string{
@@ -162,21 +272,24 @@ func (binlogDumper *BinlogDumper) getIndexFile() string{
 /*
 * 从 binlog index filename中读取最后一个binlog, 如果不存在，设置为 binlog.000001
 */
-func (binlogDumper *BinlogDumper) setLastLogFile() {
+func (binlogDumper *BinlogDumper) setLastLogFile() error{
 	indexName := binlogDumper.getIndexFile()
 	indexFile, err := os.OpenFile(binlogDumper.getAbsoluteFileName(indexName), os.O_CREATE|os.O_RDONLY, 0644)
-	defer indexFile.Close()
 	if err != nil {
-		logger.Error("open binlog index file error, err: ", err.Error())
-		panic(err)
+		return fmt.Errorf("%w, open binlog index file error, err: %s", ErrDiskFailure, err.Error())
 	}
+	defer indexFile.Close()
 	logFileName, err := util.ReadLastLine(indexFile)
+	if err != nil {
+		return fmt.Errorf("%w, read binlog index file error, err: %s", ErrDiskFailure, err.Error())
+	}
 	if len(logFileName) == 0 {
 		binlogDumper.lastLogFile = binlogDumper.binlogServer.binlogName + ".000001"
 	} else {
 		binlogDumper.lastLogFile = logFileName
 	}
 	binlogDumper.currentLogFile = binlogDumper.lastLogFile
+	return nil
 }
 
 /*
@@ -208,132 +321,96 @@ func (binlogDumper *BinlogDumper) setLastLogFile() {
 ==========+=====================================+
  event
 */
-func (binlogDumper *BinlogDumper) setLastLogPos() {
+func (binlogDumper *BinlogDumper) setLastLogPos() error{
 	lastLogFileAbsolate := binlogDumper.getAbsoluteFileName(binlogDumper.lastLogFile)
 	_, err := os.Stat(lastLogFileAbsolate)
-	fileHeaderPos := int64(4)
 	if err != nil {
 		logger.Debug("has no binlog before, now start the first parse!")
-		binlogDumper.lastLogPos = fileHeaderPos
+		binlogDumper.lastLogPos = BINLOG_FILE_HEADER_LENGTH
 	} else {
 		logger.Debug("Parse last log pos from ", lastLogFileAbsolate)
-		binlogDumper.lastLogPos = fileHeaderPos
-		lastLogFile, err := os.OpenFile(lastLogFileAbsolate, os.O_RDONLY, 0444)
-		defer lastLogFile.Close()
+		scan, err := scanBinlogFile(lastLogFileAbsolate)
 		if err != nil {
-			logger.Error("open last binlog file error, err: ", err.Error())
-			panic(err)
+			return err
 		}
-		lastLogFile.Seek(fileHeaderPos, io.SeekCurrent)
-		for {
-			eventHeaderTimestampDescLen := 4
-			typeCodeDescLen := 1
-			serverIdDescLen := 4
-			eventLengthDescLen := 4
-			nextPositionDescLen := 4
-			flagsDescLen := 2
-
-			everyEventHead := eventHeaderTimestampDescLen + typeCodeDescLen + serverIdDescLen
-			everyEventHeadSli := make([]byte, everyEventHead)
-			length, err := lastLogFile.Read(everyEventHeadSli)
-			if err != nil && err == io.EOF{
-				logger.Debug("the last log file read done.")
-				break
+		// 丢弃最后一个完整事务边界之后的数据, 由 master 重新发送
+		if scan.safeFileOffset < scan.fileSize {
+			logger.Warn("truncate incomplete transaction in binlog file ", lastLogFileAbsolate, " from offset ", scan.safeFileOffset, ", file size: ", scan.fileSize)
+			if scan.safeFileOffset < BINLOG_FILE_HEADER_LENGTH {
+				// 文件头也不完整, 删除后重新创建
+				err = os.Remove(lastLogFileAbsolate)
+			} else {
+				err = os.Truncate(lastLogFileAbsolate, scan.safeFileOffset)
 			}
-			if length < everyEventHead {
-				logger.Debug("read event done.")
-				break
-			}
-
-			eventLengthBinarySlice := make([]byte, eventLengthDescLen)
-			length, err = lastLogFile.Read(eventLengthBinarySlice)
-			if err != nil && err == io.EOF{
-				logger.Debug("the last log file read done.")
-				break
+			if err != nil {
+				return fmt.Errorf("%w, truncate binlog file %s error, err: %s", ErrDiskFailure, lastLogFileAbsolate, err.Error())
 			}
-			if length < eventLengthDescLen {
-				logger.Debug("read event done.")
-				break
-			}
-			eventLength := binary.LittleEndian.Uint32(eventLengthBinarySlice)
-
-			nextPositionBinarySlice := make([]byte, nextPositionDescLen)
-			length, err = lastLogFile.Read(nextPositionBinarySlice)
-			if err != nil && err == io.EOF{
-				logger.Debug("the last log file read done.")
-				break
-			}
-			if length < nextPositionDescLen {
-				logger.Debug("read event done.")
-				break
-			}
-
-			nextPosition := binary.LittleEndian.Uint32(nextPositionBinarySlice)
-
-			length, err = lastLogFile.Read(make([]byte, flagsDescLen))
-			eventDataDescLen := eventLength - 19
-			length, err = lastLogFile.Read(make([]byte, eventDataDescLen))
-
-			binlogDumper.lastLogPos = int64(nextPosition)
 		}
+		binlogDumper.lastLogPos = scan.safeLogPos
 	}
 	binlogDumper.currentLogPos = binlogDumper.lastLogPos
+	return nil
 }
 
 func (binlogDumper *BinlogDumper) getAbsoluteFileName(filename string) string {
 	return fmt.Sprintf("%s/%s", binlogDumper.binlogServer.binlogDir, filename)
 }
 
-func (binlogDumper *BinlogDumper) saveBinlogIndex() {
+func (binlogDumper *BinlogDumper) saveBinlogIndex() error{
 	indexFileName := binlogDumper.getIndexFile()
 	indexFile, err := os.OpenFile(binlogDumper.getAbsoluteFileName(indexFileName), os.O_CREATE|os.O_RDWR, 0644)
-	defer indexFile.Close()
 	if err != nil {
-		logger.Fatal("open index file error, err: ", err.Error())
+		return fmt.Errorf("%w, open index file error, err: %s", ErrDiskFailure, err.Error())
 	}
+	defer indexFile.Close()
 	lastLogFileInIndex, err := util.ReadLastLine(indexFile)
 	if err != nil {
-		logger.Fatal("read last log file in index file error, err:", err.Error())
+		return fmt.Errorf("%w, read last log file in index file error, err: %s", ErrDiskFailure, err.Error())
 	}
 	if lastLogFileInIndex == binlogDumper.lastLogFile {
-		return
+		return nil
 	} else {
 		_, err = indexFile.WriteString(fmt.Sprintf("%s\n", binlogDumper.lastLogFile))
 		if err != nil {
-			logger.Debug("err: ", err.Error())
+			return fmt.Errorf("%w, write index file error, err: %s", ErrDiskFailure, err.Error())
 		}
 	}
+	return nil
 }
 
-func (binlogDumper *BinlogDumper) initBinlogFileByFileName(filename string) *os.File{
+func (binlogDumper *BinlogDumper) initBinlogFileByFileName(filename string) (*os.File, error){
 	logger.Debug(filename)
 	if filename != "" {
 		binlogDumper.lastLogFile = filename
 		binlogDumper.currentLogFile = filename
 	}
-	_, err := os.Stat(filename)
+	_, err := os.Stat(binlogDumper.getAbsoluteFileName(filename))
 	if err != nil && os.IsNotExist(err) {
 		logger.Debug("the log file does not exist, will creat it")
 		curLogFile, err := os.OpenFile(binlogDumper.getAbsoluteFileName(filename), os.O_CREATE | os.O_APPEND | os.O_RDWR, 0644)
 		if err != nil {
-			logger.Error("create cur binlog file error, file:", filename, ", err:", err.Error())
+			return nil, fmt.Errorf("%w, create cur binlog file %s error, err: %s", ErrDiskFailure, filename, err.Error())
 		}
 		//fileHeaderBytes := []byte("abcd")
 		//curLogFile.Write(fileHeaderBytes)
 		fileHeaderBytes, _ := hex.DecodeString("fe62696e")
-		curLogFile.Write(fileHeaderBytes)
-		return curLogFile
+		_, err = curLogFile.Write(fileHeaderBytes)
+		if err != nil {
+			curLogFile.Close()
+			return nil, fmt.Errorf("%w, write binlog file header %s error, err: %s", ErrDiskFailure, filename, err.Error())
+		}
+		return curLogFile, nil
 	} else {
 		logger.Debug("the file has exists, now append data")
 		curLogFile, err := os.OpenFile(binlogDumper.getAbsoluteFileName(filename), os.O_APPEND | os.O_RDWR, 0644)
 		if err != nil {
-			logger.Error("open cur binlog file error, err:", err.Error())
+			return nil, fmt.Errorf("%w, open cur binlog file %s error, err: %s", ErrDiskFailure, filename, err.Error())
 		}
-		return curLogFile
+		return curLogFile, nil
 	}
 }
 
-func (binlogDumper *BinlogDumper) initBinlogFile() *os.File{
+func (binlogDumper *BinlogDumper) initBinlogFile() (*os.File, error){
 	return 	binlogDumper.initBinlogFileByFileName(binlogDumper.currentLogFile)
 }
 
@@ -341,89 +418,322 @@ func (binlogDumper *BinlogDumper) SaveGtidSets(gtid string) {
 	binlogDumper.lastGtid = gtid
 }
 
-func (binlogDumper *BinlogDumper) GetRotateLogFile(packetSlice []byte) string {
-	var buffer bytes.Buffer
-	for i := 27; i < len(packetSlice); i++ {
-		if packetSlice[i] == 0x00 {
-			break
+/*
+* 持续 dump binlog, 网络错误和服务端错误会自动重连, 本地文件读写失败等无法恢复的错误返回 error
+* ctx 取消后刷盘并更新 index 文件, 发送 COM_QUIT 后关闭连接, 返回 nil
+*/
+func (this *BinlogDumper) Run(ctx context.Context) error {
+	fw, err := this.initBinlogFile()
+	if err != nil {
+		return err
+	}
+	// shutdown 和 switchBinlogFile 失败时已经关闭了文件, 之后 fw 为 nil
+	defer func() {
+		if fw != nil {
+			fw.Close()
 		}
-		buffer.WriteByte(packetSlice[i])
+		if this.metadataSink != nil {
+			this.metadataSink.Close()
+		}
+	}()
+	shutdown := func(binlogReader *BinlogReaderStream) error {
+		err := this.shutdown(fw, binlogReader)
+		fw = nil
+		return err
 	}
-	return buffer.String()
-}
-
-func (this *BinlogDumper) Run() {
-	fw := this.initBinlogFile()
-	skip_a_rotate_event := false
-	auto_position := false
-	if this.binlogServer.gtid_mode == true {
-		auto_position = true
+	err = this.markSafePoint(fw)
+	if err != nil {
+		return err
 	}
 	logger.Debug("currentLogFile: ", this.currentLogFile, ", currentLogPos: ", this.currentLogPos)
-	binlogReader := newBinlogReaderStream(NewBaseStream(this.binlogServer), this.currentLogFile, this.currentLogPos, auto_position)
+	binlogReader, err := this.reconnect(ctx, fw, 0)
+	if err != nil {
+		if ctx.Err() != nil {
+			return shutdown(nil)
+		}
+		return err
+	}
+	stopWatch := watchContext(ctx, binlogReader.BaseStream)
+	defer func() {
+		stopWatch()
+	}()
 	for {
-		timestamp, event_type, event_size, log_pos, packetSlice := binlogReader.Fetchone()
-		logger.Debug("now received event[%s]:[%s] %s %s", timestamp, event_type, event_size, log_pos)
+		ev, err := binlogReader.Fetchone()
+		if err != nil {
+			if ctx.Err() != nil {
+				stopWatch()
+				return shutdown(binlogReader)
+			}
+			logger.Error("fetch binlog event error, err: ", err.Error())
+			stopWatch()
+			binlogReader.Close()
+			// master 无法提供 binlog 时重连也会得到同样的错误, 保存已经完整写入的事务后退出
+			if isPermanentError(err) {
+				if rollbackErr := this.rollbackToSafePoint(fw); rollbackErr != nil {
+					logger.Error("rollback binlog file error, err: ", rollbackErr.Error())
+				} else if shutdownErr := shutdown(nil); shutdownErr != nil {
+					logger.Error("shutdown binlog dumper error, err: ", shutdownErr.Error())
+				}
+				return err
+			}
+			binlogReader, err = this.reconnect(ctx, fw, 1)
+			if err != nil {
+				if ctx.Err() != nil {
+					return shutdown(nil)
+				}
+				return err
+			}
+			stopWatch = watchContext(ctx, binlogReader.BaseStream)
+			continue
+		}
+		header := ev.GetHeader()
+		event_type := header.EventType
+		log_pos := header.LogPos
+		logger.Debug("now received event[%d]:[%d] %d %d", header.Timestamp, event_type, header.EventSize, log_pos)
+
+		// fake rotate 只告知 master 从哪个 binlog 文件开始发送, 不写入本地文件
+		// dump 开始时和每次 rotate 到新文件后 master 都会发送一个 fake rotate, gtid 模式下可能与本地当前文件不同
+		if rotateEvent, ok := ev.(*event.RotateEvent); ok && rotateEvent.IsArtificial() {
+			newLogFile := rotateEvent.GetNextLogName()
+			if newLogFile != this.currentLogFile {
+				logger.Info("fake rotate to binlog file: ", newLogFile, ", position: ", rotateEvent.GetPosition())
+				fw, err = this.switchBinlogFile(fw, newLogFile)
+				if err != nil {
+					binlogReader.Close()
+					return err
+				}
+			}
+			continue
+		}
 
-		if skip_a_rotate_event && event_type == constants.ROTATE_EVENT {
-			skip_a_rotate_event = false
+		// 重连后已经写入本地文件的 event 不再重复写入
+		if event_type != constants.ROTATE_EVENT && log_pos != 0 && int64(log_pos) <= this.currentLogPos {
+			logger.Debug("skip event already saved, log_pos: ", log_pos)
+			this.sendSemiAck(binlogReader, log_pos)
 			continue
 		}
 
-		err := this.SaveBinlogIntoBinlogFile(fw, packetSlice)
+		// 新事务开始前是一个完整的事务边界
+		if event_type == constants.GTID_LOG_EVENT || event_type == constants.ANONYMOUS_GTID_LOG_EVENT || event_type == constants.MARIADB_GTID_EVENT {
+			err = this.markSafePoint(fw)
+			if err != nil {
+				binlogReader.Close()
+				return err
+			}
+		}
+
+		err = this.SaveBinlogIntoBinlogFile(fw, ev.GetData())
 		if err != nil {
-			os.Exit(1)
+			binlogReader.Close()
+			return err
 		} else {
-			this.SaveBinlogIntoMySQL(packetSlice)
+			this.SaveBinlogIntoMySQL(ev)
+		}
+		if log_pos != 0 {
+			this.currentLogPos = int64(log_pos)
 		}
+		this.sendSemiAck(binlogReader, log_pos)
 
-		if event_type == constants.GTID_LOG_EVENT {
-			gtid_event := packet.NewGtidEvent()
-			gtid_event.LoadFromPacket(packetSlice[19:])
-			this.SaveGtidSets(gtid_event.GetGtid())
+		if gtidEvent, ok := ev.(*event.GtidEvent); ok {
+			this.SaveGtidSets(gtidEvent.GetGtid())
+			this.pendingGtid = gtidEvent.GetGtid()
 		}
 
-		if event_type == constants.ROTATE_EVENT {
-			fw.Close()
-			newLogFile := this.GetRotateLogFile(packetSlice)
+		if mariadbGtidEvent, ok := ev.(*event.MariadbGtidEvent); ok {
+			this.SaveGtidSets(mariadbGtidEvent.GetGtid())
+			this.pendingGtid = mariadbGtidEvent.GetGtid()
+		}
+
+		// 文件开头的 PREVIOUS_GTIDS 是该文件之前的全部 gtid, 重连时不需要再接收
+		if previousGtidsEvent, ok := ev.(*event.PreviousGtidsEvent); ok {
+			this.executedGtidSet = this.executedGtidSet.Union(previousGtidsEvent.GetGtidSet())
+		}
+		if gtidListEvent, ok := ev.(*event.MariadbGtidListEvent); ok {
+			for _, gtid := range gtidListEvent.GetGtids() {
+				this.executedMariadbGtidSet.Update(gtid)
+			}
+		}
+
+		// 非事务引擎的事务以 COMMIT 结束, 压缩的事务整个在一个 TRANSACTION_PAYLOAD_EVENT 中
+		queryEvent, isQuery := ev.(*event.QueryEvent)
+		if event_type == constants.XID_EVENT || event_type == constants.TRANSACTION_PAYLOAD_EVENT || (isQuery && queryEvent.IsCommit()) {
+			err = this.markSafePoint(fw)
+			if err != nil {
+				binlogReader.Close()
+				return err
+			}
+		}
+
+		if rotateEvent, ok := ev.(*event.RotateEvent); ok {
+			newLogFile := rotateEvent.GetNextLogName()
 			logger.Info("Rotate new binlog file: ", newLogFile)
-			this.SaveGtidIndex()
-			fw = this.initBinlogFileByFileName(newLogFile)
-			this.saveBinlogIndex()
-			skip_a_rotate_event = true
+			fw, err = this.switchBinlogFile(fw, newLogFile)
+			if err != nil {
+				binlogReader.Close()
+				return err
+			}
+		}
+	}
+}
+
+/*
+* 关闭当前 binlog 文件, 切换到 filename 并更新 index 文件
+* filename 在本地已经存在时, 从它最后一个 event 之后继续写入, 已经写入的 event 不再重复写入
+* 失败时原文件已经关闭, 返回 nil
+*/
+func (this *BinlogDumper) switchBinlogFile(fw *os.File, filename string) (*os.File, error) {
+	fw.Close()
+	err := this.SaveGtidIndex()
+	if err != nil {
+		return nil, err
+	}
+	this.lastLogFile = filename
+	err = this.setLastLogPos()
+	if err != nil {
+		return nil, err
+	}
+	newFw, err := this.initBinlogFileByFileName(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = this.saveBinlogIndex()
+	if err != nil {
+		newFw.Close()
+		return nil, err
+	}
+	err = this.markSafePoint(newFw)
+	if err != nil {
+		newFw.Close()
+		return nil, err
+	}
+	return newFw, nil
+}
+
+/*
+* ctx 取消后, 中断连接上阻塞的读取
+* 返回的函数用于停止监听, 连接被替换或关闭前调用
+*/
+func watchContext(ctx context.Context, stream *BaseStream) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			stream.interrupt()
+		case <-done:
+		}
+	}()
+	stopped := false
+	return func() {
+		if !stopped {
+			stopped = true
+			close(done)
+		}
+	}
+}
+
+/*
+* 优雅退出: 刷盘当前 binlog 文件, 更新 .index 和 .gtid.index 文件, 发送 COM_QUIT 并关闭连接
+*/
+func (this *BinlogDumper) shutdown(fw *os.File, binlogReader *BinlogReaderStream) error {
+	logger.Info("shutdown binlog dumper, currentLogFile: ", this.currentLogFile, ", currentLogPos: ", this.currentLogPos)
+	if binlogReader != nil {
+		err := binlogReader.Quit()
+		if err != nil {
+			logger.Warn("send COM_QUIT to master error, err: ", err.Error())
 		}
 	}
+
+	err := fw.Sync()
+	if err != nil {
+		return fmt.Errorf("%w, sync binlog file error, err: %s", ErrDiskFailure, err.Error())
+	}
+	err = fw.Close()
+	if err != nil {
+		return fmt.Errorf("%w, close binlog file error, err: %s", ErrDiskFailure, err.Error())
+	}
+	err = this.saveBinlogIndex()
+	if err != nil {
+		return err
+	}
+	this.flushMetadata()
+	return this.SaveGtidIndex()
 }
 
-func (this *BinlogDumper) SaveGtidIndex() {
+func (this *BinlogDumper) SaveGtidIndex() error {
 	if this.lastGtid == "" {
-		return
+		return nil
 	}
 	gtidIndexFileName := strings.Replace(this.getAbsoluteFileName(this.getIndexFile()), "index", "gtid.index", 1)
 	file, err := os.OpenFile(gtidIndexFileName, os.O_CREATE | os.O_APPEND | os.O_RDWR, 0644)
 	if err != nil {
-		logger.Error("open file ", gtidIndexFileName, " error, err: ", err.Error())
-		os.Exit(1)
+		return fmt.Errorf("%w, open file %s error, err: %s", ErrDiskFailure, gtidIndexFileName, err.Error())
 	}
+	defer file.Close()
 	rd := bufio.NewReader(file)
 	for {
 		lines, err := rd.ReadString('\n')
-		if err != nil && err == io.EOF {
+		if strings.HasPrefix(lines, this.lastLogFile + ":") {
+			return nil
+		}
+		if err == io.EOF {
 			break
 		}
-		if strings.Contains(lines, this.getIndexFile()) {
-			return
+		if err != nil {
+			return fmt.Errorf("%w, read file %s error, err: %s", ErrDiskFailure, gtidIndexFileName, err.Error())
 		}
 	}
-	file.WriteString(fmt.Sprintf("%s:%s\n", this.lastLogFile, this.lastGtid))
+	_, err = file.WriteString(fmt.Sprintf("%s:%s\n", this.lastLogFile, this.lastGtid))
+	if err != nil {
+		return fmt.Errorf("%w, write file %s error, err: %s", ErrDiskFailure, gtidIndexFileName, err.Error())
+	}
+	return nil
 }
 
 func (this *BinlogDumper) SaveBinlogIntoBinlogFile(fw *os.File, packetSlice []byte) error{
 	_, err := fw.Write(packetSlice)
 	if err != nil {
-		logger.Error("write packetSlice to file error, err: ", err.Error())
-		return err
+		return fmt.Errorf("%w, write packetSlice to file error, err: %s", ErrDiskFailure, err.Error())
+	}
+	err = fw.Sync()
+	if err != nil {
+		return fmt.Errorf("%w, sync binlog file error, err: %s", ErrDiskFailure, err.Error())
 	}
-	fw.Sync()
 	return nil
-}
\ No newline at end of file
+}
+
+/*
+* 半同步复制: event 已经写入并 sync 到本地文件, master 要求确认时发送 ack
+* 发送失败时下一次读取也会失败并重连, 这里只记录日志
+*/
+func (this *BinlogDumper) sendSemiAck(binlogReader *BinlogReaderStream, logPos uint32) {
+	if !binlogReader.NeedAck() {
+		return
+	}
+	err := binlogReader.SendSemiAck(this.currentLogFile, logPos)
+	if err != nil {
+		logger.Warn("send semi sync ack error, err: ", err.Error())
+	}
+}
+
+/*
+* 记录 event 元数据, 同一个事务的 event 先缓存, 在事务边界由 flushMetadata 写入 MySQL
+*/
+func (this *BinlogDumper) SaveBinlogIntoMySQL(ev event.Event) {
+	if this.metadataSink == nil {
+		return
+	}
+	this.metadataSink.Add(this.currentLogFile, ev)
+}
+
+/*
+* 元数据由后台 goroutine 写入, 队列满时丢弃, 不影响 binlog dump, 只记录日志
+*/
+func (this *BinlogDumper) flushMetadata() {
+	if this.metadataSink == nil {
+		return
+	}
+	err := this.metadataSink.Flush()
+	if err != nil {
+		logger.Warn("save event metadata into mysql error, err: ", err.Error())
+	}
+}
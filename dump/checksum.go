@@ -0,0 +1,45 @@
+package dump
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/goMySQLSemiSync/constants"
+	"hash/crc32"
+	"strings"
+)
+
+func parseChecksumAlg(binlogChecksum string) (int, error) {
+	switch strings.ToUpper(binlogChecksum) {
+	case "NONE":
+		return constants.BINLOG_CHECKSUM_ALG_OFF, nil
+	case "CRC32":
+		return constants.BINLOG_CHECKSUM_ALG_CRC32, nil
+	}
+	return constants.BINLOG_CHECKSUM_ALG_UNDEF, fmt.Errorf("unsupported binlog_checksum %s", binlogChecksum)
+}
+
+/*
+* FORMAT_DESCRIPTION_EVENT 的最后 5 个字节为 checksum_alg(1) + checksum(4), 不论 checksum 是否开启
+ */
+func getFormatDescriptionChecksumAlg(event []byte) int {
+	if len(event) < 19+1+constants.BINLOG_CHECKSUM_LEN {
+		return constants.BINLOG_CHECKSUM_ALG_UNDEF
+	}
+	return int(event[len(event)-1-constants.BINLOG_CHECKSUM_LEN])
+}
+
+/*
+* 校验 event 最后 4 个字节的 CRC32
+ */
+func verifyEventChecksum(event []byte) error {
+	size := len(event)
+	if size < 19+constants.BINLOG_CHECKSUM_LEN {
+		return fmt.Errorf("%w, event too short for checksum, length: %d", ErrChecksumMismatch, size)
+	}
+	expected := binary.LittleEndian.Uint32(event[size-constants.BINLOG_CHECKSUM_LEN:])
+	actual := crc32.ChecksumIEEE(event[:size-constants.BINLOG_CHECKSUM_LEN])
+	if expected != actual {
+		return fmt.Errorf("%w, event type: %d, expect crc32 0x%08x, but got 0x%08x", ErrChecksumMismatch, event[4], expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package dump
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"github.com/goMySQLSemiSync/protocol"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"net"
+)
+
+const (
+	COMPRESSION_NONE = "none"
+	COMPRESSION_ZLIB = "zlib"
+	COMPRESSION_ZSTD = "zstd"
+
+	// 压缩包头: 3 字节压缩后长度 + 1 字节压缩序号 + 3 字节压缩前长度
+	COMPRESSED_HEADER_LENGTH = 7
+	// 小于该长度的数据不压缩, 与 MySQL 的 MIN_COMPRESS_LENGTH 一致
+	MIN_COMPRESS_LENGTH = 50
+	// 单个压缩包的最大负载
+	MAX_COMPRESSED_PAYLOAD = 0xffffff
+
+	DEFAULT_ZSTD_LEVEL = 3
+)
+
+func isValidCompression(compression string) bool {
+	switch compression {
+	case "", COMPRESSION_NONE, COMPRESSION_ZLIB, COMPRESSION_ZSTD:
+		return true
+	}
+	return false
+}
+
+func (b *BinlogServer) useCompression() bool {
+	return b.compression != "" && b.compression != COMPRESSION_NONE
+}
+
+type compressor interface {
+	compress(data []byte) ([]byte, error)
+	decompress(data []byte, uncompressedLength int) ([]byte, error)
+	close()
+}
+
+type zlibCompressor struct{}
+
+func (z *zlibCompressor) compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (z *zlibCompressor) close() {}
+
+func (z *zlibCompressor) decompress(data []byte, uncompressedLength int) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) != uncompressedLength {
+		return nil, fmt.Errorf("zlib uncompressed length mismatch, expect %d, got %d", uncompressedLength, len(out))
+	}
+	return out, nil
+}
+
+type zstdCompressor struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func newZstdCompressor(level int) (*zstdCompressor, error) {
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	if err != nil {
+		return nil, err
+	}
+	// 一个连接只有一个数据流, 不需要并发解压
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		encoder.Close()
+		return nil, err
+	}
+	return &zstdCompressor{
+		encoder: encoder,
+		decoder: decoder,
+	}, nil
+}
+
+func (z *zstdCompressor) close() {
+	z.encoder.Close()
+	z.decoder.Close()
+}
+
+func (z *zstdCompressor) compress(data []byte) ([]byte, error) {
+	return z.encoder.EncodeAll(data, nil), nil
+}
+
+func (z *zstdCompressor) decompress(data []byte, uncompressedLength int) ([]byte, error) {
+	out, err := z.decoder.DecodeAll(data, make([]byte, 0, uncompressedLength))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) != uncompressedLength {
+		return nil, fmt.Errorf("zstd uncompressed length mismatch, expect %d, got %d", uncompressedLength, len(out))
+	}
+	return out, nil
+}
+
+/*
+* 压缩协议的连接, 认证完成后替换 BaseStream 中的连接
+* 对上层的 read_packet/send_packet 透明: 读到的是解压后的 MySQL packet 字节流, 写入的 MySQL packet 被压缩后发送
+*
+* 压缩包格式
+* 3              length of compressed payload
+* 1              compressed sequence id
+* 3              length of payload before compression, 0 表示未压缩
+* string[len]    compressed payload
+ */
+type compressedConn struct {
+	net.Conn
+	compressor     compressor
+	sequenceId     int // 下一个发送的压缩序号
+	readSequenceId int // 下一个收到的压缩序号
+	readBuf        bytes.Buffer
+}
+
+func newCompressedConn(conn net.Conn, compression string, zstdLevel int) (*compressedConn, error) {
+	var c compressor
+	switch compression {
+	case COMPRESSION_ZLIB:
+		c = &zlibCompressor{}
+	case COMPRESSION_ZSTD:
+		zc, err := newZstdCompressor(zstdLevel)
+		if err != nil {
+			return nil, err
+		}
+		c = zc
+	default:
+		return nil, fmt.Errorf("unsupported compression %s", compression)
+	}
+	return &compressedConn{
+		Conn:           conn,
+		compressor:     c,
+		sequenceId:     0,
+		readSequenceId: 0,
+	}, nil
+}
+
+func (c *compressedConn) Read(p []byte) (int, error) {
+	for c.readBuf.Len() == 0 {
+		if err := c.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	return c.readBuf.Read(p)
+}
+
+func (c *compressedConn) readFrame() error {
+	header := make([]byte, COMPRESSED_HEADER_LENGTH)
+	if _, err := io.ReadFull(c.Conn, header); err != nil {
+		return err
+	}
+	compressedLength := protocol.Get_fixed_int_sniplet(header[0:3])
+	sequenceId := int(header[3])
+	if sequenceId != c.readSequenceId {
+		return fmt.Errorf("%w, compressed packets out of order, expect sequence id %d, but got %d", protocol.ErrProtocolViolation, c.readSequenceId, sequenceId)
+	}
+	c.readSequenceId = (sequenceId + 1) & 0xff
+	c.sequenceId = c.readSequenceId
+	uncompressedLength := protocol.Get_fixed_int_sniplet(header[4:7])
+
+	payload := make([]byte, compressedLength)
+	if _, err := io.ReadFull(c.Conn, payload); err != nil {
+		return err
+	}
+	if uncompressedLength == 0 {
+		c.readBuf.Write(payload)
+		return nil
+	}
+	out, err := c.compressor.decompress(payload, uncompressedLength)
+	if err != nil {
+		return err
+	}
+	c.readBuf.Write(out)
+	return nil
+}
+
+func (c *compressedConn) Write(p []byte) (int, error) {
+	written, err := c.writeWithoutReply(p)
+	// 服务端的回复接着本端的压缩序号
+	c.readSequenceId = c.sequenceId
+	return written, err
+}
+
+/*
+* 发送服务端不会回复的数据 (如半同步 ack), 不影响收到的压缩序号
+ */
+func (c *compressedConn) writeWithoutReply(p []byte) (int, error) {
+	// 新命令 (packet 序号为 0) 重置压缩序号
+	if len(p) >= 4 && p[3] == 0 {
+		c.sequenceId = 0
+	}
+
+	written := 0
+	for written < len(p) {
+		size := len(p) - written
+		if size > MAX_COMPRESSED_PAYLOAD {
+			size = MAX_COMPRESSED_PAYLOAD
+		}
+		if err := c.writeFrame(p[written : written+size]); err != nil {
+			return written, err
+		}
+		written += size
+	}
+	return written, nil
+}
+
+/*
+* 释放压缩器 (zstd 的后台 goroutine) 并关闭底层连接
+ */
+func (c *compressedConn) Close() error {
+	c.compressor.close()
+	return c.Conn.Close()
+}
+
+func (c *compressedConn) writeFrame(data []byte) error {
+	payload := data
+	uncompressedLength := 0
+	if len(data) >= MIN_COMPRESS_LENGTH {
+		compressed, err := c.compressor.compress(data)
+		if err != nil {
+			return err
+		}
+		// 压缩后变大的数据按未压缩发送
+		if len(compressed) < len(data) {
+			payload = compressed
+			uncompressedLength = len(data)
+		}
+	}
+
+	frame := make([]byte, 0, COMPRESSED_HEADER_LENGTH+len(payload))
+	frame = append(frame, protocol.Build_fixed_int(3, len(payload))...)
+	frame = append(frame, protocol.Build_fixed_int(1, c.sequenceId)...)
+	frame = append(frame, protocol.Build_fixed_int(3, uncompressedLength)...)
+	frame = append(frame, payload...)
+	c.sequenceId = (c.sequenceId + 1) & 0xff
+
+	_, err := c.Conn.Write(frame)
+	return err
+}
@@ -0,0 +1,55 @@
+package dump
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+func TestCompressedConnSequenceId(t *testing.T) {
+	for _, compression := range []string{COMPRESSION_ZLIB, COMPRESSION_ZSTD} {
+		client, server := net.Pipe()
+		clientConn, err := newCompressedConn(client, compression, DEFAULT_ZSTD_LEVEL)
+		if err != nil {
+			t.Fatalf("%s: new compressed conn error: %v", compression, err)
+		}
+		serverConn, _ := newCompressedConn(server, compression, DEFAULT_ZSTD_LEVEL)
+
+		// 客户端发送一个新命令, 服务端的回复接着客户端的压缩序号
+		command := append([]byte{60, 0, 0, 0}, bytes.Repeat([]byte{'a'}, 60)...)
+		done := make(chan struct{})
+		go func() {
+			clientConn.Write(command)
+			close(done)
+		}()
+		received := make([]byte, len(command))
+		if _, err := io.ReadFull(server, received[:COMPRESSED_HEADER_LENGTH]); err != nil || received[3] != 0 {
+			t.Fatalf("%s: expect compressed sequence id 0, got %v, err: %v", compression, received[:COMPRESSED_HEADER_LENGTH], err)
+		}
+		payload := make([]byte, protocol.Get_fixed_int_sniplet(received[0:3]))
+		io.ReadFull(server, payload)
+		<-done
+
+		reply := append([]byte{60, 0, 0, 1}, bytes.Repeat([]byte{'b'}, 60)...)
+		serverConn.sequenceId = 1
+		go serverConn.writeWithoutReply(reply)
+		if _, err := io.ReadFull(clientConn, received); err != nil || !bytes.Equal(received, reply) {
+			t.Fatalf("%s: read reply error: %v", compression, err)
+		}
+
+		// 乱序的压缩包
+		serverConn.sequenceId = 5
+		go serverConn.writeWithoutReply(reply)
+		_, err = io.ReadFull(clientConn, received)
+		if !errors.Is(err, protocol.ErrProtocolViolation) {
+			t.Errorf("%s: expect protocol violation for out of order packet, got %v", compression, err)
+		}
+
+		clientConn.Close()
+		serverConn.Close()
+	}
+}
@@ -0,0 +1,16 @@
+package dump
+
+import (
+	"errors"
+)
+
+var (
+	// 读写本地 binlog 文件或 index 文件失败
+	ErrDiskFailure = errors.New("disk failure")
+	// binlog event 的 checksum 校验失败
+	ErrChecksumMismatch = errors.New("binlog checksum mismatch")
+	// 配置错误
+	ErrInvalidConfig = errors.New("invalid config")
+	// 决定文件格式, 文件切换和事务边界的 event 解码失败, master 重新发送的还是同样的 event
+	ErrDecode = errors.New("decode binlog event error")
+)
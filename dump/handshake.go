@@ -0,0 +1,367 @@
+package dump
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/goMySQLSemiSync/packet"
+	"github.com/goMySQLSemiSync/protocol"
+	"github.com/wonderivan/logger"
+	"net"
+	"os"
+)
+
+const (
+	HANDSHAKE_READ_CHALLENGE   = iota // 读取服务端 Challenge
+	HANDSHAKE_SSL_REQUEST             // 发送 SSLRequest 并升级为 TLS 连接
+	HANDSHAKE_SEND_RESPONSE           // 发送 HandshakeResponse
+	HANDSHAKE_READ_AUTH_RESULT        // 读取认证结果: OK / ERR / AuthSwitchRequest / AuthMoreData
+	HANDSHAKE_DONE                    // 认证完成
+)
+
+/*
+* 握手/认证失败时返回的错误
+* 服务端返回 ERR 时 ErrCode/SqlState 有值, 否则为客户端发现的协议错误
+ */
+type AuthError struct {
+	PluginName string
+	State      int
+	ErrCode    int
+	SqlState   string
+	Message    string
+}
+
+func (e *AuthError) Is(target error) bool {
+	return target == protocol.ErrAuthFailed
+}
+
+func (e *AuthError) Error() string {
+	if e.ErrCode != 0 {
+		return fmt.Sprintf("auth failed, plugin: %s, errorCode: %d, sqlState: %s, errorMessage: %s", e.PluginName, e.ErrCode, e.SqlState, e.Message)
+	}
+	return fmt.Sprintf("auth failed, plugin: %s, state: %d, err: %s", e.PluginName, e.State, e.Message)
+}
+
+type handshake struct {
+	stream        *BaseStream
+	state         int
+	challenge     *packet.Challenge
+	authenticator Authenticator
+	password      []byte
+	seed          []byte
+	sequenceId    int
+	compression   string
+}
+
+func newHandshake(stream *BaseStream) *handshake {
+	return &handshake{
+		stream:        stream,
+		state:         HANDSHAKE_READ_CHALLENGE,
+		challenge:     nil,
+		authenticator: nil,
+		password:      []byte(stream.binlogServer.password),
+		seed:          nil,
+		sequenceId:    0,
+		compression:   COMPRESSION_NONE,
+	}
+}
+
+func (h *handshake) run() error {
+	for h.state != HANDSHAKE_DONE {
+		var err error
+		switch h.state {
+		case HANDSHAKE_READ_CHALLENGE:
+			err = h.readChallenge()
+		case HANDSHAKE_SSL_REQUEST:
+			err = h.sslRequest()
+		case HANDSHAKE_SEND_RESPONSE:
+			err = h.sendResponse()
+		case HANDSHAKE_READ_AUTH_RESULT:
+			err = h.readAuthResult()
+		default:
+			err = h.newError(fmt.Sprintf("unknown handshake state %d", h.state))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *handshake) newError(message string) *AuthError {
+	pluginName := ""
+	if h.authenticator != nil {
+		pluginName = h.authenticator.GetPluginName()
+	}
+	return &AuthError{
+		PluginName: pluginName,
+		State:      h.state,
+		Message:    message,
+	}
+}
+
+/*
+* 读写连接失败不是认证失败, 由调用方重连
+ */
+func (h *handshake) newIOError(err error) error {
+	return fmt.Errorf("handshake error, state: %d, err: %w", h.state, err)
+}
+
+func (h *handshake) newServerError(p *protocol.Packet) *AuthError {
+	e := protocol.LoadFromPacket(p)
+	authErr := h.newError(e.GetErrorMessage())
+	authErr.ErrCode = e.GetErrCode()
+	authErr.SqlState = e.GetSqlState()
+	return authErr
+}
+
+func (h *handshake) send(payload []byte) error {
+	p := protocol.NewPacket()
+	p.SequenceId = h.sequenceId
+	p.Payload = payload
+	h.sequenceId++
+	return h.stream.send_packet(p.ToPacket())
+}
+
+func (h *handshake) read() (*protocol.Packet, error) {
+	p, err := h.stream.read_raw_packet()
+	if err != nil {
+		return nil, err
+	}
+	h.sequenceId = p.SequenceId + 1
+	return p, nil
+}
+
+func (h *handshake) readChallenge() error {
+	p, err := h.read()
+	if err != nil {
+		return h.newIOError(err)
+	}
+	if p.GetType() == byte(protocol.ERR) {
+		return h.newServerError(p)
+	}
+	h.challenge = packet.LoadFromPacket(p)
+	h.seed = []byte(fmt.Sprintf("%s%s", h.challenge.GetChallenge1(), h.challenge.GetChallenge2()))
+	if len(h.seed) < protocol.SCRAMBLE_LENGTH {
+		return h.newError(fmt.Sprintf("auth plugin data in handshake too short: %d", len(h.seed)))
+	}
+
+	authenticator, err := GetAuthenticator(h.challenge.GetAuthPluginName())
+	if err != nil {
+		return h.newError(err.Error())
+	}
+	h.authenticator = authenticator
+	h.negotiateCompression()
+	if h.stream.binlogServer.useTLS() {
+		h.state = HANDSHAKE_SSL_REQUEST
+	} else {
+		h.state = HANDSHAKE_SEND_RESPONSE
+	}
+	return nil
+}
+
+/*
+* 按配置和服务端能力选择压缩算法, 服务端不支持时退回不压缩
+ */
+func (h *handshake) negotiateCompression() {
+	server := h.stream.binlogServer
+	if !server.useCompression() {
+		return
+	}
+	serverFlags := h.challenge.GetCapabilityFlag()
+	switch server.compression {
+	case COMPRESSION_ZLIB:
+		if serverFlags&protocol.CLIENT_COMPRESS != 0 {
+			h.compression = COMPRESSION_ZLIB
+		}
+	case COMPRESSION_ZSTD:
+		if serverFlags&protocol.CLIENT_ZSTD_COMPRESSION_ALGORITHM != 0 {
+			h.compression = COMPRESSION_ZSTD
+		}
+	}
+	if h.compression == COMPRESSION_NONE {
+		logger.Warn("the server does not support compression ", server.compression, ", use uncompressed protocol")
+	}
+}
+
+func (h *handshake) capabilityFlags() int {
+	flags := 33531397
+	flags &= ^protocol.CLIENT_COMPRESS
+	flags &= ^protocol.CLIENT_ZSTD_COMPRESSION_ALGORITHM
+	flags &= ^protocol.CLIENT_LOCAL_FILES
+	switch h.compression {
+	case COMPRESSION_ZLIB:
+		flags |= protocol.CLIENT_COMPRESS
+	case COMPRESSION_ZSTD:
+		flags |= protocol.CLIENT_ZSTD_COMPRESSION_ALGORITHM
+	}
+	if h.stream.binlogServer.useTLS() {
+		flags |= protocol.CLIENT_SSL
+	} else {
+		flags &= ^protocol.CLIENT_SSL
+	}
+	return flags
+}
+
+/*
+* SSLRequest: 发送 HandshakeResponse 的前 32 字节, 然后在同一个连接上进行 TLS 握手
+* 之后的 HandshakeResponse 及所有 binlog 数据都走 TLS
+ */
+func (h *handshake) sslRequest() error {
+	if h.challenge.GetCapabilityFlag()&protocol.CLIENT_SSL == 0 {
+		return h.newError("ssl is required but the server does not support ssl")
+	}
+	tlsConfig, err := h.stream.binlogServer.newTLSConfig()
+	if err != nil {
+		return h.newError(err.Error())
+	}
+
+	sslRequest := packet.NewSSLRequest()
+	sslRequest.SequenceId = h.sequenceId
+	sslRequest.SetCapablityFlag(h.capabilityFlags())
+	sslRequest.SetCharacterSet(33)
+	sslRequest.SetMaxPacketSize(16777216)
+	sslRequest.Payload = sslRequest.GetPayload()
+	h.sequenceId++
+	err = h.stream.send_packet(sslRequest.ToPacket())
+	if err != nil {
+		return h.newIOError(err)
+	}
+
+	tlsConn := tls.Client(*h.stream.conn, tlsConfig)
+	err = tlsConn.Handshake()
+	if err != nil {
+		return h.newError(fmt.Sprintf("tls handshake error, err: %s", err.Error()))
+	}
+	var conn net.Conn = tlsConn
+	h.stream.conn = &conn
+	logger.Info("replication connection upgraded to tls, ssl mode: ", h.stream.binlogServer.sslMode)
+
+	h.state = HANDSHAKE_SEND_RESPONSE
+	return nil
+}
+
+func (h *handshake) sendResponse() error {
+	scramble_password, err := h.authenticator.Scramble(h.password, h.seed)
+	if err != nil {
+		return h.newError(err.Error())
+	}
+
+	response := packet.NewResponse()
+	response.SequenceId = h.sequenceId
+	response.SetCapablityFlag(h.capabilityFlags())
+	response.SetCharacterSet(33)
+	response.SetMaxPacketSize(16777216)
+	clientAttributes := make(map[string]string)
+	clientAttributes["_client_name"] = "gomysql"
+	clientAttributes["_pid"] = fmt.Sprintf("%d", os.Getpid())
+	clientAttributes["_client_version"] = "5.7"
+	clientAttributes["program_name"] = "mysql"
+	response.SetClientAttributes(clientAttributes)
+	response.SetPluginName(h.authenticator.GetPluginName())
+	response.SetUsername(h.stream.binlogServer.user)
+	response.SetSchema("")
+	response.SetAuthResponse(scramble_password)
+	response.SetZstdCompressionLevel(h.stream.binlogServer.zstdLevel)
+	response.Payload = response.GetPayload()
+	h.sequenceId++
+	err = h.stream.send_packet(response.ToPacket())
+	if err != nil {
+		return h.newIOError(err)
+	}
+
+	h.state = HANDSHAKE_READ_AUTH_RESULT
+	return nil
+}
+
+func (h *handshake) readAuthResult() error {
+	p, err := h.read()
+	if err != nil {
+		return h.newIOError(err)
+	}
+	if len(p.Payload) == 0 {
+		return h.newError("empty packet in auth result")
+	}
+
+	switch p.GetType() {
+	case byte(protocol.OK):
+		h.state = HANDSHAKE_DONE
+		return h.enableCompression()
+	case byte(protocol.ERR):
+		return h.newServerError(p)
+	case byte(protocol.EOF):
+		return h.authSwitch(p)
+	case byte(protocol.AUTH_MORE_DATA):
+		return h.authMoreData(p)
+	}
+	return h.newError(fmt.Sprintf("unexpected packet type 0x%02x in auth result", p.GetType()))
+}
+
+/*
+* 认证完成后, 之后的所有 packet 都走压缩协议
+ */
+func (h *handshake) enableCompression() error {
+	if h.compression == COMPRESSION_NONE {
+		return nil
+	}
+	conn, err := newCompressedConn(*h.stream.conn, h.compression, h.stream.binlogServer.zstdLevel)
+	if err != nil {
+		return h.newError(err.Error())
+	}
+	var c net.Conn = conn
+	h.stream.conn = &c
+	logger.Info("replication connection use compressed protocol: ", h.compression)
+	return nil
+}
+
+/*
+* AuthSwitchRequest: 服务端要求换一个认证插件, 用新的插件和新的 seed 重新 scramble
+ */
+func (h *handshake) authSwitch(p *protocol.Packet) error {
+	switchRequest, err := packet.LoadFromPacketToAuthSwitchRequest(p)
+	if err != nil {
+		return h.newError(err.Error())
+	}
+	logger.Info("server requested auth switch to ", switchRequest.GetPluginName())
+
+	authenticator, err := GetAuthenticator(switchRequest.GetPluginName())
+	if err != nil {
+		return h.newError(err.Error())
+	}
+	h.authenticator = authenticator
+	h.seed = switchRequest.GetAuthData()
+	if len(h.seed) < protocol.SCRAMBLE_LENGTH {
+		return h.newError(fmt.Sprintf("auth switch data too short: %d", len(h.seed)))
+	}
+
+	scramble_password, err := h.authenticator.Scramble(h.password, h.seed)
+	if err != nil {
+		return h.newError(err.Error())
+	}
+	err = h.send(scramble_password)
+	if err != nil {
+		return h.newIOError(err)
+	}
+	return nil
+}
+
+/*
+* AuthMoreData: 交给当前认证插件处理
+ */
+func (h *handshake) authMoreData(p *protocol.Packet) error {
+	moreData, err := packet.LoadFromPacketToAuthMoreData(p)
+	if err != nil {
+		return h.newError(err.Error())
+	}
+
+	authData, err := h.authenticator.MoreData(h.password, h.seed, moreData.GetAuthData(), h.stream.isSecure())
+	if err != nil {
+		return h.newError(err.Error())
+	}
+	if authData != nil {
+		err = h.send(authData)
+		if err != nil {
+			return h.newIOError(err)
+		}
+	}
+	return nil
+}
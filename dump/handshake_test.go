@@ -0,0 +1,138 @@
+package dump
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+func newTestErrPayload(errCode int, sqlState string, message string) []byte {
+	payload := []byte{0xff, byte(errCode), byte(errCode >> 8), '#'}
+	payload = append(payload, sqlState...)
+	return append(payload, message...)
+}
+
+func TestHandshakeNativePassword(t *testing.T) {
+	var authResponse []byte
+	h, err := runTestHandshake(t, newTestAuthBinlogServer(), func(s *testAuthServer) {
+		s.writeChallenge(AUTH_NATIVE_PASSWORD, testServerCapabilityFlags)
+		authResponse = s.readResponse()
+		s.writeOK()
+	})
+	if err != nil {
+		t.Fatalf("handshake error: %v", err)
+	}
+	if h.state != HANDSHAKE_DONE || h.authenticator.GetPluginName() != AUTH_NATIVE_PASSWORD {
+		t.Errorf("expect done with %s, got state %d", AUTH_NATIVE_PASSWORD, h.state)
+	}
+	if expect := protocol.Scramble_native_password([]byte("secret"), testAuthSeed); !bytes.Equal(authResponse, expect) {
+		t.Errorf("expect auth response %x, got %x", expect, authResponse)
+	}
+}
+
+func TestHandshakeAuthSwitch(t *testing.T) {
+	switchSeed := []byte("abcdefghij0123456789")
+	var switchResponse []byte
+	h, err := runTestHandshake(t, newTestAuthBinlogServer(), func(s *testAuthServer) {
+		s.writeChallenge(AUTH_CACHING_SHA2_PASSWORD, testServerCapabilityFlags)
+		s.readResponse()
+		payload := append([]byte{0xfe}, AUTH_NATIVE_PASSWORD+"\x00"...)
+		s.write(append(append(payload, switchSeed...), 0x00))
+		switchResponse = s.read()
+		s.writeOK()
+	})
+	if err != nil {
+		t.Fatalf("handshake error: %v", err)
+	}
+	if h.authenticator.GetPluginName() != AUTH_NATIVE_PASSWORD {
+		t.Errorf("expect switch to %s, got %s", AUTH_NATIVE_PASSWORD, h.authenticator.GetPluginName())
+	}
+	// 用新插件和新 seed 重新 scramble
+	if expect := protocol.Scramble_native_password([]byte("secret"), switchSeed); !bytes.Equal(switchResponse, expect) {
+		t.Errorf("expect auth switch response %x, got %x", expect, switchResponse)
+	}
+}
+
+func TestHandshakeAuthError(t *testing.T) {
+	tests := []struct {
+		name      string
+		serve     func(s *testAuthServer)
+		state     int
+		errCode   int
+		permanent bool
+	}{
+		{
+			"access denied",
+			func(s *testAuthServer) {
+				s.writeChallenge(AUTH_NATIVE_PASSWORD, testServerCapabilityFlags)
+				s.readResponse()
+				s.write(newTestErrPayload(1045, "28000", "Access denied for user 'repl'"))
+			},
+			HANDSHAKE_READ_AUTH_RESULT, 1045, true,
+		},
+		{
+			"host not allowed",
+			func(s *testAuthServer) {
+				s.write(newTestErrPayload(1130, "HY000", "Host is not allowed to connect"))
+			},
+			HANDSHAKE_READ_CHALLENGE, 1130, true,
+		},
+		{
+			"unsupported plugin",
+			func(s *testAuthServer) {
+				s.writeChallenge("sha256_password", testServerCapabilityFlags)
+			},
+			HANDSHAKE_READ_CHALLENGE, 0, true,
+		},
+		{
+			"unexpected packet",
+			func(s *testAuthServer) {
+				s.writeChallenge(AUTH_NATIVE_PASSWORD, testServerCapabilityFlags)
+				s.readResponse()
+				s.write([]byte{0x05})
+			},
+			HANDSHAKE_READ_AUTH_RESULT, 0, true,
+		},
+		{
+			"old password auth switch",
+			func(s *testAuthServer) {
+				s.writeChallenge(AUTH_NATIVE_PASSWORD, testServerCapabilityFlags)
+				s.readResponse()
+				s.write([]byte{0xfe})
+			},
+			HANDSHAKE_READ_AUTH_RESULT, 0, true,
+		},
+		{
+			// 连接断开不是认证失败, 需要重连
+			"connection closed",
+			func(s *testAuthServer) {
+				s.writeChallenge(AUTH_NATIVE_PASSWORD, testServerCapabilityFlags)
+				s.readResponse()
+			},
+			HANDSHAKE_READ_AUTH_RESULT, 0, false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runTestHandshake(t, newTestAuthBinlogServer(), tt.serve)
+			if err == nil {
+				t.Fatalf("expect handshake error")
+			}
+			if isPermanentError(err) != tt.permanent || errors.Is(err, protocol.ErrAuthFailed) != tt.permanent {
+				t.Errorf("expect permanent %v, got %v", tt.permanent, err)
+			}
+			var authErr *AuthError
+			if !errors.As(err, &authErr) {
+				if tt.permanent {
+					t.Errorf("expect AuthError, got %v", err)
+				}
+				return
+			}
+			if authErr.State != tt.state || authErr.ErrCode != tt.errCode {
+				t.Errorf("expect state %d, error code %d, got %v", tt.state, tt.errCode, authErr)
+			}
+		})
+	}
+}
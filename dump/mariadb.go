@@ -0,0 +1,67 @@
+package dump
+
+import (
+	"fmt"
+	"github.com/goMySQLSemiSync/constants"
+	"github.com/goMySQLSemiSync/packet"
+	"github.com/goMySQLSemiSync/protocol"
+	"github.com/wonderivan/logger"
+)
+
+func isValidFlavor(flavor string) bool {
+	switch flavor {
+	case constants.FLAVOR_MYSQL, constants.FLAVOR_MARIADB:
+		return true
+	}
+	return false
+}
+
+func (b *BinlogServer) isMariadb() bool {
+	return b.flavor == constants.FLAVOR_MARIADB
+}
+
+/*
+* MariaDB 的 dump:
+* 通过 @mariadb_slave_capability 告知 master 本端支持 gtid, 否则 master 会把 MariaDB 特有的 event 替换为 QUERY_EVENT
+* gtid 模式下通过 @slave_connect_state 告知 master 每个 domain 最后一个 gtid, COM_BINLOG_DUMP 中的文件名和 pos 不再使用
+*/
+func (brs *BinlogReaderStream) dump_mariadb() error {
+	err := brs.execute_query(fmt.Sprintf("SET @mariadb_slave_capability = %d", constants.MARIA_SLAVE_CAPABILITY_GTID))
+	if err != nil {
+		return err
+	}
+
+	dump := packet.NewDumpPos()
+	dump.SetServerId(brs.binlogServer.serverId)
+	dump.SetFlags(constants.BINLOG_SEND_ANNOTATE_ROWS_EVENT)
+	if brs.auto_position {
+		gtid_set := brs.mariadbGtidSet
+		if gtid_set == nil {
+			gtid_set, err = protocol.ParseMariadbGtidSet(brs.binlogServer.gtid_purged)
+			if err != nil {
+				return fmt.Errorf("%w, %s", ErrInvalidConfig, err.Error())
+			}
+		}
+		logger.Info("dump mariadb binlog from gtid position ", gtid_set.String())
+		err = brs.execute_query(fmt.Sprintf("SET @slave_connect_state = '%s'", gtid_set.String()))
+		if err != nil {
+			return err
+		}
+		// 本端只保存 binlog, 不需要 master 检查 gtid 的顺序和重复
+		err = brs.execute_query("SET @slave_gtid_strict_mode = 0")
+		if err != nil {
+			return err
+		}
+		err = brs.execute_query("SET @slave_gtid_ignore_duplicates = 0")
+		if err != nil {
+			return err
+		}
+		dump.SetLogFile("")
+		dump.SetLogPos(4)
+	} else {
+		dump.SetLogFile(brs.currentLogFile)
+		dump.SetLogPos(brs.currentLogPos)
+	}
+	dump.SequenceId = 0
+	return brs.send_packet(dump.GetPayload())
+}
@@ -0,0 +1,256 @@
+package dump
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/goMySQLSemiSync/event"
+	"github.com/wonderivan/logger"
+	"regexp"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	DEFAULT_METADATA_TABLE = "binlog_event_metadata"
+	// 等待写入 MySQL 的事务个数上限, 超过时丢弃新的事务
+	METADATA_QUEUE_SIZE = 1024
+	// 单个事务缓存的 event 个数上限, 超过时丢弃之后的 event
+	METADATA_MAX_PENDING = 100000
+)
+
+var metadataTableRegexp = regexp.MustCompile("^[A-Za-z0-9_]+(\\.[A-Za-z0-9_]+)?$")
+
+func isValidMetadataTable(table string) bool {
+	return metadataTableRegexp.MatchString(table)
+}
+
+/*
+* 一个 binlog event 的元数据
+ */
+type EventMetadata struct {
+	LogFile   string // 本地 binlog 文件名
+	StartPos  int64  // event 在 binlog 文件中的起始 pos
+	EndPos    int64  // event 在 binlog 文件中的结束 pos, 即 header 中的 log_pos
+	Timestamp uint32 // event header 中的 timestamp
+	EventType int    // event 类型
+	Gtid      string // event 所属事务的 gtid
+	ServerId  uint32 // 产生 event 的 server_id
+}
+
+/*
+* 将每个 event 的元数据写入 MySQL 表, 方便查询某个 gtid 在哪个 binlog 文件的哪个位置
+* 同一个事务的 event 先缓存, 在事务边界放入有界队列, 由后台 goroutine 写入, 不阻塞 binlog dump
+* 队列满或 MySQL 不可用时丢弃元数据并计数, 元数据不保证完整
+ */
+type MetadataSink struct {
+	db         *sql.DB
+	table      string
+	clusterTag string
+	gtid       string // 当前事务的 gtid
+	pending    []*EventMetadata
+	truncated  bool                  // 当前事务的 event 超过 METADATA_MAX_PENDING
+	batches    chan []*EventMetadata // 等待写入的事务
+	writeBatch func([]*EventMetadata) error
+	dropped    uint64 // 丢弃的 event 个数, 原子操作
+	done       chan struct{}
+	closed     bool // Close 之后不再接收新的事务
+	closeOnce  sync.Once
+	closeErr   error
+}
+
+func NewMetadataSink(dsn string, table string, clusterTag string) (*MetadataSink, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	sink := newMetadataSink(METADATA_QUEUE_SIZE)
+	sink.db = db
+	sink.table = table
+	sink.clusterTag = clusterTag
+	sink.writeBatch = sink.insertBatch
+	err = sink.createTable()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	go sink.run()
+	return sink, nil
+}
+
+func newMetadataSink(queueSize int) *MetadataSink {
+	return &MetadataSink{
+		db:         nil,
+		table:      "",
+		clusterTag: "",
+		gtid:       "",
+		pending:    make([]*EventMetadata, 0),
+		truncated:  false,
+		batches:    make(chan []*EventMetadata, queueSize),
+		writeBatch: nil,
+		dropped:    0,
+		done:       make(chan struct{}),
+		closed:     false,
+		closeOnce:  sync.Once{},
+		closeErr:   nil,
+	}
+}
+
+func (s *MetadataSink) createTable() error {
+	_, err := s.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  id bigint unsigned NOT NULL AUTO_INCREMENT,
+  cluster_tag varchar(64) NOT NULL,
+  log_file varchar(255) NOT NULL,
+  start_pos bigint unsigned NOT NULL,
+  end_pos bigint unsigned NOT NULL,
+  event_time datetime NOT NULL,
+  event_type tinyint unsigned NOT NULL,
+  gtid varchar(128) NOT NULL DEFAULT '',
+  server_id int unsigned NOT NULL,
+  PRIMARY KEY (id),
+  KEY idx_gtid (gtid),
+  KEY idx_log_file_pos (cluster_tag, log_file, end_pos)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`, s.table))
+	return err
+}
+
+/*
+* 缓存一个 event 的元数据
+ */
+func (s *MetadataSink) Add(logFile string, ev event.Event) {
+	header := ev.GetHeader()
+	if gtidEvent, ok := ev.(*event.GtidEvent); ok {
+		s.gtid = gtidEvent.GetGtid()
+	}
+	if mariadbGtidEvent, ok := ev.(*event.MariadbGtidEvent); ok {
+		s.gtid = mariadbGtidEvent.GetGtid()
+	}
+
+	if len(s.pending) >= METADATA_MAX_PENDING {
+		if !s.truncated {
+			logger.Warn("too many events in one transaction, drop event metadata after ", METADATA_MAX_PENDING, " events, gtid: ", s.gtid)
+			s.truncated = true
+		}
+		atomic.AddUint64(&s.dropped, 1)
+		return
+	}
+
+	logPos := int64(header.LogPos)
+	startPos := logPos - int64(header.EventSize)
+	if logPos == 0 {
+		startPos = 0
+	}
+	s.pending = append(s.pending, &EventMetadata{
+		LogFile:   logFile,
+		StartPos:  startPos,
+		EndPos:    logPos,
+		Timestamp: header.Timestamp,
+		EventType: header.EventType,
+		Gtid:      s.gtid,
+		ServerId:  header.ServerId,
+	})
+}
+
+/*
+* 在事务边界把缓存的元数据放入写入队列, 不等待写入 MySQL
+* 队列满时丢弃该事务的元数据并返回错误
+ */
+func (s *MetadataSink) Flush() error {
+	batch := s.pending
+	s.pending = make([]*EventMetadata, 0)
+	s.gtid = ""
+	s.truncated = false
+	if len(batch) == 0 {
+		return nil
+	}
+	if s.closed {
+		dropped := atomic.AddUint64(&s.dropped, uint64(len(batch)))
+		return fmt.Errorf("metadata sink is closed, drop %d events, %d events dropped in total", len(batch), dropped)
+	}
+
+	select {
+	case s.batches <- batch:
+		return nil
+	default:
+		dropped := atomic.AddUint64(&s.dropped, uint64(len(batch)))
+		return fmt.Errorf("metadata queue is full, drop %d events, %d events dropped in total", len(batch), dropped)
+	}
+}
+
+/*
+* 丢弃未放入队列的元数据, 重连回滚时使用, 这些 event 会被 master 重新发送
+ */
+func (s *MetadataSink) Discard() {
+	s.pending = s.pending[:0]
+	s.gtid = ""
+	s.truncated = false
+}
+
+/*
+* 丢弃的 event 个数, 包括队列满, 事务过大和写入 MySQL 失败
+ */
+func (s *MetadataSink) GetDropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+/*
+* 后台写入队列中的事务, 直到 Close 关闭队列
+ */
+func (s *MetadataSink) run() {
+	defer close(s.done)
+	for batch := range s.batches {
+		err := s.writeBatch(batch)
+		if err != nil {
+			dropped := atomic.AddUint64(&s.dropped, uint64(len(batch)))
+			logger.Error("save event metadata into mysql error, drop ", len(batch), " events, ", dropped, " events dropped in total, err: ", err.Error())
+		}
+	}
+}
+
+/*
+* 一个事务的元数据一次写入
+ */
+func (s *MetadataSink) insertBatch(batch []*EventMetadata) error {
+	var query bytes.Buffer
+	query.WriteString(fmt.Sprintf("INSERT INTO %s (cluster_tag, log_file, start_pos, end_pos, event_time, event_type, gtid, server_id) VALUES ", s.table))
+	args := make([]interface{}, 0, len(batch)*8)
+	for i, m := range batch {
+		if i > 0 {
+			query.WriteString(",")
+		}
+		query.WriteString("(?, ?, ?, ?, FROM_UNIXTIME(?), ?, ?, ?)")
+		args = append(args, s.clusterTag, m.LogFile, m.StartPos, m.EndPos, m.Timestamp, m.EventType, m.Gtid, m.ServerId)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(query.String(), args...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+/*
+* 等待队列中的元数据写入后关闭连接, 可以重复调用
+ */
+func (s *MetadataSink) Close() error {
+	s.closeOnce.Do(func() {
+		s.closed = true
+		close(s.batches)
+		<-s.done
+		if s.db != nil {
+			s.closeErr = s.db.Close()
+		}
+	})
+	return s.closeErr
+}
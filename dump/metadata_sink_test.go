@@ -0,0 +1,198 @@
+package dump
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/goMySQLSemiSync/constants"
+	"github.com/goMySQLSemiSync/event"
+)
+
+type testMetadataWriter struct {
+	mu      sync.Mutex
+	batches [][]*EventMetadata
+	started chan struct{} // writer 开始写入时通知
+	block   chan struct{} // 关闭之前 writer 阻塞
+}
+
+func (this *testMetadataWriter) write(batch []*EventMetadata) error {
+	if this.started != nil {
+		this.started <- struct{}{}
+	}
+	if this.block != nil {
+		<-this.block
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.batches = append(this.batches, batch)
+	return nil
+}
+
+func newTestMetadataSink(queueSize int, writer *testMetadataWriter) *MetadataSink {
+	sink := newMetadataSink(queueSize)
+	sink.writeBatch = writer.write
+	go sink.run()
+	return sink
+}
+
+func newTestMetadataEvent(eventType int, logPos uint32, eventSize uint32) event.Event {
+	header := event.NewEventHeader()
+	header.EventType = eventType
+	header.LogPos = logPos
+	header.EventSize = eventSize
+	header.ServerId = 1
+	ev := event.NewUnknownEvent()
+	ev.SetData(header, nil)
+	return ev
+}
+
+func newTestGtidEvent(t *testing.T, logPos uint32) event.Event {
+	// commit flag(1) + sid(16) + gno(8)
+	body := append([]byte{1}, bytes.Repeat([]byte{0x11}, 16)...)
+	body = append(body, 5, 0, 0, 0, 0, 0, 0, 0)
+	ev := event.NewGtidEvent()
+	if err := ev.Decode(nil, body); err != nil {
+		t.Fatalf("decode gtid event error: %s", err.Error())
+	}
+	header := event.NewEventHeader()
+	header.EventType = constants.GTID_LOG_EVENT
+	header.LogPos = logPos
+	header.EventSize = 65
+	ev.SetData(header, nil)
+	return ev
+}
+
+func TestMetadataSinkBatchesTransaction(t *testing.T) {
+	writer := &testMetadataWriter{}
+	sink := newTestMetadataSink(4, writer)
+
+	sink.Add("mysql-bin.000001", newTestGtidEvent(t, 219))
+	sink.Add("mysql-bin.000001", newTestMetadataEvent(constants.QUERY_EVENT, 300, 81))
+	sink.Add("mysql-bin.000001", newTestMetadataEvent(constants.XID_EVENT, 331, 31))
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("flush error: %s", err.Error())
+	}
+	// 空事务不产生写入
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("flush error: %s", err.Error())
+	}
+	sink.Add("mysql-bin.000001", newTestMetadataEvent(constants.QUERY_EVENT, 400, 69))
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("flush error: %s", err.Error())
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("close error: %s", err.Error())
+	}
+
+	if len(writer.batches) != 2 {
+		t.Fatalf("expect 2 batches, got %d", len(writer.batches))
+	}
+	first := writer.batches[0]
+	if len(first) != 3 {
+		t.Fatalf("expect 3 events in first batch, got %d", len(first))
+	}
+	gtid := first[0].Gtid
+	if gtid == "" {
+		t.Fatalf("expect gtid in first batch")
+	}
+	for i, m := range first {
+		if m.Gtid != gtid {
+			t.Errorf("event %d: expect gtid %s, got %s", i, gtid, m.Gtid)
+		}
+	}
+	if first[1].StartPos != 219 || first[1].EndPos != 300 {
+		t.Errorf("expect pos [219, 300), got [%d, %d)", first[1].StartPos, first[1].EndPos)
+	}
+	// gtid 在事务边界重置
+	second := writer.batches[1]
+	if len(second) != 1 || second[0].Gtid != "" {
+		t.Errorf("expect 1 event without gtid in second batch, got %+v", second)
+	}
+	if sink.GetDropped() != 0 {
+		t.Errorf("expect 0 dropped, got %d", sink.GetDropped())
+	}
+}
+
+func TestMetadataSinkDiscardOnRollback(t *testing.T) {
+	writer := &testMetadataWriter{}
+	sink := newTestMetadataSink(4, writer)
+
+	sink.Add("mysql-bin.000001", newTestGtidEvent(t, 219))
+	sink.Add("mysql-bin.000001", newTestMetadataEvent(constants.QUERY_EVENT, 300, 81))
+	sink.Discard()
+	// 回滚后 master 重新发送的事务
+	sink.Add("mysql-bin.000001", newTestMetadataEvent(constants.QUERY_EVENT, 300, 81))
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("flush error: %s", err.Error())
+	}
+	sink.Close()
+
+	if len(writer.batches) != 1 {
+		t.Fatalf("expect 1 batch, got %d", len(writer.batches))
+	}
+	batch := writer.batches[0]
+	if len(batch) != 1 {
+		t.Fatalf("expect 1 event after discard, got %d", len(batch))
+	}
+	if batch[0].Gtid != "" {
+		t.Errorf("expect gtid reset by discard, got %s", batch[0].Gtid)
+	}
+}
+
+func TestMetadataSinkDropWhenQueueFull(t *testing.T) {
+	writer := &testMetadataWriter{started: make(chan struct{}, 3), block: make(chan struct{})}
+	sink := newTestMetadataSink(1, writer)
+
+	// 第一个事务被 writer 取出后阻塞, 第二个事务占满队列, 第三个事务被丢弃
+	sink.Add("mysql-bin.000001", newTestMetadataEvent(constants.QUERY_EVENT, 300, 81))
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("flush error: %s", err.Error())
+	}
+	<-writer.started
+	sink.Add("mysql-bin.000001", newTestMetadataEvent(constants.QUERY_EVENT, 400, 100))
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("flush error: %s", err.Error())
+	}
+	sink.Add("mysql-bin.000001", newTestMetadataEvent(constants.QUERY_EVENT, 500, 100))
+	sink.Add("mysql-bin.000001", newTestMetadataEvent(constants.XID_EVENT, 531, 31))
+	if err := sink.Flush(); err == nil {
+		t.Fatalf("expect error when queue is full")
+	}
+	if sink.GetDropped() != 2 {
+		t.Errorf("expect 2 dropped, got %d", sink.GetDropped())
+	}
+
+	close(writer.block)
+	sink.Close()
+	if len(writer.batches) != 2 {
+		t.Errorf("expect 2 batches written, got %d", len(writer.batches))
+	}
+}
+
+func TestMetadataSinkCloseTwice(t *testing.T) {
+	writer := &testMetadataWriter{}
+	sink := newTestMetadataSink(4, writer)
+
+	sink.Add("mysql-bin.000001", newTestMetadataEvent(constants.QUERY_EVENT, 300, 81))
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("flush error: %s", err.Error())
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("close error: %s", err.Error())
+	}
+	// 再次 Run 时会重复 Close, 关闭后的事务直接丢弃
+	if err := sink.Close(); err != nil {
+		t.Fatalf("close twice error: %s", err.Error())
+	}
+	sink.Add("mysql-bin.000001", newTestMetadataEvent(constants.QUERY_EVENT, 400, 100))
+	if err := sink.Flush(); err == nil {
+		t.Errorf("expect error when flush after close")
+	}
+	if len(writer.batches) != 1 {
+		t.Errorf("expect 1 batch written, got %d", len(writer.batches))
+	}
+	if sink.GetDropped() != 1 {
+		t.Errorf("expect 1 dropped, got %d", sink.GetDropped())
+	}
+}
@@ -0,0 +1,153 @@
+package dump
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/goMySQLSemiSync/protocol"
+	"github.com/wonderivan/logger"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+)
+
+const (
+	RECONNECT_MIN_BACKOFF = 1 * time.Second
+	RECONNECT_MAX_BACKOFF = 60 * time.Second
+)
+
+var backoffRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+/*
+* 第 attempt 次重连前的等待时间: 指数退避, 上限 RECONNECT_MAX_BACKOFF, 在 [d/2, d) 之间随机抖动
+*/
+func reconnectBackoff(attempt int) time.Duration {
+	d := RECONNECT_MIN_BACKOFF
+	for i := 1; i < attempt && d < RECONNECT_MAX_BACKOFF; i++ {
+		d *= 2
+	}
+	if d > RECONNECT_MAX_BACKOFF {
+		d = RECONNECT_MAX_BACKOFF
+	}
+	half := d / 2
+	return half + time.Duration(backoffRand.Int63n(int64(half)))
+}
+
+/*
+* 重连不能恢复的错误: 认证失败, 配置错误, master 无法提供请求的 binlog, 关键 event 无法解码
+*/
+func isPermanentError(err error) bool {
+	if errors.Is(err, protocol.ErrAuthFailed) || errors.Is(err, ErrInvalidConfig) || errors.Is(err, ErrDecode) {
+		return true
+	}
+	var mysqlErr *protocol.Err
+	if errors.As(err, &mysqlErr) && mysqlErr.GetErrCode() == protocol.ER_MASTER_FATAL_ERROR_READING_BINLOG {
+		return true
+	}
+	return false
+}
+
+/*
+* 记录完整事务边界: 之前的 gtid 已经完整写入本地文件, 断线后从这里继续 dump
+*/
+func (this *BinlogDumper) markSafePoint(fw *os.File) error {
+	if this.pendingGtid != "" && this.binlogServer.isMariadb() {
+		gtid, err := protocol.ParseMariadbGtid(this.pendingGtid)
+		if err != nil {
+			return err
+		}
+		this.executedMariadbGtidSet.Update(gtid)
+		this.pendingGtid = ""
+	} else if this.pendingGtid != "" {
+		gtidSet, err := protocol.ParseGtidSet(this.pendingGtid)
+		if err != nil {
+			return fmt.Errorf("%w, %s", protocol.ErrProtocolViolation, err.Error())
+		}
+		this.executedGtidSet = this.executedGtidSet.Union(gtidSet)
+		this.pendingGtid = ""
+	}
+
+	offset, err := fw.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("%w, get binlog file offset error, err: %s", ErrDiskFailure, err.Error())
+	}
+	this.safeLogPos = this.currentLogPos
+	this.safeFileOffset = offset
+	this.flushMetadata()
+	return nil
+}
+
+/*
+* 丢弃本地文件中最后一个完整事务边界之后的数据, 重连后由 master 重新发送
+*/
+func (this *BinlogDumper) rollbackToSafePoint(fw *os.File) error {
+	err := fw.Truncate(this.safeFileOffset)
+	if err != nil {
+		return fmt.Errorf("%w, truncate binlog file %s error, err: %s", ErrDiskFailure, this.currentLogFile, err.Error())
+	}
+	logger.Info("rollback binlog file ", this.currentLogFile, " to offset ", this.safeFileOffset, ", log pos ", this.safeLogPos)
+	this.currentLogPos = this.safeLogPos
+	this.pendingGtid = ""
+	if this.metadataSink != nil {
+		this.metadataSink.Discard()
+	}
+	return nil
+}
+
+func (this *BinlogDumper) newBinlogReader() (*BinlogReaderStream, error) {
+	stream, err := NewBaseStream(this.binlogServer)
+	if err != nil {
+		return nil, err
+	}
+	binlogReader := newBinlogReaderStream(stream, this.currentLogFile, this.currentLogPos, this.binlogServer.gtid_mode)
+	binlogReader.SetGtidSet(this.executedGtidSet)
+	binlogReader.SetMariadbGtidSet(this.executedMariadbGtidSet)
+	err = binlogReader.Register_slave()
+	if err != nil {
+		binlogReader.Close()
+		return nil, err
+	}
+	return binlogReader, nil
+}
+
+/*
+* 连接 master 并注册为 slave, attempt > 0 表示断线重连
+* 重连时先回滚到最后一个完整事务边界, 再按 file/pos 或已写入的 gtid 集合继续 dump
+*/
+func (this *BinlogDumper) reconnect(ctx context.Context, fw *os.File, attempt int) (*BinlogReaderStream, error) {
+	if attempt > 0 {
+		err := this.rollbackToSafePoint(fw)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for {
+		if attempt > 0 {
+			if this.binlogServer.maxReconnectAttempts > 0 && attempt > this.binlogServer.maxReconnectAttempts {
+				return nil, fmt.Errorf("reconnect to master failed after %d attempts", this.binlogServer.maxReconnectAttempts)
+			}
+			backoff := reconnectBackoff(attempt)
+			logger.Info("reconnect to master after ", backoff, ", attempt: ", attempt)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		binlogReader, err := this.newBinlogReader()
+		if err == nil {
+			logger.Info("connected to master, currentLogFile: ", this.currentLogFile, ", currentLogPos: ", this.currentLogPos)
+			return binlogReader, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if isPermanentError(err) {
+			return nil, err
+		}
+		logger.Error("connect to master error, err: ", err.Error())
+		attempt++
+	}
+}
@@ -0,0 +1,41 @@
+package dump
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+func newTestMysqlErr(errCode int) *protocol.Err {
+	e := protocol.NewErr()
+	e.SetErrCode(errCode)
+	return e
+}
+
+func TestIsPermanentError(t *testing.T) {
+	cases := []struct {
+		name      string
+		err       error
+		permanent bool
+	}{
+		{"auth error", &AuthError{PluginName: AUTH_NATIVE_PASSWORD, ErrCode: 1045, Message: "Access denied"}, true},
+		{"wrapped auth failed", fmt.Errorf("connect error, err: %w", protocol.ErrAuthFailed), true},
+		{"invalid config", fmt.Errorf("%w, gtid_purged is invalid", ErrInvalidConfig), true},
+		{"purged binlog", newTestMysqlErr(protocol.ER_MASTER_FATAL_ERROR_READING_BINLOG), true},
+		{"wrapped purged binlog", fmt.Errorf("register slave error, err: %w", newTestMysqlErr(protocol.ER_MASTER_FATAL_ERROR_READING_BINLOG)), true},
+		{"essential event decode error", fmt.Errorf("%w, event type: 15, log_pos: 0, err: truncated", ErrDecode), true},
+		{"other server error", newTestMysqlErr(1040), false},
+		{"network error", fmt.Errorf("read packet header from mysql error, err: %s", io.EOF.Error()), false},
+		{"protocol violation", fmt.Errorf("%w, packets out of order", protocol.ErrProtocolViolation), false},
+		{"disk failure", fmt.Errorf("%w, write error", ErrDiskFailure), false},
+		{"plain error", errors.New("connection refused"), false},
+	}
+	for _, c := range cases {
+		if isPermanentError(c.err) != c.permanent {
+			t.Errorf("%s: expect permanent %v for %v", c.name, c.permanent, c.err)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package dump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/goMySQLSemiSync/constants"
+	"github.com/goMySQLSemiSync/event"
+	"github.com/goMySQLSemiSync/protocol"
+	"github.com/wonderivan/logger"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// binlog 文件开头的 magic: fe 'b' 'i' 'n'
+	BINLOG_FILE_HEADER_LENGTH = 4
+)
+
+/*
+* 扫描本地 binlog 文件的结果
+* 进程异常退出时文件末尾可能有写了一半的 event, 或者只写了一部分 event 的事务, 重启时从最后一个完整事务边界继续
+*/
+type binlogFileScan struct {
+	fileSize        int64
+	safeFileOffset  int64                   // 最后一个完整事务边界在文件中的 offset
+	safeLogPos      int64                   // 最后一个完整事务边界在 master binlog 中的 pos
+	previousGtidSet *protocol.GtidSet       // 文件开头的 PREVIOUS_GTIDS_LOG_EVENT, 没有时为 nil
+	gtids           []string                // safeFileOffset 之前完整写入的事务的 gtid
+	mariadbGtidList []*protocol.MariadbGtid // MariaDB 文件开头的 GTID_LIST_EVENT, 没有时为 nil
+	mariadbGtids    []*protocol.MariadbGtid // MariaDB safeFileOffset 之前完整写入的事务的 gtid
+}
+
+func newBinlogFileScan() *binlogFileScan {
+	return &binlogFileScan{
+		fileSize:        0,
+		safeFileOffset:  BINLOG_FILE_HEADER_LENGTH,
+		safeLogPos:      BINLOG_FILE_HEADER_LENGTH,
+		previousGtidSet: nil,
+		gtids:           make([]string, 0),
+		mariadbGtidList: nil,
+		mariadbGtids:    make([]*protocol.MariadbGtid, 0),
+	}
+}
+
+/*
+* 需要解码的 event: 决定之后 event 的格式, 事务边界和 gtid
+*/
+func isResumeEvent(eventType int) bool {
+	switch eventType {
+	case constants.FORMAT_DESCRIPTION_EVENT, constants.QUERY_EVENT, constants.GTID_LOG_EVENT, constants.PREVIOUS_GTIDS_LOG_EVENT,
+		constants.MARIADB_GTID_EVENT, constants.MARIADB_GTID_LIST_EVENT:
+		return true
+	}
+	return false
+}
+
+/*
+* 按 event header 中的长度依次读取本地 binlog 文件, 记录完整事务边界, 与 Run 中 markSafePoint 的规则相同:
+* 新事务的 gtid event 之前, XID_EVENT, TRANSACTION_PAYLOAD_EVENT 和 COMMIT 之后
+* 事务之外的 FORMAT_DESCRIPTION_EVENT, PREVIOUS_GTIDS_LOG_EVENT 等文件开头的 event 和 ROTATE_EVENT 之后也是边界
+* 长度超出文件或无法解码的 event 及其之后的数据都不算写入完整
+*/
+func scanBinlogFile(filename string) (*binlogFileScan, error) {
+	scan := newBinlogFileScan()
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%w, open binlog file %s error, err: %s", ErrDiskFailure, filename, err.Error())
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("%w, stat binlog file %s error, err: %s", ErrDiskFailure, filename, err.Error())
+	}
+	scan.fileSize = info.Size()
+	if scan.fileSize < BINLOG_FILE_HEADER_LENGTH {
+		scan.safeFileOffset = 0
+		return scan, nil
+	}
+
+	reader := bufio.NewReaderSize(file, 1<<20)
+	_, err = reader.Discard(BINLOG_FILE_HEADER_LENGTH)
+	if err != nil {
+		return nil, fmt.Errorf("%w, read binlog file %s error, err: %s", ErrDiskFailure, filename, err.Error())
+	}
+	decoder := event.NewDecoder()
+	defer decoder.Close()
+
+	offset := int64(BINLOG_FILE_HEADER_LENGTH)
+	logPos := int64(BINLOG_FILE_HEADER_LENGTH)
+	pendingGtid := ""
+	var pendingMariadbGtid *protocol.MariadbGtid
+	inTransaction := false
+	markSafePoint := func(fileOffset int64, pos int64) {
+		if pendingGtid != "" {
+			scan.gtids = append(scan.gtids, pendingGtid)
+			pendingGtid = ""
+		}
+		if pendingMariadbGtid != nil {
+			scan.mariadbGtids = append(scan.mariadbGtids, pendingMariadbGtid)
+			pendingMariadbGtid = nil
+		}
+		scan.safeFileOffset = fileOffset
+		scan.safeLogPos = pos
+		inTransaction = false
+	}
+
+	for {
+		header := make([]byte, event.EVENT_HEADER_LENGTH)
+		_, err = io.ReadFull(reader, header)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w, read binlog file %s error, err: %s", ErrDiskFailure, filename, err.Error())
+		}
+		eventType := int(header[4])
+		eventSize := int64(binary.LittleEndian.Uint32(header[9:13]))
+		if eventSize < event.EVENT_HEADER_LENGTH || offset+eventSize > scan.fileSize {
+			logger.Warn("incomplete event in binlog file ", filename, ", offset: ", offset, ", event size: ", eventSize, ", file size: ", scan.fileSize)
+			break
+		}
+
+		var ev event.Event
+		if isResumeEvent(eventType) {
+			data := make([]byte, eventSize)
+			copy(data, header)
+			_, err = io.ReadFull(reader, data[event.EVENT_HEADER_LENGTH:])
+			if err != nil {
+				return nil, fmt.Errorf("%w, read binlog file %s error, err: %s", ErrDiskFailure, filename, err.Error())
+			}
+			ev, err = decoder.Decode(data)
+			if err != nil {
+				logger.Warn("decode event in binlog file ", filename, " error, offset: ", offset, ", err: ", err.Error())
+				break
+			}
+		} else {
+			_, err = io.CopyN(ioutil.Discard, reader, eventSize-event.EVENT_HEADER_LENGTH)
+			if err != nil {
+				return nil, fmt.Errorf("%w, read binlog file %s error, err: %s", ErrDiskFailure, filename, err.Error())
+			}
+		}
+
+		if eventType == constants.GTID_LOG_EVENT || eventType == constants.ANONYMOUS_GTID_LOG_EVENT || eventType == constants.MARIADB_GTID_EVENT {
+			markSafePoint(offset, logPos)
+			inTransaction = true
+		}
+		offset += eventSize
+		if nextPos := int64(binary.LittleEndian.Uint32(header[13:17])); nextPos != 0 {
+			logPos = nextPos
+		}
+
+		switch e := ev.(type) {
+		case *event.GtidEvent:
+			pendingGtid = e.GetGtid()
+		case *event.MariadbGtidEvent:
+			pendingMariadbGtid = e.GetMariadbGtid()
+		case *event.PreviousGtidsEvent:
+			scan.previousGtidSet = e.GetGtidSet()
+		case *event.MariadbGtidListEvent:
+			scan.mariadbGtidList = e.GetGtids()
+		case *event.QueryEvent:
+			if e.IsBegin() {
+				inTransaction = true
+			}
+			if e.IsCommit() {
+				markSafePoint(offset, logPos)
+			}
+		}
+		if eventType == constants.XID_EVENT || eventType == constants.TRANSACTION_PAYLOAD_EVENT || eventType == constants.ROTATE_EVENT {
+			markSafePoint(offset, logPos)
+		} else if !inTransaction {
+			markSafePoint(offset, logPos)
+		}
+	}
+	return scan, nil
+}
+
+/*
+* 读取 index 文件中的全部 binlog 文件名
+*/
+func (this *BinlogDumper) readBinlogIndex() ([]string, error) {
+	indexFile, err := os.OpenFile(this.getAbsoluteFileName(this.getIndexFile()), os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("%w, open binlog index file error, err: %s", ErrDiskFailure, err.Error())
+	}
+	defer indexFile.Close()
+	logFiles := make([]string, 0)
+	scanner := bufio.NewScanner(indexFile)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			logFiles = append(logFiles, line)
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("%w, read binlog index file error, err: %s", ErrDiskFailure, err.Error())
+	}
+	return logFiles, nil
+}
+
+/*
+* 从本地 binlog 文件恢复已完整写入的 gtid 集合, 重启后按 auto position 继续 dump 时不重复也不遗漏事务
+* 从最后一个文件向前扫描, 直到遇到 PREVIOUS_GTIDS_LOG_EVENT (MariaDB 为 GTID_LIST_EVENT), 它包含该文件之前的全部 gtid
+* 结果为配置中的 gtid_purged, PREVIOUS_GTIDS 和之后每个完整事务的 gtid 的并集
+*/
+func (this *BinlogDumper) restoreExecutedGtidSet() error {
+	logFiles, err := this.readBinlogIndex()
+	if err != nil {
+		return err
+	}
+	if len(logFiles) == 0 || logFiles[len(logFiles)-1] != this.lastLogFile {
+		logFiles = append(logFiles, this.lastLogFile)
+	}
+
+	isMariadb := this.binlogServer.isMariadb()
+	for i := len(logFiles) - 1; i >= 0; i-- {
+		filename := this.getAbsoluteFileName(logFiles[i])
+		_, err = os.Stat(filename)
+		if err != nil && os.IsNotExist(err) {
+			continue
+		}
+		scan, err := scanBinlogFile(filename)
+		if err != nil {
+			return err
+		}
+		if isMariadb {
+			for _, gtid := range scan.mariadbGtidList {
+				this.executedMariadbGtidSet.Update(gtid)
+			}
+			for _, gtid := range scan.mariadbGtids {
+				this.executedMariadbGtidSet.Update(gtid)
+			}
+			if scan.mariadbGtidList != nil {
+				break
+			}
+			continue
+		}
+
+		if scan.previousGtidSet != nil {
+			this.executedGtidSet = this.executedGtidSet.Union(scan.previousGtidSet)
+		}
+		for _, gtid := range scan.gtids {
+			gtidSet, err := protocol.ParseGtidSet(gtid)
+			if err != nil {
+				return fmt.Errorf("invalid gtid %s in binlog file %s, err: %s", gtid, filename, err.Error())
+			}
+			this.executedGtidSet = this.executedGtidSet.Union(gtidSet)
+		}
+		if scan.previousGtidSet != nil {
+			break
+		}
+	}
+	if isMariadb {
+		logger.Info("restore executed mariadb gtid set from local binlog files: ", this.executedMariadbGtidSet.String())
+	} else {
+		logger.Info("restore executed gtid set from local binlog files: ", this.executedGtidSet.String())
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package dump
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goMySQLSemiSync/constants"
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+const testResumeSid = "a8111585-297e-11eb-91d3-005056ae71c5"
+
+/*
+* 按 master 的 pos 依次追加 event 的本地 binlog 文件
+ */
+type testBinlogFile struct {
+	data []byte
+}
+
+func newTestBinlogFile() *testBinlogFile {
+	return &testBinlogFile{data: []byte{0xfe, 'b', 'i', 'n'}}
+}
+
+func (f *testBinlogFile) add(eventType int, body []byte) int64 {
+	header := make([]byte, 19)
+	binary.LittleEndian.PutUint32(header[0:4], 1700000000)
+	header[4] = byte(eventType)
+	binary.LittleEndian.PutUint32(header[5:9], 1)
+	binary.LittleEndian.PutUint32(header[9:13], uint32(19+len(body)))
+	binary.LittleEndian.PutUint32(header[13:17], uint32(len(f.data)+19+len(body)))
+	f.data = append(f.data, header...)
+	f.data = append(f.data, body...)
+	return int64(len(f.data))
+}
+
+func (f *testBinlogFile) addFormatDescription() int64 {
+	body := []byte{0x04, 0x00}
+	version := make([]byte, 50)
+	copy(version, "8.0.36")
+	body = append(body, version...)
+	body = append(body, 0x00, 0x00, 0x00, 0x00, 19)
+	body = append(body, 56, 13, 0, 8, 0, 0, 0, 0, 4, 0, 4, 0, 0, 0, 98, 0, 4, 26, 8, 0, 0, 0, 8, 8, 8, 2, 0,
+		0, 0, 10, 10, 10, 42, 42, 0, 18, 52, 0, 10, 40, 0)
+	// checksum 关闭时也有 checksum_alg 和 4 字节 checksum
+	body = append(body, byte(constants.BINLOG_CHECKSUM_ALG_OFF), 0, 0, 0, 0)
+	return f.add(constants.FORMAT_DESCRIPTION_EVENT, body)
+}
+
+func (f *testBinlogFile) addPreviousGtids(t *testing.T, gtidSet string) int64 {
+	encoded, err := parseTestResumeGtidSet(t, gtidSet).Encoded()
+	if err != nil {
+		t.Fatalf("encode gtid set error: %v", err)
+	}
+	return f.add(constants.PREVIOUS_GTIDS_LOG_EVENT, encoded)
+}
+
+func (f *testBinlogFile) addGtid(gno uint64) int64 {
+	sid, _ := hex.DecodeString(strings.Replace(testResumeSid, "-", "", -1))
+	body := append([]byte{1}, sid...)
+	body = append(body, make([]byte, 8)...)
+	binary.LittleEndian.PutUint64(body[17:25], gno)
+	return f.add(constants.GTID_LOG_EVENT, body)
+}
+
+func (f *testBinlogFile) addQuery(query string) int64 {
+	// thread id, exec time, schema 长度, error code, status vars 长度, schema
+	body := []byte{0x07, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00}
+	body = append(body, "test"...)
+	body = append(body, 0x00)
+	return f.add(constants.QUERY_EVENT, append(body, query...))
+}
+
+func (f *testBinlogFile) addTransaction(gno uint64) int64 {
+	f.addGtid(gno)
+	f.addQuery("BEGIN")
+	return f.add(constants.XID_EVENT, make([]byte, 8))
+}
+
+func parseTestResumeGtidSet(t *testing.T, s string) *protocol.GtidSet {
+	gtidSet, err := protocol.ParseGtidSet(s)
+	if err != nil {
+		t.Fatalf("parse gtid set %s error: %v", s, err)
+	}
+	return gtidSet
+}
+
+/*
+* 在 dir 中写入 binlog 文件和 index 文件后, 按重启的流程恢复 pos 和 gtid 集合
+ */
+func newTestResumeDumper(t *testing.T, dir string, files map[string][]byte, logFiles []string) *BinlogDumper {
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("write binlog file error: %v", err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "mysql-bin.index"), []byte(strings.Join(logFiles, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("write index file error: %v", err)
+	}
+	dumper := &BinlogDumper{
+		binlogServer: &BinlogServer{
+			binlogName: "mysql-bin",
+			binlogDir:  dir,
+			flavor:     constants.FLAVOR_MYSQL,
+			gtid_mode:  true,
+		},
+		executedGtidSet:        parseTestResumeGtidSet(t, testResumeSid+":1-3"),
+		executedMariadbGtidSet: protocol.NewMariadbGtidSet(),
+	}
+	if err := dumper.setLastLogFile(); err != nil {
+		t.Fatalf("set last log file error: %v", err)
+	}
+	if err := dumper.setLastLogPos(); err != nil {
+		t.Fatalf("set last log pos error: %v", err)
+	}
+	if err := dumper.restoreExecutedGtidSet(); err != nil {
+		t.Fatalf("restore executed gtid set error: %v", err)
+	}
+	return dumper
+}
+
+func TestResumeFromLastTransaction(t *testing.T) {
+	file := newTestBinlogFile()
+	file.addFormatDescription()
+	file.addPreviousGtids(t, testResumeSid+":1-10")
+	complete := file.addTransaction(11)
+	safeData := append([]byte(nil), file.data...)
+
+	// 写了一半的 event
+	partialEvent := newTestBinlogFile()
+	partialEvent.data = append([]byte(nil), safeData...)
+	partialEvent.addGtid(12)
+	partialEvent.addQuery("BEGIN")
+	partialEvent.add(constants.XID_EVENT, make([]byte, 8))
+	partialEvent.data = partialEvent.data[:len(partialEvent.data)-5]
+
+	// event 完整但事务不完整
+	partialTransaction := newTestBinlogFile()
+	partialTransaction.data = append([]byte(nil), safeData...)
+	partialTransaction.addGtid(12)
+	partialTransaction.addQuery("BEGIN")
+
+	// 最后一个 DDL 之后还没有收到下一个事务, 无法确认已经完整, 与 Run 中的事务边界相同
+	ddl := newTestBinlogFile()
+	ddl.data = append([]byte(nil), safeData...)
+	ddl.addGtid(12)
+	ddl.addQuery("CREATE TABLE t (id int)")
+
+	// event header 中的长度被破坏
+	corruptLength := append(append([]byte(nil), safeData...), make([]byte, 19)...)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"complete", safeData},
+		{"partial event", partialEvent.data},
+		{"partial transaction", partialTransaction.data},
+		{"trailing ddl", ddl.data},
+		{"corrupt length", corruptLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "resume")
+			if err != nil {
+				t.Fatalf("create temp dir error: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			dumper := newTestResumeDumper(t, dir, map[string][]byte{"mysql-bin.000001": tt.data}, []string{"mysql-bin.000001"})
+			if dumper.currentLogFile != "mysql-bin.000001" || dumper.currentLogPos != complete {
+				t.Errorf("expect resume from mysql-bin.000001:%d, got %s:%d", complete, dumper.currentLogFile, dumper.currentLogPos)
+			}
+			info, err := os.Stat(filepath.Join(dir, "mysql-bin.000001"))
+			if err != nil || info.Size() != int64(len(safeData)) {
+				t.Errorf("expect binlog file truncated to %d, got %v, err: %v", len(safeData), info.Size(), err)
+			}
+			if expect := testResumeSid + ":1-11"; dumper.executedGtidSet.String() != expect {
+				t.Errorf("expect executed gtid set %s, got %s", expect, dumper.executedGtidSet.String())
+			}
+		})
+	}
+}
+
+func TestResumeAfterRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resume")
+	if err != nil {
+		t.Fatalf("create temp dir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	first := newTestBinlogFile()
+	first.addFormatDescription()
+	first.addPreviousGtids(t, testResumeSid+":1-10")
+	first.addTransaction(11)
+	first.addGtid(12)
+	first.addQuery("CREATE TABLE t (id int)")
+	first.add(constants.ROTATE_EVENT, append([]byte{4, 0, 0, 0, 0, 0, 0, 0}, "mysql-bin.000002"...))
+	// 新文件只写入了 FORMAT_DESCRIPTION_EVENT, 还没有 PREVIOUS_GTIDS_LOG_EVENT
+	second := newTestBinlogFile()
+	fdeEnd := second.addFormatDescription()
+
+	files := map[string][]byte{"mysql-bin.000001": first.data, "mysql-bin.000002": second.data}
+	dumper := newTestResumeDumper(t, dir, files, []string{"mysql-bin.000001", "mysql-bin.000002"})
+	if dumper.currentLogFile != "mysql-bin.000002" || dumper.currentLogPos != fdeEnd {
+		t.Errorf("expect resume from mysql-bin.000002:%d, got %s:%d", fdeEnd, dumper.currentLogFile, dumper.currentLogPos)
+	}
+	// 前一个文件的 PREVIOUS_GTIDS 和其中的事务, 包括 ROTATE_EVENT 之前的 DDL
+	if expect := testResumeSid + ":1-12"; dumper.executedGtidSet.String() != expect {
+		t.Errorf("expect executed gtid set %s, got %s", expect, dumper.executedGtidSet.String())
+	}
+}
@@ -0,0 +1,106 @@
+package dump
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+const (
+	SSL_MODE_DISABLED        = "disabled"
+	SSL_MODE_REQUIRE         = "require"         // 加密, 不校验服务端证书
+	SSL_MODE_VERIFY_CA       = "verify-ca"       // 加密, 校验服务端证书由 CA 签发
+	SSL_MODE_VERIFY_IDENTITY = "verify-identity" // 加密, 校验 CA 且校验服务端证书中的主机名
+)
+
+func isValidSslMode(sslMode string) bool {
+	switch sslMode {
+	case "", SSL_MODE_DISABLED, SSL_MODE_REQUIRE, SSL_MODE_VERIFY_CA, SSL_MODE_VERIFY_IDENTITY:
+		return true
+	}
+	return false
+}
+
+func (b *BinlogServer) useTLS() bool {
+	return b.sslMode != "" && b.sslMode != SSL_MODE_DISABLED
+}
+
+/*
+* 按 ssl 配置生成 tls.Config
+ */
+func (b *BinlogServer) newTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if b.sslCert != "" || b.sslKey != "" {
+		cert, err := tls.LoadX509KeyPair(b.sslCert, b.sslKey)
+		if err != nil {
+			return nil, fmt.Errorf("load ssl client cert/key error, err: %s", err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	var rootCAs *x509.CertPool
+	if b.sslCa != "" {
+		caPem, err := ioutil.ReadFile(b.sslCa)
+		if err != nil {
+			return nil, fmt.Errorf("read ssl ca file error, err: %s", err.Error())
+		}
+		rootCAs = x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caPem) {
+			return nil, fmt.Errorf("no certificate found in ssl ca file %s", b.sslCa)
+		}
+	}
+
+	switch b.sslMode {
+	case SSL_MODE_REQUIRE:
+		tlsConfig.InsecureSkipVerify = true
+	case SSL_MODE_VERIFY_CA:
+		if rootCAs == nil {
+			return nil, fmt.Errorf("ssl mode %s requires sslCa", b.sslMode)
+		}
+		// 只校验证书链, 不校验主机名
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertChain(rawCerts, rootCAs)
+		}
+	case SSL_MODE_VERIFY_IDENTITY:
+		if rootCAs == nil {
+			return nil, fmt.Errorf("ssl mode %s requires sslCa", b.sslMode)
+		}
+		tlsConfig.RootCAs = rootCAs
+		tlsConfig.ServerName = b.sslServerName
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = b.host
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ssl mode %s", b.sslMode)
+	}
+	return tlsConfig, nil
+}
+
+func verifyCertChain(rawCerts [][]byte, rootCAs *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("no certificate from server")
+	}
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         rootCAs,
+		Intermediates: intermediates,
+	})
+	return err
+}
@@ -0,0 +1,249 @@
+package dump
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+/*
+* parent 为 nil 时生成自签名的 CA 证书, 否则生成 parent 签发的服务端证书
+ */
+func newTestCertificate(t *testing.T, name string, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	signer := template
+	signerKey := key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		template.DNSNames = []string{name}
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		signer = parent.cert
+		signerKey = parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("create certificate error: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate error: %v", err)
+	}
+	return &testCertificate{cert: cert, key: key, der: der}
+}
+
+func writeTestPem(t *testing.T, dir string, name string, blockType string, der []byte) string {
+	filename := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("write %s error: %v", name, err)
+	}
+	return filename
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatalf("create temp dir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCertificate(t, "test-ca", nil)
+	caFile := writeTestPem(t, dir, "ca.pem", "CERTIFICATE", ca.der)
+	keyDer, err := x509.MarshalECPrivateKey(ca.key)
+	if err != nil {
+		t.Fatalf("marshal key error: %v", err)
+	}
+	keyFile := writeTestPem(t, dir, "key.pem", "EC PRIVATE KEY", keyDer)
+	emptyFile := filepath.Join(dir, "empty.pem")
+	ioutil.WriteFile(emptyFile, []byte("no certificate"), 0600)
+
+	tests := []struct {
+		name       string
+		server     *BinlogServer
+		isErr      bool
+		skipVerify bool
+		serverName string
+	}{
+		{"require", &BinlogServer{sslMode: SSL_MODE_REQUIRE}, false, true, ""},
+		{"require with client cert", &BinlogServer{sslMode: SSL_MODE_REQUIRE, sslCert: caFile, sslKey: keyFile}, false, true, ""},
+		{"client cert without key", &BinlogServer{sslMode: SSL_MODE_REQUIRE, sslCert: caFile}, true, false, ""},
+		{"verify-ca", &BinlogServer{sslMode: SSL_MODE_VERIFY_CA, sslCa: caFile}, false, true, ""},
+		{"verify-ca without ca", &BinlogServer{sslMode: SSL_MODE_VERIFY_CA}, true, false, ""},
+		{"verify-ca missing ca file", &BinlogServer{sslMode: SSL_MODE_VERIFY_CA, sslCa: filepath.Join(dir, "missing.pem")}, true, false, ""},
+		{"verify-ca no certificate in ca file", &BinlogServer{sslMode: SSL_MODE_VERIFY_CA, sslCa: emptyFile}, true, false, ""},
+		{"verify-identity host", &BinlogServer{sslMode: SSL_MODE_VERIFY_IDENTITY, sslCa: caFile, host: "db1.test"}, false, false, "db1.test"},
+		{"verify-identity server name", &BinlogServer{sslMode: SSL_MODE_VERIFY_IDENTITY, sslCa: caFile, host: "10.0.0.1", sslServerName: "db1.test"}, false, false, "db1.test"},
+		{"verify-identity without ca", &BinlogServer{sslMode: SSL_MODE_VERIFY_IDENTITY, host: "db1.test"}, true, false, ""},
+		{"disabled", &BinlogServer{sslMode: SSL_MODE_DISABLED}, true, false, ""},
+		{"empty", &BinlogServer{sslMode: ""}, true, false, ""},
+		{"unknown", &BinlogServer{sslMode: "preferred"}, true, false, ""},
+	}
+	for _, tt := range tests {
+		tlsConfig, err := tt.server.newTLSConfig()
+		if (err != nil) != tt.isErr {
+			t.Errorf("%s: expect error %v, got %v", tt.name, tt.isErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if tlsConfig.MinVersion != tls.VersionTLS12 || tlsConfig.InsecureSkipVerify != tt.skipVerify || tlsConfig.ServerName != tt.serverName {
+			t.Errorf("%s: unexpected tls config, skip verify %v, server name %q", tt.name, tlsConfig.InsecureSkipVerify, tlsConfig.ServerName)
+		}
+		if (tt.server.sslMode == SSL_MODE_VERIFY_CA) != (tlsConfig.VerifyPeerCertificate != nil) {
+			t.Errorf("%s: only verify-ca verifies the chain by itself", tt.name)
+		}
+		if (tt.server.sslCert != "") != (len(tlsConfig.Certificates) == 1) {
+			t.Errorf("%s: expect client certificate %v", tt.name, tt.server.sslCert != "")
+		}
+	}
+
+	for _, sslMode := range []string{"", SSL_MODE_DISABLED, SSL_MODE_REQUIRE, SSL_MODE_VERIFY_CA, SSL_MODE_VERIFY_IDENTITY} {
+		if !isValidSslMode(sslMode) {
+			t.Errorf("expect ssl mode %q valid", sslMode)
+		}
+	}
+	if isValidSslMode("preferred") {
+		t.Errorf("expect ssl mode preferred invalid")
+	}
+}
+
+func TestVerifyCertChain(t *testing.T) {
+	ca := newTestCertificate(t, "test-ca", nil)
+	otherCa := newTestCertificate(t, "other-ca", nil)
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.cert)
+
+	tests := []struct {
+		name     string
+		rawCerts [][]byte
+		isErr    bool
+	}{
+		{"signed by ca", [][]byte{newTestCertificate(t, "db1.test", ca).der}, false},
+		{"signed by other ca", [][]byte{newTestCertificate(t, "db1.test", otherCa).der}, true},
+		{"no certificate", [][]byte{}, true},
+		{"invalid certificate", [][]byte{[]byte("invalid")}, true},
+	}
+	for _, tt := range tests {
+		if err := verifyCertChain(tt.rawCerts, rootCAs); (err != nil) != tt.isErr {
+			t.Errorf("%s: expect error %v, got %v", tt.name, tt.isErr, err)
+		}
+	}
+}
+
+func TestHandshakeTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatalf("create temp dir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCertificate(t, "test-ca", nil)
+	caFile := writeTestPem(t, dir, "ca.pem", "CERTIFICATE", ca.der)
+	serverCert := newTestCertificate(t, "db1.test", ca)
+	otherCa := newTestCertificate(t, "other-ca", nil)
+	otherCaFile := writeTestPem(t, dir, "other-ca.pem", "CERTIFICATE", otherCa.der)
+
+	tests := []struct {
+		name          string
+		sslMode       string
+		sslCa         string
+		sslServerName string
+		isErr         bool
+	}{
+		{"require", SSL_MODE_REQUIRE, "", "", false},
+		{"verify-ca", SSL_MODE_VERIFY_CA, caFile, "", false},
+		{"verify-ca other ca", SSL_MODE_VERIFY_CA, otherCaFile, "", true},
+		{"verify-identity", SSL_MODE_VERIFY_IDENTITY, caFile, "db1.test", false},
+		{"verify-identity wrong name", SSL_MODE_VERIFY_IDENTITY, caFile, "db2.test", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestAuthBinlogServer()
+			server.host = "127.0.0.1"
+			server.sslMode = tt.sslMode
+			server.sslCa = tt.sslCa
+			server.sslServerName = tt.sslServerName
+
+			var password []byte
+			h, err := runTestHandshake(t, server, func(s *testAuthServer) {
+				s.writeChallenge(AUTH_CACHING_SHA2_PASSWORD, testServerCapabilityFlags|protocol.CLIENT_SSL)
+				// SSLRequest 是 HandshakeResponse 的前 32 字节
+				sslRequest := s.read()
+				if len(sslRequest) != 32 || protocol.Get_fixed_int_sniplet(sslRequest[0:4])&protocol.CLIENT_SSL == 0 {
+					t.Errorf("unexpected ssl request % x", sslRequest)
+				}
+				if tt.isErr {
+					// 客户端校验证书失败后发送 alert 时服务端可能还在写, net.Pipe 没有缓冲, 超时后关闭连接
+					s.conn.SetDeadline(time.Now().Add(100 * time.Millisecond))
+				}
+				tlsConn := tls.Server(s.conn, &tls.Config{
+					Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.der}, PrivateKey: serverCert.key}},
+				})
+				if err := tlsConn.Handshake(); err != nil {
+					return
+				}
+				s.conn = tlsConn
+				s.readResponse()
+				// TLS 连接上的完整认证直接发送明文密码
+				s.write([]byte{byte(protocol.AUTH_MORE_DATA), CACHING_SHA2_PERFORM_FULL_AUTH})
+				password = s.read()
+				s.writeOK()
+			})
+			if tt.isErr {
+				var authErr *AuthError
+				if !errors.As(err, &authErr) || authErr.State != HANDSHAKE_SSL_REQUEST {
+					t.Errorf("expect tls handshake error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handshake error: %v", err)
+			}
+			if !h.stream.isSecure() || string(password) != "secret\x00" {
+				t.Errorf("expect plain password over tls, secure %v, got %q", h.stream.isSecure(), password)
+			}
+		})
+	}
+}
+
+func TestHandshakeServerWithoutSSL(t *testing.T) {
+	server := newTestAuthBinlogServer()
+	server.sslMode = SSL_MODE_REQUIRE
+	_, err := runTestHandshake(t, server, func(s *testAuthServer) {
+		s.writeChallenge(AUTH_NATIVE_PASSWORD, testServerCapabilityFlags)
+	})
+	var authErr *AuthError
+	if !errors.As(err, &authErr) || authErr.State != HANDSHAKE_SSL_REQUEST || !isPermanentError(err) {
+		t.Errorf("expect permanent ssl error, got %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package event
+
+import (
+	"fmt"
+	"github.com/goMySQLSemiSync/constants"
+	"github.com/klauspost/compress/zstd"
+	"github.com/wonderivan/logger"
+	"runtime/debug"
+	"sync"
+)
+
+const (
+	// 解压后的 TRANSACTION_PAYLOAD_EVENT 上限, 与 max_allowed_packet 的最大值相同
+	MAX_PAYLOAD_UNCOMPRESSED_SIZE = 1 << 30
+	// 按 header 中的解压后长度预分配内存时, 最多预分配压缩后长度的倍数, 其余由解压时按需扩容
+	PAYLOAD_PREALLOC_RATIO = 8
+)
+
+/*
+* 创建某种类型的空 event, 由 Decoder 填充
+ */
+type EventCreator func() Event
+
+var (
+	eventCreatorsMu sync.RWMutex
+	eventCreators   = make(map[int]EventCreator)
+)
+
+func init() {
+	RegisterEvent(constants.FORMAT_DESCRIPTION_EVENT, func() Event { return NewFormatDescriptionEvent() })
+	RegisterEvent(constants.QUERY_EVENT, func() Event { return NewQueryEvent() })
+	RegisterEvent(constants.XID_EVENT, func() Event { return NewXidEvent() })
+	RegisterEvent(constants.INTVAR_EVENT, func() Event { return NewIntvarEvent() })
+	RegisterEvent(constants.RAND_EVENT, func() Event { return NewRandEvent() })
+	RegisterEvent(constants.USER_VAR_EVENT, func() Event { return NewUserVarEvent() })
+	RegisterEvent(constants.ROWS_QUERY_LOG_EVENT, func() Event { return NewRowsQueryEvent() })
+	RegisterEvent(constants.TABLE_MAP_EVENT, func() Event { return NewTableMapEvent() })
+	for _, eventType := range []int{
+		constants.WRITE_ROWS_EVENT_V1, constants.UPDATE_ROWS_EVENT_V1, constants.DELETE_ROWS_EVENT_V1,
+		constants.WRITE_ROWS_EVENT, constants.UPDATE_ROWS_EVENT, constants.DELETE_ROWS_EVENT,
+		constants.PARTIAL_UPDATE_ROWS_EVENT,
+	} {
+		RegisterEvent(eventType, func() Event { return NewRowsEvent() })
+	}
+	RegisterEvent(constants.ROTATE_EVENT, func() Event { return NewRotateEvent() })
+	RegisterEvent(constants.GTID_LOG_EVENT, func() Event { return NewGtidEvent() })
+	RegisterEvent(constants.ANONYMOUS_GTID_LOG_EVENT, func() Event { return NewAnonymousGtidEvent() })
+	RegisterEvent(constants.PREVIOUS_GTIDS_LOG_EVENT, func() Event { return NewPreviousGtidsEvent() })
+	RegisterEvent(constants.TRANSACTION_PAYLOAD_EVENT, func() Event { return NewTransactionPayloadEvent() })
+	RegisterEvent(constants.MARIADB_GTID_EVENT, func() Event { return NewMariadbGtidEvent() })
+	RegisterEvent(constants.MARIADB_GTID_LIST_EVENT, func() Event { return NewMariadbGtidListEvent() })
+	RegisterEvent(constants.MARIADB_ANNOTATE_ROWS_EVENT, func() Event { return NewMariadbAnnotateRowsEvent() })
+	RegisterEvent(constants.MARIADB_BINLOG_CHECKPOINT_EVENT, func() Event { return NewMariadbBinlogCheckpointEvent() })
+}
+
+/*
+* 注册 event 解码器, 同类型的解码器会被覆盖
+ */
+func RegisterEvent(eventType int, creator EventCreator) {
+	eventCreatorsMu.Lock()
+	defer eventCreatorsMu.Unlock()
+	eventCreators[eventType] = creator
+}
+
+func newEvent(eventType int) Event {
+	eventCreatorsMu.RLock()
+	defer eventCreatorsMu.RUnlock()
+	creator, ok := eventCreators[eventType]
+	if !ok {
+		return NewUnknownEvent()
+	}
+	return creator()
+}
+
+/*
+* 把 binlog dump 收到的原始 event 解码为 Event
+* 解码 FORMAT_DESCRIPTION_EVENT 后, 同一个 binlog 文件中之后的 event 按照它的 header 长度, post-header 长度和 checksum 算法解码
+* 收到第一个 FORMAT_DESCRIPTION_EVENT 之前使用 v4 的默认格式, checksum 算法由 SetChecksumAlg 设置
+ */
+type Decoder struct {
+	format      *FormatDescriptionEvent
+	checksumAlg int
+	tableMaps   *TableMapCache
+	zstdDecoder *zstd.Decoder // 解压 TRANSACTION_PAYLOAD_EVENT, 第一次用到时创建
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		format:      NewFormatDescriptionEvent(),
+		checksumAlg: constants.BINLOG_CHECKSUM_ALG_UNDEF,
+		tableMaps:   NewTableMapCache(),
+		zstdDecoder: nil,
+	}
+}
+
+func (this *Decoder) GetTableMaps() *TableMapCache {
+	return this.tableMaps
+}
+
+func (this *Decoder) SetChecksumAlg(checksumAlg int) {
+	this.checksumAlg = checksumAlg
+}
+
+func (this *Decoder) GetChecksumAlg() int {
+	return this.checksumAlg
+}
+
+func (this *Decoder) GetFormatDescription() *FormatDescriptionEvent {
+	return this.format
+}
+
+/*
+* 释放 zstd 解压器, 可以重复调用, 之后再解码 TRANSACTION_PAYLOAD_EVENT 时重新创建
+ */
+func (this *Decoder) Close() {
+	if this.zstdDecoder != nil {
+		this.zstdDecoder.Close()
+		this.zstdDecoder = nil
+	}
+}
+
+func (this *Decoder) Decode(data []byte) (Event, error) {
+	return this.decode(data, this.checksumAlg)
+}
+
+func (this *Decoder) decode(data []byte, checksumAlg int) (ev Event, err error) {
+	header := NewEventHeader()
+	err = header.LoadFromPacket(data)
+	if err != nil {
+		return nil, err
+	}
+	// 各个 event 的 Decode 自己检查长度, 这里只兜底未检查到的越界, 记录堆栈以便定位解码器的问题
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("panic when decoding event, event type: ", header.EventType, ", log pos: ", header.LogPos, ", err: ", r, "\n", string(debug.Stack()))
+			ev = nil
+			err = fmt.Errorf("malformed event, event type: %d, log pos: %d, err: %v", header.EventType, header.LogPos, r)
+		}
+	}()
+
+	// FORMAT_DESCRIPTION_EVENT 的 header 固定为 19 字节, checksum_alg 和 checksum 由它自己解析
+	start := EVENT_HEADER_LENGTH
+	end := len(data)
+	if header.EventType != constants.FORMAT_DESCRIPTION_EVENT {
+		start = this.format.GetEventHeaderLength()
+		if checksumAlg == constants.BINLOG_CHECKSUM_ALG_CRC32 {
+			end -= constants.BINLOG_CHECKSUM_LEN
+		}
+	}
+	if end < start {
+		return nil, fmt.Errorf("event too short, event type: %d, length: %d", header.EventType, len(data))
+	}
+
+	ev = newEvent(header.EventType)
+	ev.SetData(header, data)
+	if consumer, ok := ev.(tableMapConsumer); ok {
+		consumer.setTableMaps(this.tableMaps)
+	}
+	err = ev.Decode(this.format, data[start:end])
+	if err != nil {
+		return nil, fmt.Errorf("decode event error, event type: %d, log pos: %d, err: %w", header.EventType, header.LogPos, err)
+	}
+
+	switch e := ev.(type) {
+	case *FormatDescriptionEvent:
+		this.format = e
+		this.checksumAlg = e.GetChecksumAlg()
+		this.tableMaps.Clear()
+	case *TableMapEvent:
+		this.tableMaps.Set(e)
+	case *RowsEvent:
+		// 语句结束后 table id 失效
+		if e.IsStmtEnd() {
+			this.tableMaps.Clear()
+		}
+	case *TransactionPayloadEvent:
+		e.events, err = this.decodePayload(e)
+		if err != nil {
+			return nil, fmt.Errorf("decode transaction payload error, log pos: %d, err: %w", header.LogPos, err)
+		}
+	}
+	return ev, nil
+}
+
+/*
+* 解压 TRANSACTION_PAYLOAD_EVENT 的 payload, 并依次解码其中的 event
+* payload 中的 event 没有 checksum, 与外层 event 共用 FORMAT_DESCRIPTION_EVENT 和 table map 缓存
+ */
+func (this *Decoder) decodePayload(payloadEvent *TransactionPayloadEvent) ([]Event, error) {
+	var data []byte
+	switch payloadEvent.GetCompressionType() {
+	case PAYLOAD_COMPRESSION_NONE:
+		data = payloadEvent.GetPayload()
+	case PAYLOAD_COMPRESSION_ZSTD:
+		if payloadEvent.GetUncompressedSize() > MAX_PAYLOAD_UNCOMPRESSED_SIZE {
+			return nil, fmt.Errorf("transaction payload too large, uncompressed size: %d", payloadEvent.GetUncompressedSize())
+		}
+		if this.zstdDecoder == nil {
+			// 同步解压, 不创建后台 goroutine, 并限制解压后的内存
+			zstdDecoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(MAX_PAYLOAD_UNCOMPRESSED_SIZE))
+			if err != nil {
+				return nil, err
+			}
+			this.zstdDecoder = zstdDecoder
+		}
+		// header 中的解压后长度不可信, 预分配的内存不超过压缩后长度的固定倍数
+		capacity := payloadEvent.GetUncompressedSize()
+		if limit := uint64(len(payloadEvent.GetPayload())) * PAYLOAD_PREALLOC_RATIO; capacity > limit {
+			capacity = limit
+		}
+		var err error
+		data, err = this.zstdDecoder.DecodeAll(payloadEvent.GetPayload(), make([]byte, 0, capacity))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown transaction payload compression type: %d", payloadEvent.GetCompressionType())
+	}
+	if payloadEvent.GetUncompressedSize() != 0 && uint64(len(data)) != payloadEvent.GetUncompressedSize() {
+		return nil, fmt.Errorf("transaction payload uncompressed size mismatch, expect: %d, actual: %d", payloadEvent.GetUncompressedSize(), len(data))
+	}
+
+	events := make([]Event, 0)
+	for pos := 0; pos < len(data); {
+		header := NewEventHeader()
+		err := header.LoadFromPacket(data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		eventSize := int(header.EventSize)
+		if eventSize < EVENT_HEADER_LENGTH || pos+eventSize > len(data) {
+			return nil, fmt.Errorf("malformed event in transaction payload, event type: %d, event size: %d", header.EventType, eventSize)
+		}
+		ev, err := this.decode(data[pos:pos+eventSize], constants.BINLOG_CHECKSUM_ALG_OFF)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+		pos += eventSize
+	}
+	return events, nil
+}
@@ -0,0 +1,125 @@
+package event
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// v4 event header 长度
+const EVENT_HEADER_LENGTH = 19
+
+/*
+* binlog event header (v4)
+* https://dev.mysql.com/doc/internals/en/binlog-event-header.html
+* 4              timestamp
+* 1              event type
+* 4              server-id
+* 4              event-size
+* 4              log pos, 下一个 event 在 binlog 文件中的位置
+* 2              flags
+ */
+type EventHeader struct {
+	Timestamp uint32
+	EventType int
+	ServerId  uint32
+	EventSize uint32
+	LogPos    uint32
+	Flags     uint16
+}
+
+func NewEventHeader() *EventHeader {
+	return &EventHeader{
+		Timestamp: 0,
+		EventType: 0,
+		ServerId:  0,
+		EventSize: 0,
+		LogPos:    0,
+		Flags:     0,
+	}
+}
+
+func (this *EventHeader) LoadFromPacket(data []byte) error {
+	if len(data) < EVENT_HEADER_LENGTH {
+		return fmt.Errorf("event header too short, length: %d", len(data))
+	}
+	this.Timestamp = binary.LittleEndian.Uint32(data[0:4])
+	this.EventType = int(data[4])
+	this.ServerId = binary.LittleEndian.Uint32(data[5:9])
+	this.EventSize = binary.LittleEndian.Uint32(data[9:13])
+	this.LogPos = binary.LittleEndian.Uint32(data[13:17])
+	this.Flags = binary.LittleEndian.Uint16(data[17:19])
+	return nil
+}
+
+/*
+* 解码后的 binlog event
+* GetData: 完整的 event, 包含 header 和 checksum, 用于原样写入本地 binlog 文件
+* Decode: 按当前 binlog 文件的 FORMAT_DESCRIPTION_EVENT 解析 event body, body 不包含 header 和 checksum
+ */
+type Event interface {
+	GetHeader() *EventHeader
+	GetData() []byte
+	SetData(header *EventHeader, data []byte)
+	Decode(format *FormatDescriptionEvent, body []byte) error
+}
+
+/*
+* 所有 event 的公共部分, 具体的 event 嵌入 *BaseEvent 后只需实现 Decode
+ */
+type BaseEvent struct {
+	header *EventHeader
+	data   []byte
+}
+
+func NewBaseEvent() *BaseEvent {
+	return &BaseEvent{
+		header: NewEventHeader(),
+		data:   nil,
+	}
+}
+
+func (this *BaseEvent) GetHeader() *EventHeader {
+	return this.header
+}
+
+func (this *BaseEvent) GetData() []byte {
+	return this.data
+}
+
+func (this *BaseEvent) SetData(header *EventHeader, data []byte) {
+	this.header = header
+	this.data = data
+}
+
+/*
+* 没有注册解码器的 event, 只保留 body
+ */
+type UnknownEvent struct {
+	*BaseEvent
+	body []byte
+}
+
+func NewUnknownEvent() *UnknownEvent {
+	return &UnknownEvent{
+		BaseEvent: NewBaseEvent(),
+		body:      nil,
+	}
+}
+
+/*
+* 不解码的原始 event, 用于解码失败但仍需写入本地 binlog 文件的 event
+ */
+func NewRawEvent(header *EventHeader, data []byte) *UnknownEvent {
+	ev := NewUnknownEvent()
+	ev.SetData(header, data)
+	return ev
+}
+
+func (this *UnknownEvent) GetBody() []byte {
+	return this.body
+}
+
+func (this *UnknownEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	this.body = body
+	return nil
+}
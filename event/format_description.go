@@ -0,0 +1,153 @@
+package event
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/goMySQLSemiSync/constants"
+	"github.com/goMySQLSemiSync/protocol"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FORMAT_DESCRIPTION_EVENT 中 server version 的固定长度
+	ST_SERVER_VER_LEN = 50
+	// 5.6.1 之后 FORMAT_DESCRIPTION_EVENT 最后是 checksum_alg(1) + checksum(4)
+	CHECKSUM_VERSION_SPLIT_MYSQL   = "5.6.1"
+	CHECKSUM_VERSION_SPLIT_MARIADB = "5.3.0"
+)
+
+/*
+* FORMAT_DESCRIPTION_EVENT
+* https://dev.mysql.com/doc/internals/en/format-description-event.html
+* 2              binlog-version
+* string[50]     mysql-server version
+* 4              create timestamp
+* 1              event header length
+* string[p]      event type header lengths, 第 i 个字节为类型 i+1 的 event 的 post-header 长度
+* 1              checksum_alg, 5.6.1 之后
+* 4              checksum, 5.6.1 之后, 不论 checksum 是否开启
+*
+* 同一个 binlog 文件中之后的 event 都按照它描述的格式解码
+ */
+type FormatDescriptionEvent struct {
+	*BaseEvent
+	binlogVersion          int
+	serverVersion          string
+	createTimestamp        uint32
+	eventHeaderLength      int
+	eventTypeHeaderLengths []byte
+	checksumAlg            int
+}
+
+func NewFormatDescriptionEvent() *FormatDescriptionEvent {
+	return &FormatDescriptionEvent{
+		BaseEvent:              NewBaseEvent(),
+		binlogVersion:          4,
+		serverVersion:          "",
+		createTimestamp:        0,
+		eventHeaderLength:      EVENT_HEADER_LENGTH,
+		eventTypeHeaderLengths: nil,
+		checksumAlg:            constants.BINLOG_CHECKSUM_ALG_UNDEF,
+	}
+}
+
+func (this *FormatDescriptionEvent) GetBinlogVersion() int {
+	return this.binlogVersion
+}
+
+func (this *FormatDescriptionEvent) GetServerVersion() string {
+	return this.serverVersion
+}
+
+func (this *FormatDescriptionEvent) GetCreateTimestamp() uint32 {
+	return this.createTimestamp
+}
+
+func (this *FormatDescriptionEvent) GetEventHeaderLength() int {
+	return this.eventHeaderLength
+}
+
+func (this *FormatDescriptionEvent) GetEventTypeHeaderLengths() []byte {
+	return this.eventTypeHeaderLengths
+}
+
+func (this *FormatDescriptionEvent) GetChecksumAlg() int {
+	return this.checksumAlg
+}
+
+/*
+* 获取 event 的 post-header 长度, FORMAT_DESCRIPTION_EVENT 中没有该类型时返回 defaultLength
+ */
+func (this *FormatDescriptionEvent) GetPostHeaderLength(eventType int, defaultLength int) int {
+	if eventType <= 0 || eventType > len(this.eventTypeHeaderLengths) {
+		return defaultLength
+	}
+	return int(this.eventTypeHeaderLengths[eventType-1])
+}
+
+/*
+* body 包含 checksum_alg 和 checksum, 由 Decoder 原样传入
+ */
+func (this *FormatDescriptionEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	if len(body) < 2+ST_SERVER_VER_LEN+4+1 {
+		return fmt.Errorf("format description event too short, length: %d", len(body))
+	}
+	proto := protocol.NewProto(body, 0)
+	this.binlogVersion = proto.Get_fixed_int(2)
+	serverVersion := proto.Read(ST_SERVER_VER_LEN)
+	if i := bytes.IndexByte(serverVersion, 0x00); i >= 0 {
+		serverVersion = serverVersion[:i]
+	}
+	this.serverVersion = string(serverVersion)
+	this.createTimestamp = uint32(proto.Get_fixed_int(4))
+	this.eventHeaderLength = proto.Get_fixed_int(1)
+	if this.eventHeaderLength < EVENT_HEADER_LENGTH {
+		return fmt.Errorf("invalid event header length %d", this.eventHeaderLength)
+	}
+
+	pos := proto.GetOffset()
+	if hasChecksumAlg(this.serverVersion) {
+		end := len(body) - 1 - constants.BINLOG_CHECKSUM_LEN
+		if end < pos {
+			return fmt.Errorf("format description event too short for checksum, length: %d", len(body))
+		}
+		this.checksumAlg = int(body[end])
+		this.eventTypeHeaderLengths = body[pos:end]
+	} else {
+		this.checksumAlg = constants.BINLOG_CHECKSUM_ALG_UNDEF
+		this.eventTypeHeaderLengths = body[pos:]
+	}
+	return nil
+}
+
+func hasChecksumAlg(serverVersion string) bool {
+	split := CHECKSUM_VERSION_SPLIT_MYSQL
+	if strings.Contains(strings.ToLower(serverVersion), "mariadb") {
+		split = CHECKSUM_VERSION_SPLIT_MARIADB
+	}
+	return versionProduct(serverVersion) >= versionProduct(split)
+}
+
+/*
+* 5.7.30-log => 5*256*256 + 7*256 + 30
+ */
+func versionProduct(version string) int {
+	product := 0
+	parts := strings.SplitN(version, ".", 3)
+	for i := 0; i < 3; i++ {
+		n := 0
+		if i < len(parts) {
+			digits := parts[i]
+			for j, c := range digits {
+				if c < '0' || c > '9' {
+					digits = digits[:j]
+					break
+				}
+			}
+			n, _ = strconv.Atoi(digits)
+		}
+		product = product*256 + n
+	}
+	return product
+}
@@ -0,0 +1,126 @@
+package event
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/goMySQLSemiSync/constants"
+)
+
+// 各版本 FORMAT_DESCRIPTION_EVENT 中的 post-header 长度, 第 i 个字节为类型 i+1
+var (
+	testPostHeaderLengths55 = []byte{
+		56, 13, 0, 8, 0, 18, 0, 4, 4, 4, 4, 18, 0, 0, 84, 0, 4, 26, 8, 0, 0, 0, 8, 8, 8, 2, 0,
+	}
+	testPostHeaderLengths56 = []byte{
+		56, 13, 0, 8, 0, 18, 0, 4, 4, 4, 4, 18, 0, 0, 92, 0, 4, 26, 8, 0, 0, 0, 8, 8, 8, 2, 0,
+		0, 0, 10, 10, 10, 25, 25, 0,
+	}
+	testPostHeaderLengths80 = []byte{
+		56, 13, 0, 8, 0, 0, 0, 0, 4, 0, 4, 0, 0, 0, 98, 0, 4, 26, 8, 0, 0, 0, 8, 8, 8, 2, 0,
+		0, 0, 10, 10, 10, 42, 42, 0, 18, 52, 0, 10, 40, 0,
+	}
+)
+
+/*
+* withChecksum 为 true 时追加 checksum_alg 和 4 字节 checksum
+ */
+func buildTestFormatDescriptionBody(serverVersion string, postHeaderLengths []byte, withChecksum bool, checksumAlg int) []byte {
+	body := []byte{0x04, 0x00}
+	version := make([]byte, ST_SERVER_VER_LEN)
+	copy(version, serverVersion)
+	body = append(body, version...)
+	body = append(body, 0x00, 0x00, 0x00, 0x00, EVENT_HEADER_LENGTH)
+	body = append(body, postHeaderLengths...)
+	if withChecksum {
+		body = append(body, byte(checksumAlg), 0xde, 0xad, 0xbe, 0xef)
+	}
+	return body
+}
+
+func TestFormatDescriptionEventDecode(t *testing.T) {
+	tests := []struct {
+		name              string
+		serverVersion     string
+		postHeaderLengths []byte
+		withChecksum      bool
+		checksumAlg       int
+		expectChecksumAlg int
+		// event type => post-header 长度, -1 表示 FORMAT_DESCRIPTION_EVENT 中没有该类型
+		expectLengths map[int]int
+	}{
+		{"5.5 without checksum", "5.5.62-log", testPostHeaderLengths55, false, 0, constants.BINLOG_CHECKSUM_ALG_UNDEF,
+			map[int]int{constants.QUERY_EVENT: 13, constants.TABLE_MAP_EVENT: 8, constants.WRITE_ROWS_EVENT_V1: 8, constants.WRITE_ROWS_EVENT: -1, constants.GTID_LOG_EVENT: -1}},
+		{"5.6 checksum off", "5.6.51-log", testPostHeaderLengths56, true, constants.BINLOG_CHECKSUM_ALG_OFF, constants.BINLOG_CHECKSUM_ALG_OFF,
+			map[int]int{constants.QUERY_EVENT: 13, constants.WRITE_ROWS_EVENT: 10, constants.GTID_LOG_EVENT: 25, constants.PARTIAL_UPDATE_ROWS_EVENT: -1}},
+		{"5.6 crc32", "5.6.51-log", testPostHeaderLengths56, true, constants.BINLOG_CHECKSUM_ALG_CRC32, constants.BINLOG_CHECKSUM_ALG_CRC32,
+			map[int]int{constants.PREVIOUS_GTIDS_LOG_EVENT: 0, constants.FORMAT_DESCRIPTION_EVENT: 92}},
+		{"8.0 crc32", "8.0.36", testPostHeaderLengths80, true, constants.BINLOG_CHECKSUM_ALG_CRC32, constants.BINLOG_CHECKSUM_ALG_CRC32,
+			map[int]int{constants.TABLE_MAP_EVENT: 8, constants.GTID_LOG_EVENT: 42, constants.PARTIAL_UPDATE_ROWS_EVENT: 10, constants.TRANSACTION_PAYLOAD_EVENT: 40}},
+	}
+
+	for _, tt := range tests {
+		body := buildTestFormatDescriptionBody(tt.serverVersion, tt.postHeaderLengths, tt.withChecksum, tt.checksumAlg)
+		ev := NewFormatDescriptionEvent()
+		if err := ev.Decode(nil, body); err != nil {
+			t.Errorf("%s: decode error: %v", tt.name, err)
+			continue
+		}
+		if ev.GetServerVersion() != tt.serverVersion {
+			t.Errorf("%s: expect server version %s, got %s", tt.name, tt.serverVersion, ev.GetServerVersion())
+		}
+		if ev.GetEventHeaderLength() != EVENT_HEADER_LENGTH {
+			t.Errorf("%s: expect event header length %d, got %d", tt.name, EVENT_HEADER_LENGTH, ev.GetEventHeaderLength())
+		}
+		if ev.GetChecksumAlg() != tt.expectChecksumAlg {
+			t.Errorf("%s: expect checksum alg %d, got %d", tt.name, tt.expectChecksumAlg, ev.GetChecksumAlg())
+		}
+		if !bytes.Equal(ev.GetEventTypeHeaderLengths(), tt.postHeaderLengths) {
+			t.Errorf("%s: expect post-header lengths %v, got %v", tt.name, tt.postHeaderLengths, ev.GetEventTypeHeaderLengths())
+		}
+		for eventType, expect := range tt.expectLengths {
+			if length := ev.GetPostHeaderLength(eventType, -1); length != expect {
+				t.Errorf("%s: expect post-header length %d for event type %d, got %d", tt.name, expect, eventType, length)
+			}
+		}
+	}
+}
+
+func TestFormatDescriptionEventTooShort(t *testing.T) {
+	body := buildTestFormatDescriptionBody("8.0.36", nil, false, 0)
+	if err := NewFormatDescriptionEvent().Decode(nil, body[:len(body)-1]); err == nil {
+		t.Errorf("expect error for truncated format description event")
+	}
+	// 5.6.1 之后必须有 checksum_alg 和 checksum
+	if err := NewFormatDescriptionEvent().Decode(nil, append(body, 0x01, 0x02)); err == nil {
+		t.Errorf("expect error for format description event without checksum")
+	}
+}
+
+/*
+* 按 FORMAT_DESCRIPTION_EVENT 中的 post-header 长度解码之后的 event, TABLE_MAP_EVENT 的 post-header 为 6 时 table id 为 4 字节
+ */
+func TestDecoderHonorsPostHeaderLength(t *testing.T) {
+	lengths := append([]byte(nil), testPostHeaderLengths55...)
+	lengths[constants.TABLE_MAP_EVENT-1] = 6
+	decoder := NewDecoder()
+	_, err := decoder.Decode(buildTestEvent(constants.FORMAT_DESCRIPTION_EVENT, buildTestFormatDescriptionBody("5.1.73-log", lengths, false, 0)))
+	if err != nil {
+		t.Fatalf("decode format description event error: %v", err)
+	}
+	if decoder.GetChecksumAlg() != constants.BINLOG_CHECKSUM_ALG_UNDEF {
+		t.Errorf("expect no checksum for 5.1, got %d", decoder.GetChecksumAlg())
+	}
+
+	body := buildTestTableMapBody()
+	// 6 字节 table id 改为 4 字节
+	body = append(body[:4:4], body[6:]...)
+	ev, err := decoder.Decode(buildTestEvent(constants.TABLE_MAP_EVENT, body))
+	if err != nil {
+		t.Fatalf("decode table map event error: %v", err)
+	}
+	table := ev.(*TableMapEvent)
+	if table.GetTableId() != 1 || table.GetSchema() != "test" || table.GetTable() != "t1" || table.GetColumnCount() != 3 {
+		t.Errorf("unexpected table map event: id %d, %s.%s, %d columns", table.GetTableId(), table.GetSchema(), table.GetTable(), table.GetColumnCount())
+	}
+}
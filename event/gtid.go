@@ -0,0 +1,43 @@
+package event
+
+import (
+	"fmt"
+	"github.com/goMySQLSemiSync/packet"
+)
+
+/*
+* GTID_LOG_EVENT, 字段解析由 packet.GtidEvent 完成
+ */
+type GtidEvent struct {
+	*BaseEvent
+	*packet.GtidEvent
+}
+
+func NewGtidEvent() *GtidEvent {
+	return &GtidEvent{
+		BaseEvent: NewBaseEvent(),
+		GtidEvent: packet.NewGtidEvent(),
+	}
+}
+
+func (this *GtidEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	// commit flag(1) + sid(16) + gno(8)
+	if len(body) < 25 {
+		return fmt.Errorf("gtid event too short, length: %d", len(body))
+	}
+	return this.GtidEvent.LoadFromPacket(body)
+}
+
+/*
+* ANONYMOUS_GTID_LOG_EVENT, gtid_mode=OFF 时每个事务之前的 event, 格式与 GTID_LOG_EVENT 相同, sid 和 gno 为 0
+* 迁移到 gtid 模式的过程中与 GTID_LOG_EVENT 混合出现, 只用于事务边界和 logical clock, 不属于任何 gtid 集合
+ */
+type AnonymousGtidEvent struct {
+	*GtidEvent
+}
+
+func NewAnonymousGtidEvent() *AnonymousGtidEvent {
+	return &AnonymousGtidEvent{
+		GtidEvent: NewGtidEvent(),
+	}
+}
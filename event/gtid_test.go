@@ -0,0 +1,108 @@
+package event
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+/*
+* GTID_LOG_EVENT body 中 lt_type 之前的部分: commit flag, sid, gno = 5
+ */
+func buildTestGtidBody() []byte {
+	body := append([]byte{1}, bytes.Repeat([]byte{0x11}, 16)...)
+	gno := make([]byte, 8)
+	binary.LittleEndian.PutUint64(gno, 5)
+	return append(body, gno...)
+}
+
+/*
+* lt_type, last_committed = 10, sequence_number = 11
+ */
+func logicalClockTestBody() []byte {
+	body := append(buildTestGtidBody(), 2)
+	body = appendTestUint(body, 10, 8)
+	return appendTestUint(body, 11, 8)
+}
+
+func appendTestUint(body []byte, value uint64, size int) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, value)
+	return append(body, buf[:size]...)
+}
+
+func TestGtidEventDecode(t *testing.T) {
+	immediate := uint64(1700000000000001)
+	original := uint64(1600000000000002)
+	withTimestamp := appendTestUint(logicalClockTestBody(), immediate, 7)
+	// 同一个服务器: transaction_length 为 1 字节, 没有 original 字段
+	sameServer := appendTestUint(append(append([]byte(nil), withTimestamp...), 200), 80030, 4)
+	// 来自其他服务器: 最高位表示后面有 original, transaction_length 为 3 字节
+	otherServer := appendTestUint(logicalClockTestBody(), immediate|1<<55, 7)
+	otherServer = appendTestUint(otherServer, original, 7)
+	otherServer = append(otherServer, 0xfc, 0x10, 0x27)
+	otherServer = appendTestUint(otherServer, 80030|1<<31, 4)
+	otherServer = appendTestUint(otherServer, 50744, 4)
+	longTransaction := append(append([]byte(nil), withTimestamp...), 0xfe, 0, 0, 0, 0, 1, 0, 0, 0)
+
+	tests := []struct {
+		name              string
+		body              []byte
+		ltType            int
+		lastCommitted     int64
+		sequenceNumber    int64
+		immediateCommit   uint64
+		originalCommit    uint64
+		transactionLength uint64
+		immediateVersion  uint32
+		originalVersion   uint32
+	}{
+		{"5.6", buildTestGtidBody(), 0, 0, 0, 0, 0, 0, 0, 0},
+		{"5.7", logicalClockTestBody(), 2, 10, 11, 0, 0, 0, 0, 0},
+		{"8.0.1", withTimestamp, 2, 10, 11, immediate, immediate, 0, 0, 0},
+		{"8.0.14 same server", sameServer, 2, 10, 11, immediate, immediate, 200, 80030, 80030},
+		{"8.0.14 other server", otherServer, 2, 10, 11, immediate, original, 10000, 80030, 50744},
+		{"8 bytes transaction length", longTransaction, 2, 10, 11, immediate, immediate, 1 << 32, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := NewGtidEvent()
+			if err := ev.Decode(NewFormatDescriptionEvent(), tt.body); err != nil {
+				t.Fatalf("decode gtid event error: %v", err)
+			}
+			if ev.GetGtid() != "11111111-1111-1111-1111-111111111111:5" || !ev.GetCommitFlag() {
+				t.Errorf("unexpected gtid %s", ev.GetGtid())
+			}
+			if ev.GetLtType() != tt.ltType || ev.GetLastCommitted() != tt.lastCommitted || ev.GetSequenceNumber() != tt.sequenceNumber {
+				t.Errorf("expect logical clock %d/%d/%d, got %d/%d/%d", tt.ltType, tt.lastCommitted, tt.sequenceNumber,
+					ev.GetLtType(), ev.GetLastCommitted(), ev.GetSequenceNumber())
+			}
+			if ev.GetImmediateCommitTimestamp() != tt.immediateCommit || ev.GetOriginalCommitTimestamp() != tt.originalCommit {
+				t.Errorf("expect commit timestamps %d/%d, got %d/%d", tt.immediateCommit, tt.originalCommit,
+					ev.GetImmediateCommitTimestamp(), ev.GetOriginalCommitTimestamp())
+			}
+			if ev.GetTransactionLength() != tt.transactionLength {
+				t.Errorf("expect transaction length %d, got %d", tt.transactionLength, ev.GetTransactionLength())
+			}
+			if ev.GetImmediateServerVersion() != tt.immediateVersion || ev.GetOriginalServerVersion() != tt.originalVersion {
+				t.Errorf("expect server versions %d/%d, got %d/%d", tt.immediateVersion, tt.originalVersion,
+					ev.GetImmediateServerVersion(), ev.GetOriginalServerVersion())
+			}
+		})
+	}
+}
+
+func TestGtidEventDecodeTruncatedTransactionLength(t *testing.T) {
+	body := appendTestUint(logicalClockTestBody(), 1700000000000001, 7)
+	for _, tail := range [][]byte{
+		{0xfc, 0x10},
+		{0xfd, 0x10, 0x27},
+		{0xfe, 0, 0, 0, 0, 1},
+		{0xff},
+	} {
+		ev := NewGtidEvent()
+		if err := ev.Decode(NewFormatDescriptionEvent(), append(append([]byte(nil), body...), tail...)); err == nil {
+			t.Errorf("expect error for transaction length % x", tail)
+		}
+	}
+}
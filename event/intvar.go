@@ -0,0 +1,85 @@
+package event
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// INTVAR_EVENT 的变量类型
+const (
+	INVALID_INT_EVENT    = 0
+	LAST_INSERT_ID_EVENT = 1
+	INSERT_ID_EVENT      = 2
+)
+
+/*
+* INTVAR_EVENT, 基于语句复制时, 在 QUERY_EVENT 之前记录语句用到的 LAST_INSERT_ID() 或自增值
+* 1              type, LAST_INSERT_ID_EVENT 或 INSERT_ID_EVENT
+* 8              value
+ */
+type IntvarEvent struct {
+	*BaseEvent
+	intvarType uint8
+	value      uint64
+}
+
+func NewIntvarEvent() *IntvarEvent {
+	return &IntvarEvent{
+		BaseEvent:  NewBaseEvent(),
+		intvarType: INVALID_INT_EVENT,
+		value:      0,
+	}
+}
+
+func (this *IntvarEvent) GetType() uint8 {
+	return this.intvarType
+}
+
+func (this *IntvarEvent) GetValue() uint64 {
+	return this.value
+}
+
+func (this *IntvarEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	if len(body) < 9 {
+		return fmt.Errorf("intvar event too short, length: %d", len(body))
+	}
+	this.intvarType = body[0]
+	this.value = binary.LittleEndian.Uint64(body[1:9])
+	return nil
+}
+
+/*
+* RAND_EVENT, 基于语句复制时, 在 QUERY_EVENT 之前记录 RAND() 的种子
+* 8              seed1
+* 8              seed2
+ */
+type RandEvent struct {
+	*BaseEvent
+	seed1 uint64
+	seed2 uint64
+}
+
+func NewRandEvent() *RandEvent {
+	return &RandEvent{
+		BaseEvent: NewBaseEvent(),
+		seed1:     0,
+		seed2:     0,
+	}
+}
+
+func (this *RandEvent) GetSeed1() uint64 {
+	return this.seed1
+}
+
+func (this *RandEvent) GetSeed2() uint64 {
+	return this.seed2
+}
+
+func (this *RandEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	if len(body) < 16 {
+		return fmt.Errorf("rand event too short, length: %d", len(body))
+	}
+	this.seed1 = binary.LittleEndian.Uint64(body[0:8])
+	this.seed2 = binary.LittleEndian.Uint64(body[8:16])
+	return nil
+}
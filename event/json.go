@@ -0,0 +1,436 @@
+package event
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/goMySQLSemiSync/protocol"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MySQL binary JSON 值类型
+const (
+	JSONB_TYPE_SMALL_OBJECT = 0x00
+	JSONB_TYPE_LARGE_OBJECT = 0x01
+	JSONB_TYPE_SMALL_ARRAY  = 0x02
+	JSONB_TYPE_LARGE_ARRAY  = 0x03
+	JSONB_TYPE_LITERAL      = 0x04
+	JSONB_TYPE_INT16        = 0x05
+	JSONB_TYPE_UINT16       = 0x06
+	JSONB_TYPE_INT32        = 0x07
+	JSONB_TYPE_UINT32       = 0x08
+	JSONB_TYPE_INT64        = 0x09
+	JSONB_TYPE_UINT64       = 0x0a
+	JSONB_TYPE_DOUBLE       = 0x0b
+	JSONB_TYPE_STRING       = 0x0c
+	JSONB_TYPE_OPAQUE       = 0x0f
+
+	JSONB_LITERAL_NULL  = 0x00
+	JSONB_LITERAL_TRUE  = 0x01
+	JSONB_LITERAL_FALSE = 0x02
+
+	// object / array 的最大嵌套层数, 与 MySQL 的 JSON_DOCUMENT_MAX_DEPTH 相同
+	JSON_DOCUMENT_MAX_DEPTH = 100
+)
+
+/*
+* 把 MySQL binary JSON 转换为文本 JSON, 格式与 MySQL 输出一致, 如 {"a": 1, "b": [true, null]}
+* https://dev.mysql.com/doc/dev/mysql-server/latest/json__binary_8h.html
+* doc:
+* 1              type
+* n              value
+* 空数据表示 JSON null
+ */
+func DecodeJSON(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "null", nil
+	}
+	var buf bytes.Buffer
+	// 正常的文档中每个 container 元素在 header 中至少占 3 字节, 元素个数不会超过数据长度
+	// 多个元素指向同一个值时, 按数据长度限制解码的元素个数, 避免输出指数增长
+	entries := len(data)
+	err := decodeJSONValue(&buf, data[0], data[1:], 0, &entries)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+/*
+* depth 为所在 container 的嵌套层数, entries 为剩余可以解码的 container 元素个数
+ */
+func decodeJSONValue(buf *bytes.Buffer, valueType byte, data []byte, depth int, entries *int) error {
+	switch valueType {
+	case JSONB_TYPE_SMALL_OBJECT:
+		return decodeJSONContainer(buf, data, true, false, depth+1, entries)
+	case JSONB_TYPE_LARGE_OBJECT:
+		return decodeJSONContainer(buf, data, true, true, depth+1, entries)
+	case JSONB_TYPE_SMALL_ARRAY:
+		return decodeJSONContainer(buf, data, false, false, depth+1, entries)
+	case JSONB_TYPE_LARGE_ARRAY:
+		return decodeJSONContainer(buf, data, false, true, depth+1, entries)
+	case JSONB_TYPE_LITERAL:
+		if len(data) < 1 {
+			return fmt.Errorf("json literal too short")
+		}
+		return decodeJSONLiteral(buf, data[0])
+	case JSONB_TYPE_INT16:
+		if len(data) < 2 {
+			return fmt.Errorf("json int16 too short")
+		}
+		buf.WriteString(strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(data))), 10))
+	case JSONB_TYPE_UINT16:
+		if len(data) < 2 {
+			return fmt.Errorf("json uint16 too short")
+		}
+		buf.WriteString(strconv.FormatUint(uint64(binary.LittleEndian.Uint16(data)), 10))
+	case JSONB_TYPE_INT32:
+		if len(data) < 4 {
+			return fmt.Errorf("json int32 too short")
+		}
+		buf.WriteString(strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(data))), 10))
+	case JSONB_TYPE_UINT32:
+		if len(data) < 4 {
+			return fmt.Errorf("json uint32 too short")
+		}
+		buf.WriteString(strconv.FormatUint(uint64(binary.LittleEndian.Uint32(data)), 10))
+	case JSONB_TYPE_INT64:
+		if len(data) < 8 {
+			return fmt.Errorf("json int64 too short")
+		}
+		buf.WriteString(strconv.FormatInt(int64(binary.LittleEndian.Uint64(data)), 10))
+	case JSONB_TYPE_UINT64:
+		if len(data) < 8 {
+			return fmt.Errorf("json uint64 too short")
+		}
+		buf.WriteString(strconv.FormatUint(binary.LittleEndian.Uint64(data), 10))
+	case JSONB_TYPE_DOUBLE:
+		if len(data) < 8 {
+			return fmt.Errorf("json double too short")
+		}
+		buf.WriteString(formatJSONDouble(math.Float64frombits(binary.LittleEndian.Uint64(data))))
+	case JSONB_TYPE_STRING:
+		length, n, err := decodeJSONVariableLength(data)
+		if err != nil {
+			return err
+		}
+		if len(data) < n+length {
+			return fmt.Errorf("json string too short")
+		}
+		writeJSONString(buf, string(data[n:n+length]))
+	case JSONB_TYPE_OPAQUE:
+		return decodeJSONOpaque(buf, data)
+	default:
+		return fmt.Errorf("unknown json value type %d", valueType)
+	}
+	return nil
+}
+
+func decodeJSONLiteral(buf *bytes.Buffer, literal byte) error {
+	switch literal {
+	case JSONB_LITERAL_NULL:
+		buf.WriteString("null")
+	case JSONB_LITERAL_TRUE:
+		buf.WriteString("true")
+	case JSONB_LITERAL_FALSE:
+		buf.WriteString("false")
+	default:
+		return fmt.Errorf("unknown json literal %d", literal)
+	}
+	return nil
+}
+
+/*
+* object / array, small 格式的计数和偏移量为 2 字节, large 格式为 4 字节, 偏移量相对于 count 的起始位置
+* count
+* size
+* key-entry * count, 只有 object: key offset + key length(2 字节)
+* value-entry * count: type(1) + offset, literal / int16 / uint16 (large 格式中还有 int32 / uint32) 直接内联在 offset 中
+* key * count
+* value * count
+* key 和不内联的 value 必须在 header 之后, 否则指向 container 自身会无限递归
+ */
+func decodeJSONContainer(buf *bytes.Buffer, data []byte, isObject bool, isLarge bool, depth int, entries *int) error {
+	if depth > JSON_DOCUMENT_MAX_DEPTH {
+		return fmt.Errorf("json document exceeds max depth %d", JSON_DOCUMENT_MAX_DEPTH)
+	}
+	offsetSize := 2
+	if isLarge {
+		offsetSize = 4
+	}
+	readOffset := func(pos int) (int, error) {
+		if pos+offsetSize > len(data) {
+			return 0, fmt.Errorf("json container too short")
+		}
+		if isLarge {
+			return int(binary.LittleEndian.Uint32(data[pos:])), nil
+		}
+		return int(binary.LittleEndian.Uint16(data[pos:])), nil
+	}
+
+	count, err := readOffset(0)
+	if err != nil {
+		return err
+	}
+	size, err := readOffset(offsetSize)
+	if err != nil {
+		return err
+	}
+	if size > len(data) {
+		return fmt.Errorf("json container size %d exceeds data length %d", size, len(data))
+	}
+	data = data[:size]
+
+	keyEntrySize := 0
+	if isObject {
+		keyEntrySize = offsetSize + 2
+	}
+	valueEntrySize := 1 + offsetSize
+	headerSize := 2*offsetSize + count*(keyEntrySize+valueEntrySize)
+	if headerSize > len(data) {
+		return fmt.Errorf("json container header too short, count: %d", count)
+	}
+	*entries -= count
+	if *entries < 0 {
+		return fmt.Errorf("json document has more values than its length allows")
+	}
+
+	if isObject {
+		buf.WriteString("{")
+	} else {
+		buf.WriteString("[")
+	}
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		if isObject {
+			entry := 2*offsetSize + i*keyEntrySize
+			keyOffset, _ := readOffset(entry)
+			keyLength := int(binary.LittleEndian.Uint16(data[entry+offsetSize:]))
+			if keyOffset < headerSize || keyOffset+keyLength > len(data) {
+				return fmt.Errorf("json object key out of range")
+			}
+			writeJSONString(buf, string(data[keyOffset:keyOffset+keyLength]))
+			buf.WriteString(": ")
+		}
+
+		entry := 2*offsetSize + count*keyEntrySize + i*valueEntrySize
+		valueType := data[entry]
+		if isJSONInlineValue(valueType, isLarge) {
+			err = decodeJSONValue(buf, valueType, data[entry+1:entry+1+offsetSize], depth, entries)
+		} else {
+			valueOffset, _ := readOffset(entry + 1)
+			if valueOffset < headerSize || valueOffset >= len(data) {
+				return fmt.Errorf("json value out of range")
+			}
+			err = decodeJSONValue(buf, valueType, data[valueOffset:], depth, entries)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if isObject {
+		buf.WriteString("}")
+	} else {
+		buf.WriteString("]")
+	}
+	return nil
+}
+
+func isJSONInlineValue(valueType byte, isLarge bool) bool {
+	switch valueType {
+	case JSONB_TYPE_LITERAL, JSONB_TYPE_INT16, JSONB_TYPE_UINT16:
+		return true
+	case JSONB_TYPE_INT32, JSONB_TYPE_UINT32:
+		return isLarge
+	}
+	return false
+}
+
+/*
+* 字符串和 opaque 的长度: 每个字节低 7 位为数据, 最高位为 1 表示后面还有字节, 最多 5 字节
+ */
+func decodeJSONVariableLength(data []byte) (int, int, error) {
+	length := 0
+	for i := 0; i < 5 && i < len(data); i++ {
+		length |= int(data[i]&0x7f) << uint(7*i)
+		if data[i]&0x80 == 0 {
+			return length, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid json variable length")
+}
+
+/*
+* opaque: 1 字节 MySQL 列类型 + 长度 + 数据
+* DECIMAL: precision(1) + scale(1) + NEWDECIMAL 二进制
+* DATE / DATETIME / TIMESTAMP / TIME: 8 字节 little-endian 的 packed 时间
+* 其他类型按 MySQL 的格式输出为 "base64:type<类型>:<base64 数据>"
+ */
+func decodeJSONOpaque(buf *bytes.Buffer, data []byte) error {
+	if len(data) < 1 {
+		return fmt.Errorf("json opaque too short")
+	}
+	fieldType := int(data[0])
+	length, n, err := decodeJSONVariableLength(data[1:])
+	if err != nil {
+		return err
+	}
+	if len(data) < 1+n+length {
+		return fmt.Errorf("json opaque too short")
+	}
+	value := data[1+n : 1+n+length]
+
+	switch fieldType {
+	case protocol.MYSQL_TYPE_NEWDECIMAL:
+		if len(value) < 2 {
+			return fmt.Errorf("json decimal too short")
+		}
+		decimal, _, err := decodeNewDecimal(value[2:], int(value[0]), int(value[1]))
+		if err != nil {
+			return err
+		}
+		buf.WriteString(decimal.(string))
+	case protocol.MYSQL_TYPE_DATE, protocol.MYSQL_TYPE_DATETIME, protocol.MYSQL_TYPE_TIMESTAMP, protocol.MYSQL_TYPE_TIME:
+		if len(value) < 8 {
+			return fmt.Errorf("json temporal too short")
+		}
+		packed := int64(binary.LittleEndian.Uint64(value))
+		if fieldType == protocol.MYSQL_TYPE_TIME {
+			writeJSONString(buf, formatPackedTime(packed))
+		} else {
+			writeJSONString(buf, formatPackedDatetime(packed, fieldType == protocol.MYSQL_TYPE_DATE))
+		}
+	default:
+		writeJSONString(buf, fmt.Sprintf("base64:type%d:%s", fieldType, base64.StdEncoding.EncodeToString(value)))
+	}
+	return nil
+}
+
+/*
+* packed datetime: (ymdhms << 24) + 微秒, ymdhms 与 DATETIME2 的布局相同
+ */
+func formatPackedDatetime(packed int64, dateOnly bool) string {
+	if packed < 0 {
+		packed = -packed
+	}
+	ymdhms := packed >> 24
+	usec := packed % (1 << 24)
+	ymd := ymdhms >> 17
+	ym := ymd >> 5
+	hms := ymdhms % (1 << 17)
+	if dateOnly {
+		return fmt.Sprintf("%04d-%02d-%02d", ym/13, ym%13, ymd%(1<<5))
+	}
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d.%06d", ym/13, ym%13, ymd%(1<<5), hms>>12, (hms>>6)%(1<<6), hms%(1<<6), usec)
+}
+
+/*
+* packed time: (hms << 24) + 微秒, 负数表示负的时间
+ */
+func formatPackedTime(packed int64) string {
+	sign := ""
+	if packed < 0 {
+		sign = "-"
+		packed = -packed
+	}
+	hms := packed >> 24
+	usec := packed % (1 << 24)
+	return fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, (hms>>12)%(1<<10), (hms>>6)%(1<<6), hms%(1<<6), usec)
+}
+
+func formatJSONDouble(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEIN") {
+		s += ".0"
+	}
+	return s
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	// Encode 在末尾添加换行
+	buf.Truncate(buf.Len() - 1)
+}
+
+// PARTIAL_UPDATE_ROWS_EVENT 中 JSON 的修改操作
+const (
+	JSON_DIFF_OPERATION_REPLACE = 0
+	JSON_DIFF_OPERATION_INSERT  = 1
+	JSON_DIFF_OPERATION_REMOVE  = 2
+)
+
+/*
+* binlog_row_value_options=PARTIAL_JSON 时, after image 中的 JSON 列只记录修改的部分
+* 1              operation
+* lenenc-int     path length
+* string         path
+* lenenc-int     value length, REMOVE 没有
+* string         binary JSON value, REMOVE 没有
+ */
+type JsonDiff struct {
+	Operation int
+	Path      string
+	Value     string // 文本 JSON
+}
+
+func (this *JsonDiff) String() string {
+	switch this.Operation {
+	case JSON_DIFF_OPERATION_REPLACE:
+		return fmt.Sprintf("JSON_REPLACE(@, '%s', %s)", this.Path, this.Value)
+	case JSON_DIFF_OPERATION_INSERT:
+		return fmt.Sprintf("JSON_INSERT(@, '%s', %s)", this.Path, this.Value)
+	case JSON_DIFF_OPERATION_REMOVE:
+		return fmt.Sprintf("JSON_REMOVE(@, '%s')", this.Path)
+	}
+	return fmt.Sprintf("unknown json diff operation %d", this.Operation)
+}
+
+func DecodeJSONDiff(data []byte) ([]*JsonDiff, error) {
+	diffs := make([]*JsonDiff, 0)
+	proto := protocol.NewProto(data, 0)
+	need := func(size int) error {
+		if size < 0 || proto.GetOffset()+size > len(data) {
+			return fmt.Errorf("json diff too short, length: %d", len(data))
+		}
+		return nil
+	}
+	for proto.Has_remaining_data() {
+		diff := &JsonDiff{}
+		diff.Operation = proto.Get_fixed_int(1)
+		if diff.Operation > JSON_DIFF_OPERATION_REMOVE {
+			return nil, fmt.Errorf("unknown json diff operation %d", diff.Operation)
+		}
+		pathLength, err := readLenencInt(proto, need)
+		if err != nil {
+			return nil, err
+		}
+		if proto.GetOffset()+pathLength > len(data) {
+			return nil, fmt.Errorf("json diff path too short")
+		}
+		diff.Path = proto.Get_fixed_str(pathLength)
+		if diff.Operation != JSON_DIFF_OPERATION_REMOVE {
+			valueLength, err := readLenencInt(proto, need)
+			if err != nil {
+				return nil, err
+			}
+			if proto.GetOffset()+valueLength > len(data) {
+				return nil, fmt.Errorf("json diff value too short")
+			}
+			value, err := DecodeJSON(proto.Read(valueLength))
+			if err != nil {
+				return nil, err
+			}
+			diff.Value = value
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
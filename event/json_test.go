@@ -0,0 +1,151 @@
+package event
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		expect string
+	}{
+		{"empty", []byte{}, "null"},
+		{"object", []byte{
+			0x00, 0x02, 0x00, 0x1e, 0x00,
+			0x12, 0x00, 0x01, 0x00, 0x13, 0x00, 0x01, 0x00,
+			0x05, 0x01, 0x00, 0x02, 0x14, 0x00,
+			'a', 'b',
+			0x02, 0x00, 0x0a, 0x00, 0x04, 0x01, 0x00, 0x04, 0x00, 0x00,
+		}, `{"a": 1, "b": [true, null]}`},
+		{"string", []byte{0x0c, 0x05, 'h', 'e', 'l', 'l', 'o'}, `"hello"`},
+		{"string escape", []byte{0x0c, 0x04, 'a', '"', '<', 'b'}, `"a\"<b"`},
+		{"array of string", []byte{0x02, 0x01, 0x00, 0x0a, 0x00, 0x0c, 0x07, 0x00, 0x02, 'a', 'b'}, `["ab"]`},
+		{"large array", []byte{0x03, 0x01, 0x00, 0x00, 0x00, 0x0d, 0x00, 0x00, 0x00, 0x05, 0x01, 0x00, 0x00, 0x00}, `[1]`},
+		{"large array inline int32", []byte{0x03, 0x01, 0x00, 0x00, 0x00, 0x0d, 0x00, 0x00, 0x00, 0x07, 0xff, 0xff, 0xff, 0xff}, `[-1]`},
+		{"false", []byte{0x04, 0x02}, "false"},
+		{"double", []byte{0x0b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf0, 0x3f}, "1.0"},
+		{"double fraction", []byte{0x0b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0xc0}, "-2.5"},
+		{"int64", []byte{0x09, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "-1"},
+		{"uint64", []byte{0x0a, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "18446744073709551615"},
+		{"decimal", []byte{0x0f, 0xf6, 0x05, 0x05, 0x02, 0x7f, 0xfe, 0xcd}, "-1.50"},
+		{"datetime", []byte{0x0f, 0x0c, 0x08, 0x00, 0x00, 0x00, 0x19, 0x76, 0x1f, 0x95, 0x19}, `"2015-01-15 23:24:25.000000"`},
+		{"date", []byte{0x0f, 0x0a, 0x08, 0x00, 0x00, 0x00, 0x19, 0x76, 0x1f, 0x95, 0x19}, `"2015-01-15"`},
+		{"time", []byte{0x0f, 0x0b, 0x08, 0xe0, 0x5e, 0xf8, 0x7c, 0xef, 0xff, 0xff, 0xff}, `"-01:02:03.500000"`},
+		{"opaque", []byte{0x0f, 0xfc, 0x02, 0x01, 0x02}, `"base64:type252:AQI="`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := DecodeJSON(tt.data)
+			if err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			if value != tt.expect {
+				t.Errorf("expect %s, but got %s", tt.expect, value)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONMalformed(t *testing.T) {
+	tests := [][]byte{
+		{0x00, 0x02, 0x00, 0x1e, 0x00},
+		{0x0c, 0x05, 'h'},
+		{0x0e},
+		{0x04, 0x09},
+	}
+	for _, data := range tests {
+		_, err := DecodeJSON(data)
+		if err == nil {
+			t.Errorf("expect error for %v", data)
+		}
+	}
+}
+
+func TestDecodeJSONDiff(t *testing.T) {
+	data := []byte{
+		0x00, 0x03, '$', '.', 'a', 0x03, 0x05, 0x02, 0x00,
+		0x02, 0x03, '$', '.', 'b',
+	}
+	diffs, err := DecodeJSONDiff(data)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	expect := []*JsonDiff{
+		{Operation: JSON_DIFF_OPERATION_REPLACE, Path: "$.a", Value: "2"},
+		{Operation: JSON_DIFF_OPERATION_REMOVE, Path: "$.b", Value: ""},
+	}
+	if !reflect.DeepEqual(diffs, expect) {
+		t.Errorf("expect %v, but got %v", expect, diffs)
+	}
+}
+
+func TestDecodeJSONDiffTruncated(t *testing.T) {
+	data := []byte{
+		0x00, 0x03, '$', '.', 'a', 0x03, 0x05, 0x02, 0x00,
+		0x02, 0x03, '$', '.', 'b',
+	}
+	for i := 1; i < len(data); i++ {
+		// 第一个 diff 结束的位置
+		if i == 9 {
+			continue
+		}
+		if _, err := DecodeJSONDiff(data[:i]); err == nil {
+			t.Errorf("expect error for json diff truncated to %d bytes", i)
+		}
+	}
+	if _, err := DecodeJSONDiff([]byte{0x00, 0xfc, 0x01}); err == nil {
+		t.Errorf("expect error for truncated path length")
+	}
+}
+
+/*
+* levels 层嵌套的 small array, 每层 fanout 个元素都指向下一层, 最内层为空数组
+ */
+func buildTestJSONArrayChain(levels int, fanout int) []byte {
+	child := []byte{0x00, 0x00, 0x04, 0x00}
+	for i := 0; i < levels; i++ {
+		headerSize := 4 + 3*fanout
+		size := headerSize + len(child)
+		container := []byte{byte(fanout), byte(fanout >> 8), byte(size), byte(size >> 8)}
+		for j := 0; j < fanout; j++ {
+			container = append(container, JSONB_TYPE_SMALL_ARRAY, byte(headerSize), byte(headerSize>>8))
+		}
+		child = append(container, child...)
+	}
+	return append([]byte{JSONB_TYPE_SMALL_ARRAY}, child...)
+}
+
+func TestDecodeJSONCorrupt(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		// value 指向 container 自身, 无限递归
+		{"value points to container", []byte{0x02, 0x01, 0x00, 0x08, 0x00, 0x02, 0x00, 0x00, 0x00}},
+		{"value points into header", []byte{0x02, 0x01, 0x00, 0x08, 0x00, 0x02, 0x02, 0x00, 0x00}},
+		{"key points into header", []byte{0x00, 0x01, 0x00, 0x0c, 0x00, 0x00, 0x00, 0x01, 0x00, 0x04, 0x00, 0x00, 'a'}},
+		{"too deep", buildTestJSONArrayChain(JSON_DOCUMENT_MAX_DEPTH, 1)},
+		// 每层两个元素指向同一个值, 不限制时输出为 2^60 个元素
+		{"shared values", buildTestJSONArrayChain(60, 2)},
+	}
+	for _, tt := range tests {
+		if _, err := DecodeJSON(tt.data); err == nil {
+			t.Errorf("%s: expect error", tt.name)
+		}
+	}
+
+	value, err := DecodeJSON(buildTestJSONArrayChain(JSON_DOCUMENT_MAX_DEPTH-1, 1))
+	if err != nil {
+		t.Fatalf("decode max depth error: %v", err)
+	}
+	if expect := strings.Repeat("[", JSON_DOCUMENT_MAX_DEPTH) + strings.Repeat("]", JSON_DOCUMENT_MAX_DEPTH); value != expect {
+		t.Errorf("expect %s, got %s", expect, value)
+	}
+	if _, err := DecodeJSON(buildTestJSONArrayChain(3, 2)); err != nil {
+		t.Errorf("decode small shared values error: %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+package event
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+// MARIADB_GTID_EVENT 的 flags2
+const (
+	MARIADB_FL_STANDALONE      = 0x01
+	MARIADB_FL_GROUP_COMMIT_ID = 0x02
+	MARIADB_FL_TRANSACTIONAL   = 0x04
+	MARIADB_FL_ALLOW_PARALLEL  = 0x08
+	MARIADB_FL_WAITED          = 0x10
+	MARIADB_FL_DDL             = 0x20
+	MARIADB_FL_PREPARED_XA     = 0x40
+	MARIADB_FL_COMPLETED_XA    = 0x80
+)
+
+/*
+* MARIADB_GTID_EVENT, MariaDB 每个事务之前的 event, 同时代替 BEGIN 语句
+* 8              sequence_number
+* 4              domain_id
+* 1              flags2
+* 有 MARIADB_FL_GROUP_COMMIT_ID 时:
+* 8              commit_id
+* 有 MARIADB_FL_PREPARED_XA 或 MARIADB_FL_COMPLETED_XA 时:
+* 4              xid format_id
+* 1              gtrid length
+* 1              bqual length
+* string[len]    gtrid + bqual
+* server_id 使用 event header 中的 server_id
+ */
+type MariadbGtidEvent struct {
+	*BaseEvent
+	sequenceNumber uint64
+	domainId       uint32
+	flags2         uint8
+	commitId       uint64
+	xaFormatId     uint32
+	xaGtrid        []byte
+	xaBqual        []byte
+}
+
+func NewMariadbGtidEvent() *MariadbGtidEvent {
+	return &MariadbGtidEvent{
+		BaseEvent:      NewBaseEvent(),
+		sequenceNumber: 0,
+		domainId:       0,
+		flags2:         0,
+		commitId:       0,
+		xaFormatId:     0,
+		xaGtrid:        nil,
+		xaBqual:        nil,
+	}
+}
+
+func (this *MariadbGtidEvent) GetSequenceNumber() uint64 {
+	return this.sequenceNumber
+}
+
+func (this *MariadbGtidEvent) GetDomainId() uint32 {
+	return this.domainId
+}
+
+func (this *MariadbGtidEvent) GetFlags2() uint8 {
+	return this.flags2
+}
+
+/*
+* 同一组提交的事务 commit_id 相同, 没有 MARIADB_FL_GROUP_COMMIT_ID 时为 0
+ */
+func (this *MariadbGtidEvent) GetCommitId() uint64 {
+	return this.commitId
+}
+
+func (this *MariadbGtidEvent) GetXaFormatId() uint32 {
+	return this.xaFormatId
+}
+
+func (this *MariadbGtidEvent) GetXaGtrid() []byte {
+	return this.xaGtrid
+}
+
+func (this *MariadbGtidEvent) GetXaBqual() []byte {
+	return this.xaBqual
+}
+
+/*
+* 不带 BEGIN/COMMIT 的单语句事务, 如 DDL
+ */
+func (this *MariadbGtidEvent) IsStandalone() bool {
+	return this.flags2&MARIADB_FL_STANDALONE != 0
+}
+
+func (this *MariadbGtidEvent) GetMariadbGtid() *protocol.MariadbGtid {
+	return protocol.NewMariadbGtid(this.domainId, this.GetHeader().ServerId, this.sequenceNumber)
+}
+
+/*
+* domain_id-server_id-sequence_number
+ */
+func (this *MariadbGtidEvent) GetGtid() string {
+	return this.GetMariadbGtid().String()
+}
+
+func (this *MariadbGtidEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	if len(body) < 13 {
+		return fmt.Errorf("mariadb gtid event too short, length: %d", len(body))
+	}
+	pos := 0
+	this.sequenceNumber = binary.LittleEndian.Uint64(body[pos : pos+8])
+	pos += 8
+	this.domainId = binary.LittleEndian.Uint32(body[pos : pos+4])
+	pos += 4
+	this.flags2 = body[pos]
+	pos += 1
+
+	if this.flags2&MARIADB_FL_GROUP_COMMIT_ID != 0 {
+		if len(body) < pos+8 {
+			return fmt.Errorf("mariadb gtid event too short for commit_id, length: %d", len(body))
+		}
+		this.commitId = binary.LittleEndian.Uint64(body[pos : pos+8])
+		pos += 8
+	}
+
+	if this.flags2&(MARIADB_FL_PREPARED_XA|MARIADB_FL_COMPLETED_XA) != 0 {
+		if len(body) < pos+6 {
+			return fmt.Errorf("mariadb gtid event too short for xid, length: %d", len(body))
+		}
+		this.xaFormatId = binary.LittleEndian.Uint32(body[pos : pos+4])
+		pos += 4
+		gtridLength := int(body[pos])
+		bqualLength := int(body[pos+1])
+		pos += 2
+		if len(body) < pos+gtridLength+bqualLength {
+			return fmt.Errorf("mariadb gtid event too short for xid data, length: %d", len(body))
+		}
+		this.xaGtrid = body[pos : pos+gtridLength]
+		pos += gtridLength
+		this.xaBqual = body[pos : pos+bqualLength]
+	}
+	return nil
+}
+
+/*
+* MARIADB_GTID_LIST_EVENT, 每个 binlog 文件开头记录之前所有 binlog 的 gtid 状态, 类似 PREVIOUS_GTIDS_LOG_EVENT
+* 4              低 28 位为 gtid 个数, 高 4 位为 flags
+* 每个 gtid:
+* 4              domain_id
+* 4              server_id
+* 8              sequence_number
+ */
+type MariadbGtidListEvent struct {
+	*BaseEvent
+	flags uint8
+	gtids []*protocol.MariadbGtid
+}
+
+func NewMariadbGtidListEvent() *MariadbGtidListEvent {
+	return &MariadbGtidListEvent{
+		BaseEvent: NewBaseEvent(),
+		flags:     0,
+		gtids:     make([]*protocol.MariadbGtid, 0),
+	}
+}
+
+func (this *MariadbGtidListEvent) GetFlags() uint8 {
+	return this.flags
+}
+
+func (this *MariadbGtidListEvent) GetGtids() []*protocol.MariadbGtid {
+	return this.gtids
+}
+
+/*
+* 每个 domain 最后一个 gtid
+ */
+func (this *MariadbGtidListEvent) GetGtidSet() *protocol.MariadbGtidSet {
+	gtidSet := protocol.NewMariadbGtidSet()
+	for _, gtid := range this.gtids {
+		gtidSet.Update(gtid)
+	}
+	return gtidSet
+}
+
+func (this *MariadbGtidListEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	if len(body) < 4 {
+		return fmt.Errorf("mariadb gtid list event too short, length: %d", len(body))
+	}
+	value := binary.LittleEndian.Uint32(body[0:4])
+	count := int(value & 0x0fffffff)
+	this.flags = uint8(value >> 28)
+	if len(body) < 4+count*16 {
+		return fmt.Errorf("mariadb gtid list event too short, count: %d, length: %d", count, len(body))
+	}
+	this.gtids = make([]*protocol.MariadbGtid, 0, count)
+	for pos := 4; pos < 4+count*16; pos += 16 {
+		domainId := binary.LittleEndian.Uint32(body[pos : pos+4])
+		serverId := binary.LittleEndian.Uint32(body[pos+4 : pos+8])
+		sequenceNumber := binary.LittleEndian.Uint64(body[pos+8 : pos+16])
+		this.gtids = append(this.gtids, protocol.NewMariadbGtid(domainId, serverId, sequenceNumber))
+	}
+	return nil
+}
+
+/*
+* MARIADB_ANNOTATE_ROWS_EVENT, binlog_annotate_row_events=ON 时在 TABLE_MAP_EVENT 之前记录原始 SQL
+* string[EOF]    query
+ */
+type MariadbAnnotateRowsEvent struct {
+	*BaseEvent
+	query string
+}
+
+func NewMariadbAnnotateRowsEvent() *MariadbAnnotateRowsEvent {
+	return &MariadbAnnotateRowsEvent{
+		BaseEvent: NewBaseEvent(),
+		query:     "",
+	}
+}
+
+func (this *MariadbAnnotateRowsEvent) GetQuery() string {
+	return this.query
+}
+
+func (this *MariadbAnnotateRowsEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	this.query = string(body)
+	return nil
+}
+
+/*
+* MARIADB_BINLOG_CHECKPOINT_EVENT, 记录崩溃恢复需要从哪个 binlog 文件开始扫描
+* 4              binlog file name length
+* string[len]    binlog file name
+ */
+type MariadbBinlogCheckpointEvent struct {
+	*BaseEvent
+	logFile string
+}
+
+func NewMariadbBinlogCheckpointEvent() *MariadbBinlogCheckpointEvent {
+	return &MariadbBinlogCheckpointEvent{
+		BaseEvent: NewBaseEvent(),
+		logFile:   "",
+	}
+}
+
+func (this *MariadbBinlogCheckpointEvent) GetLogFile() string {
+	return this.logFile
+}
+
+func (this *MariadbBinlogCheckpointEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	if len(body) < 4 {
+		return fmt.Errorf("mariadb binlog checkpoint event too short, length: %d", len(body))
+	}
+	length := int(binary.LittleEndian.Uint32(body[0:4]))
+	if len(body) < 4+length {
+		return fmt.Errorf("mariadb binlog checkpoint event too short, name length: %d, length: %d", length, len(body))
+	}
+	this.logFile = string(body[4 : 4+length])
+	return nil
+}
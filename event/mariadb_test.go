@@ -0,0 +1,49 @@
+package event
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/goMySQLSemiSync/constants"
+)
+
+func TestMariadbGtidEventDecode(t *testing.T) {
+	body := make([]byte, 21)
+	binary.LittleEndian.PutUint64(body[0:8], 100)
+	binary.LittleEndian.PutUint32(body[8:12], 2)
+	body[12] = MARIADB_FL_GROUP_COMMIT_ID | MARIADB_FL_TRANSACTIONAL
+	binary.LittleEndian.PutUint64(body[13:21], 7)
+	data := buildTestEvent(constants.MARIADB_GTID_EVENT, body)
+	binary.LittleEndian.PutUint32(data[5:9], 3)
+
+	decoder := NewDecoder()
+	decoder.SetChecksumAlg(constants.BINLOG_CHECKSUM_ALG_OFF)
+	ev, err := decoder.Decode(data)
+	if err != nil {
+		t.Fatalf("decode mariadb gtid event error: %v", err)
+	}
+	gtidEvent := ev.(*MariadbGtidEvent)
+	if gtidEvent.GetGtid() != "2-3-100" || gtidEvent.GetCommitId() != 7 || gtidEvent.IsStandalone() {
+		t.Errorf("unexpected mariadb gtid event %s, commit id %d", gtidEvent.GetGtid(), gtidEvent.GetCommitId())
+	}
+}
+
+func TestMariadbGtidListEventDecode(t *testing.T) {
+	body := make([]byte, 4+16*2)
+	binary.LittleEndian.PutUint32(body[0:4], 2)
+	binary.LittleEndian.PutUint32(body[4:8], 0)
+	binary.LittleEndian.PutUint32(body[8:12], 1)
+	binary.LittleEndian.PutUint64(body[12:20], 10)
+	binary.LittleEndian.PutUint32(body[20:24], 0)
+	binary.LittleEndian.PutUint32(body[24:28], 2)
+	binary.LittleEndian.PutUint64(body[28:36], 12)
+
+	ev := NewMariadbGtidListEvent()
+	err := ev.Decode(NewFormatDescriptionEvent(), body)
+	if err != nil {
+		t.Fatalf("decode mariadb gtid list event error: %v", err)
+	}
+	if len(ev.GetGtids()) != 2 || ev.GetGtidSet().String() != "0-2-12" {
+		t.Errorf("unexpected mariadb gtid list %s", ev.GetGtidSet().String())
+	}
+}
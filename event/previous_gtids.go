@@ -0,0 +1,38 @@
+package event
+
+import (
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+/*
+* PREVIOUS_GTIDS_LOG_EVENT, 每个 binlog 文件的第二个 event, 记录该文件之前的所有 gtid
+* 8              n_sids
+* 16             sid
+* 8              n_intervals
+* 8              start, 包含
+* 8              end, 不包含
+ */
+type PreviousGtidsEvent struct {
+	*BaseEvent
+	gtidSet *protocol.GtidSet
+}
+
+func NewPreviousGtidsEvent() *PreviousGtidsEvent {
+	return &PreviousGtidsEvent{
+		BaseEvent: NewBaseEvent(),
+		gtidSet:   protocol.NewGtidSet(),
+	}
+}
+
+func (this *PreviousGtidsEvent) GetGtidSet() *protocol.GtidSet {
+	return this.gtidSet
+}
+
+func (this *PreviousGtidsEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	gtidSet, err := protocol.DecodeGtidSet(body)
+	if err != nil {
+		return err
+	}
+	this.gtidSet = gtidSet
+	return nil
+}
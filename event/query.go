@@ -0,0 +1,314 @@
+package event
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/goMySQLSemiSync/constants"
+	"github.com/goMySQLSemiSync/protocol"
+	"strings"
+)
+
+const QUERY_HEADER_LENGTH = 13
+
+// QUERY_EVENT status variable 类型
+const (
+	Q_FLAGS2_CODE                     = 0
+	Q_SQL_MODE_CODE                   = 1
+	Q_CATALOG_CODE                    = 2
+	Q_AUTO_INCREMENT                  = 3
+	Q_CHARSET_CODE                    = 4
+	Q_TIME_ZONE_CODE                  = 5
+	Q_CATALOG_NZ_CODE                 = 6
+	Q_LC_TIME_NAMES_CODE              = 7
+	Q_CHARSET_DATABASE_CODE           = 8
+	Q_TABLE_MAP_FOR_UPDATE_CODE       = 9
+	Q_MASTER_DATA_WRITTEN_CODE        = 10
+	Q_INVOKER                         = 11
+	Q_UPDATED_DB_NAMES                = 12
+	Q_MICROSECONDS                    = 13
+	Q_COMMIT_TS                       = 14
+	Q_COMMIT_TS2                      = 15
+	Q_EXPLICIT_DEFAULTS_FOR_TIMESTAMP = 16
+	Q_DDL_LOGGED_WITH_XID             = 17
+	Q_DEFAULT_COLLATION_FOR_UTF8MB4   = 18
+	Q_SQL_REQUIRE_PRIMARY_KEY         = 19
+	Q_DEFAULT_TABLE_ENCRYPTION        = 20
+	Q_HRNOW                           = 128 // MariaDB
+	Q_XID                             = 129 // MariaDB
+
+	// Q_UPDATED_DB_NAMES 中库的个数超过该值时不记录库名
+	OVER_MAX_DBS_IN_EVENT_MTS = 254
+)
+
+/*
+* QUERY_EVENT 的 status variables, 没有出现的变量为零值
+ */
+type QueryStatusVars struct {
+	Flags2                    uint32
+	SqlMode                   uint64
+	Catalog                   string
+	AutoIncrementIncrement    uint16
+	AutoIncrementOffset       uint16
+	CharsetClient             uint16
+	CollationConnection       uint16
+	CollationServer           uint16
+	TimeZone                  string
+	LcTimeNamesNumber         uint16
+	CharsetDatabaseNumber     uint16
+	TableMapForUpdate         uint64
+	MasterDataWritten         uint32
+	InvokerUser               string
+	InvokerHost               string
+	UpdatedDbNames            []string
+	Microseconds              uint32
+	ExplicitDefaultsTimestamp bool
+	DdlXid                    uint64
+	DefaultCollationUtf8mb4   uint16
+	SqlRequirePrimaryKey      uint8
+	DefaultTableEncryption    uint8
+	Hrnow                     uint32
+	Xid                       uint64
+}
+
+/*
+* QUERY_EVENT
+* https://dev.mysql.com/doc/internals/en/query-event.html
+* post-header:
+* 4              slave_proxy_id
+* 4              execution time
+* 1              schema length
+* 2              error-code
+* 2              status-vars length, binlog v4
+* payload:
+* string[$len]   status-vars
+* string[$len]   schema
+* 1              [00]
+* string[EOF]    query
+ */
+type QueryEvent struct {
+	*BaseEvent
+	threadId   uint32
+	execTime   uint32
+	errorCode  uint16
+	statusVars *QueryStatusVars
+	schema     string
+	query      string
+}
+
+func NewQueryEvent() *QueryEvent {
+	return &QueryEvent{
+		BaseEvent:  NewBaseEvent(),
+		threadId:   0,
+		execTime:   0,
+		errorCode:  0,
+		statusVars: &QueryStatusVars{},
+		schema:     "",
+		query:      "",
+	}
+}
+
+func (this *QueryEvent) GetThreadId() uint32 {
+	return this.threadId
+}
+
+func (this *QueryEvent) GetExecTime() uint32 {
+	return this.execTime
+}
+
+func (this *QueryEvent) GetErrorCode() uint16 {
+	return this.errorCode
+}
+
+func (this *QueryEvent) GetStatusVars() *QueryStatusVars {
+	return this.statusVars
+}
+
+func (this *QueryEvent) GetSchema() string {
+	return this.schema
+}
+
+func (this *QueryEvent) GetQuery() string {
+	return this.query
+}
+
+/*
+* 事务开始, 之后的 event 直到 XID_EVENT 或 COMMIT 属于同一个事务
+ */
+func (this *QueryEvent) IsBegin() bool {
+	return strings.EqualFold(strings.TrimSpace(this.query), "BEGIN")
+}
+
+/*
+* 非事务引擎的事务以 COMMIT 结束, 而不是 XID_EVENT
+ */
+func (this *QueryEvent) IsCommit() bool {
+	return strings.EqualFold(strings.TrimSpace(this.query), "COMMIT")
+}
+
+func (this *QueryEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	postHeaderLength := format.GetPostHeaderLength(constants.QUERY_EVENT, QUERY_HEADER_LENGTH)
+	if postHeaderLength < QUERY_HEADER_LENGTH-2 || len(body) < postHeaderLength {
+		return fmt.Errorf("query event too short, length: %d", len(body))
+	}
+	proto := protocol.NewProto(body, 0)
+	this.threadId = uint32(proto.Get_fixed_int(4))
+	this.execTime = uint32(proto.Get_fixed_int(4))
+	schemaLength := proto.Get_fixed_int(1)
+	this.errorCode = uint16(proto.Get_fixed_int(2))
+	statusVarsLength := 0
+	if postHeaderLength >= QUERY_HEADER_LENGTH {
+		statusVarsLength = proto.Get_fixed_int(2)
+	}
+
+	pos := postHeaderLength
+	if len(body) < pos+statusVarsLength+schemaLength+1 {
+		return fmt.Errorf("query event too short, length: %d", len(body))
+	}
+	err := this.decodeStatusVars(body[pos : pos+statusVarsLength])
+	if err != nil {
+		return err
+	}
+	pos += statusVarsLength
+	this.schema = string(body[pos : pos+schemaLength])
+	pos += schemaLength + 1
+	this.query = string(body[pos:])
+	return nil
+}
+
+/*
+* status variable 为 1 字节类型 + 值, 遇到不认识的类型时无法得知值的长度, 停止解析
+ */
+func (this *QueryEvent) decodeStatusVars(data []byte) error {
+	vars := this.statusVars
+	proto := protocol.NewProto(data, 0)
+	need := func(size int) error {
+		if proto.GetOffset()+size > len(data) {
+			return fmt.Errorf("query event status vars too short, length: %d", len(data))
+		}
+		return nil
+	}
+	for proto.Has_remaining_data() {
+		code := proto.Get_fixed_int(1)
+		var err error
+		switch code {
+		case Q_FLAGS2_CODE:
+			if err = need(4); err == nil {
+				vars.Flags2 = uint32(proto.Get_fixed_int(4))
+			}
+		case Q_SQL_MODE_CODE:
+			if err = need(8); err == nil {
+				vars.SqlMode = uint64(proto.Get_fixed_int(8))
+			}
+		case Q_CATALOG_CODE:
+			if err = need(1); err == nil {
+				length := proto.Get_fixed_int(1)
+				if err = need(length + 1); err == nil {
+					vars.Catalog = proto.Get_fixed_str(length)
+					proto.Get_filler(1)
+				}
+			}
+		case Q_AUTO_INCREMENT:
+			if err = need(4); err == nil {
+				vars.AutoIncrementIncrement = uint16(proto.Get_fixed_int(2))
+				vars.AutoIncrementOffset = uint16(proto.Get_fixed_int(2))
+			}
+		case Q_CHARSET_CODE:
+			if err = need(6); err == nil {
+				vars.CharsetClient = uint16(proto.Get_fixed_int(2))
+				vars.CollationConnection = uint16(proto.Get_fixed_int(2))
+				vars.CollationServer = uint16(proto.Get_fixed_int(2))
+			}
+		case Q_TIME_ZONE_CODE:
+			vars.TimeZone, err = readLengthPrefixedStr(proto, need)
+		case Q_CATALOG_NZ_CODE:
+			vars.Catalog, err = readLengthPrefixedStr(proto, need)
+		case Q_LC_TIME_NAMES_CODE:
+			if err = need(2); err == nil {
+				vars.LcTimeNamesNumber = uint16(proto.Get_fixed_int(2))
+			}
+		case Q_CHARSET_DATABASE_CODE:
+			if err = need(2); err == nil {
+				vars.CharsetDatabaseNumber = uint16(proto.Get_fixed_int(2))
+			}
+		case Q_TABLE_MAP_FOR_UPDATE_CODE:
+			if err = need(8); err == nil {
+				vars.TableMapForUpdate = uint64(proto.Get_fixed_int(8))
+			}
+		case Q_MASTER_DATA_WRITTEN_CODE:
+			if err = need(4); err == nil {
+				vars.MasterDataWritten = uint32(proto.Get_fixed_int(4))
+			}
+		case Q_INVOKER:
+			vars.InvokerUser, err = readLengthPrefixedStr(proto, need)
+			if err == nil {
+				vars.InvokerHost, err = readLengthPrefixedStr(proto, need)
+			}
+		case Q_UPDATED_DB_NAMES:
+			if err = need(1); err == nil {
+				count := proto.Get_fixed_int(1)
+				vars.UpdatedDbNames = make([]string, 0)
+				if count < OVER_MAX_DBS_IN_EVENT_MTS {
+					for i := 0; i < count && err == nil; i++ {
+						end := bytes.IndexByte(data[proto.GetOffset():], 0x00)
+						if end < 0 {
+							err = fmt.Errorf("query event updated db names not terminated")
+							break
+						}
+						vars.UpdatedDbNames = append(vars.UpdatedDbNames, proto.Get_null_str())
+					}
+				}
+			}
+		case Q_MICROSECONDS:
+			if err = need(3); err == nil {
+				vars.Microseconds = uint32(proto.Get_fixed_int(3))
+			}
+		case Q_EXPLICIT_DEFAULTS_FOR_TIMESTAMP:
+			if err = need(1); err == nil {
+				vars.ExplicitDefaultsTimestamp = proto.Get_fixed_int(1) == 1
+			}
+		case Q_DDL_LOGGED_WITH_XID:
+			if err = need(8); err == nil {
+				vars.DdlXid = uint64(proto.Get_fixed_int(8))
+			}
+		case Q_DEFAULT_COLLATION_FOR_UTF8MB4:
+			if err = need(2); err == nil {
+				vars.DefaultCollationUtf8mb4 = uint16(proto.Get_fixed_int(2))
+			}
+		case Q_SQL_REQUIRE_PRIMARY_KEY:
+			if err = need(1); err == nil {
+				vars.SqlRequirePrimaryKey = uint8(proto.Get_fixed_int(1))
+			}
+		case Q_DEFAULT_TABLE_ENCRYPTION:
+			if err = need(1); err == nil {
+				vars.DefaultTableEncryption = uint8(proto.Get_fixed_int(1))
+			}
+		case Q_HRNOW:
+			if err = need(3); err == nil {
+				vars.Hrnow = uint32(proto.Get_fixed_int(3))
+			}
+		case Q_XID:
+			if err = need(8); err == nil {
+				vars.Xid = uint64(proto.Get_fixed_int(8))
+			}
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readLengthPrefixedStr(proto *protocol.Proto, need func(size int) error) (string, error) {
+	err := need(1)
+	if err != nil {
+		return "", err
+	}
+	length := proto.Get_fixed_int(1)
+	err = need(length)
+	if err != nil {
+		return "", err
+	}
+	return proto.Get_fixed_str(length), nil
+}
@@ -0,0 +1,151 @@
+package event
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/goMySQLSemiSync/constants"
+)
+
+func buildTestQueryBody(schema string, statusVars []byte, query string) []byte {
+	// thread id 7, exec time 1, error code 0
+	body := []byte{0x07, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, byte(len(schema)), 0x00, 0x00}
+	body = append(body, byte(len(statusVars)), byte(len(statusVars)>>8))
+	body = append(body, statusVars...)
+	body = append(body, schema...)
+	body = append(body, 0x00)
+	return append(body, query...)
+}
+
+func TestQueryEventDecode(t *testing.T) {
+	// 8.0 DDL
+	ddlVars := []byte{
+		Q_FLAGS2_CODE, 0x00, 0x00, 0x00, 0x00,
+		Q_SQL_MODE_CODE, 0x20, 0x00, 0xa0, 0x45, 0x00, 0x00, 0x00, 0x00,
+		Q_CATALOG_NZ_CODE, 0x03, 's', 't', 'd',
+		Q_CHARSET_CODE, 0x21, 0x00, 0x21, 0x00, 0xff, 0x00,
+		Q_UPDATED_DB_NAMES, 0x01, 't', 'e', 's', 't', 0x00,
+		Q_DDL_LOGGED_WITH_XID, 0x2a, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		Q_DEFAULT_COLLATION_FOR_UTF8MB4, 0xff, 0x00,
+		Q_SQL_REQUIRE_PRIMARY_KEY, 0x00,
+		Q_DEFAULT_TABLE_ENCRYPTION, 0x01,
+	}
+	// 5.7 存储过程中的 DML
+	dmlVars := []byte{
+		Q_FLAGS2_CODE, 0x00, 0x00, 0x00, 0x00,
+		Q_AUTO_INCREMENT, 0x02, 0x00, 0x01, 0x00,
+		Q_TIME_ZONE_CODE, 0x06, 'S', 'Y', 'S', 'T', 'E', 'M',
+		Q_LC_TIME_NAMES_CODE, 0x01, 0x00,
+		Q_CHARSET_DATABASE_CODE, 0x2d, 0x00,
+		Q_TABLE_MAP_FOR_UPDATE_CODE, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		Q_INVOKER, 0x04, 'r', 'o', 'o', 't', 0x09, 'l', 'o', 'c', 'a', 'l', 'h', 'o', 's', 't',
+		Q_MICROSECONDS, 0x40, 0xe2, 0x01,
+		Q_EXPLICIT_DEFAULTS_FOR_TIMESTAMP, 0x01,
+	}
+	// MariaDB
+	mariadbVars := []byte{
+		Q_CATALOG_CODE, 0x03, 's', 't', 'd', 0x00,
+		Q_HRNOW, 0x01, 0x02, 0x03,
+		Q_XID, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+
+	tests := []struct {
+		name       string
+		body       []byte
+		schema     string
+		query      string
+		statusVars *QueryStatusVars
+	}{
+		{"8.0 ddl", buildTestQueryBody("test", ddlVars, "CREATE TABLE t1 (id int)"), "test", "CREATE TABLE t1 (id int)", &QueryStatusVars{
+			SqlMode:                 0x45a00020,
+			Catalog:                 "std",
+			CharsetClient:           33,
+			CollationConnection:     33,
+			CollationServer:         255,
+			UpdatedDbNames:          []string{"test"},
+			DdlXid:                  42,
+			DefaultCollationUtf8mb4: 255,
+			DefaultTableEncryption:  1,
+		}},
+		{"5.7 dml in procedure", buildTestQueryBody("", dmlVars, "BEGIN"), "", "BEGIN", &QueryStatusVars{
+			AutoIncrementIncrement:    2,
+			AutoIncrementOffset:       1,
+			TimeZone:                  "SYSTEM",
+			LcTimeNamesNumber:         1,
+			CharsetDatabaseNumber:     45,
+			TableMapForUpdate:         3,
+			InvokerUser:               "root",
+			InvokerHost:               "localhost",
+			Microseconds:              123456,
+			ExplicitDefaultsTimestamp: true,
+		}},
+		{"mariadb", buildTestQueryBody("db", mariadbVars, "COMMIT"), "db", "COMMIT", &QueryStatusVars{
+			Catalog: "std",
+			Hrnow:   0x030201,
+			Xid:     5,
+		}},
+		{"updated db names over max", buildTestQueryBody("test", []byte{Q_UPDATED_DB_NAMES, OVER_MAX_DBS_IN_EVENT_MTS}, "DROP DATABASE a"), "test", "DROP DATABASE a", &QueryStatusVars{
+			UpdatedDbNames: []string{},
+		}},
+		// 不认识的类型之后的 status vars 被忽略, schema 和 query 按 status-vars length 定位
+		{"unknown status var", buildTestQueryBody("test", []byte{Q_MICROSECONDS, 0x01, 0x00, 0x00, 0x7f, 0x01, Q_XID}, "BEGIN"), "test", "BEGIN", &QueryStatusVars{
+			Microseconds: 1,
+		}},
+	}
+
+	for _, tt := range tests {
+		ev := NewQueryEvent()
+		if err := ev.Decode(NewFormatDescriptionEvent(), tt.body); err != nil {
+			t.Errorf("%s: decode error: %v", tt.name, err)
+			continue
+		}
+		if ev.GetThreadId() != 7 || ev.GetExecTime() != 1 || ev.GetErrorCode() != 0 {
+			t.Errorf("%s: unexpected post-header: thread id %d, exec time %d, error code %d", tt.name, ev.GetThreadId(), ev.GetExecTime(), ev.GetErrorCode())
+		}
+		if ev.GetSchema() != tt.schema || ev.GetQuery() != tt.query {
+			t.Errorf("%s: expect %s / %s, got %s / %s", tt.name, tt.schema, tt.query, ev.GetSchema(), ev.GetQuery())
+		}
+		if !reflect.DeepEqual(ev.GetStatusVars(), tt.statusVars) {
+			t.Errorf("%s: expect status vars %+v, got %+v", tt.name, tt.statusVars, ev.GetStatusVars())
+		}
+	}
+}
+
+func TestQueryEventInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"truncated post-header", buildTestQueryBody("test", nil, "BEGIN")[:12]},
+		{"status vars over event", buildTestQueryBody("test", nil, "")[:13]},
+		{"truncated sql mode", buildTestQueryBody("test", []byte{Q_SQL_MODE_CODE, 0x00, 0x00}, "BEGIN")},
+		{"truncated invoker host", buildTestQueryBody("test", []byte{Q_INVOKER, 0x01, 'r', 0x05, 'l'}, "BEGIN")},
+		{"updated db names not terminated", buildTestQueryBody("test", []byte{Q_UPDATED_DB_NAMES, 0x01, 't'}, "BEGIN")},
+	}
+	for _, tt := range tests {
+		if err := NewQueryEvent().Decode(NewFormatDescriptionEvent(), tt.body); err == nil {
+			t.Errorf("%s: expect error", tt.name)
+		}
+	}
+}
+
+/*
+* binlog v3 的 QUERY_EVENT post-header 为 11 字节, 没有 status vars
+ */
+func TestQueryEventWithoutStatusVars(t *testing.T) {
+	lengths := append([]byte(nil), testPostHeaderLengths55...)
+	lengths[constants.QUERY_EVENT-1] = QUERY_HEADER_LENGTH - 2
+	format := NewFormatDescriptionEvent()
+	if err := format.Decode(nil, buildTestFormatDescriptionBody("5.0.96-log", lengths, false, 0)); err != nil {
+		t.Fatalf("decode format description event error: %v", err)
+	}
+	body := []byte{0x07, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00}
+	body = append(body, "test\x00BEGIN"...)
+	ev := NewQueryEvent()
+	if err := ev.Decode(format, body); err != nil {
+		t.Fatalf("decode query event error: %v", err)
+	}
+	if ev.GetSchema() != "test" || !ev.IsBegin() {
+		t.Errorf("expect BEGIN in test, got %s in %s", ev.GetQuery(), ev.GetSchema())
+	}
+}
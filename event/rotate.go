@@ -0,0 +1,54 @@
+package event
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/goMySQLSemiSync/constants"
+)
+
+const ROTATE_HEADER_LENGTH = 8
+
+/*
+* ROTATE_EVENT
+* 8              position, 下一个 binlog 文件的起始位置
+* string[EOF]    下一个 binlog 文件名
+*
+* 真实的 rotate 写在 binlog 文件的最后, 表示切换到下一个文件
+* fake rotate 由 master 在 dump 开始时和切换文件后发送, 带有 LOG_EVENT_ARTIFICIAL_F, 老版本的 timestamp 为 0, 不属于任何 binlog 文件
+ */
+type RotateEvent struct {
+	*BaseEvent
+	position    uint64
+	nextLogName string
+}
+
+func NewRotateEvent() *RotateEvent {
+	return &RotateEvent{
+		BaseEvent:   NewBaseEvent(),
+		position:    0,
+		nextLogName: "",
+	}
+}
+
+func (this *RotateEvent) GetPosition() uint64 {
+	return this.position
+}
+
+func (this *RotateEvent) GetNextLogName() string {
+	return this.nextLogName
+}
+
+func (this *RotateEvent) IsArtificial() bool {
+	header := this.GetHeader()
+	return int(header.Flags)&constants.LOG_EVENT_ARTIFICIAL_F != 0 || header.Timestamp == 0
+}
+
+func (this *RotateEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	postHeaderLength := format.GetPostHeaderLength(constants.ROTATE_EVENT, ROTATE_HEADER_LENGTH)
+	if postHeaderLength < ROTATE_HEADER_LENGTH || len(body) < postHeaderLength {
+		return fmt.Errorf("rotate event too short, length: %d", len(body))
+	}
+	this.position = binary.LittleEndian.Uint64(body[0:8])
+	this.nextLogName = string(body[postHeaderLength:])
+	return nil
+}
@@ -0,0 +1,535 @@
+package event
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/goMySQLSemiSync/protocol"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// 0 值的 DATETIME / TIMESTAMP
+	ZERO_DATETIME = "0000-00-00 00:00:00"
+
+	DIG_PER_DEC       = 9
+	DATETIMEF_INT_OFS = 0x8000000000
+	TIMEF_INT_OFS     = 0x800000
+	TIMEF_OFS         = 0x800000000000
+)
+
+// NEWDECIMAL 中不足 9 位的数字占用的字节数
+var decimalDigitsToBytes = []int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+/*
+* 解码 rows event 中的一个列值, 返回 Go 值和占用的字节数
+* columnType 和 meta 取自 TABLE_MAP_EVENT, unsigned 取自 TABLE_MAP_EVENT 的 SIGNEDNESS optional metadata
+*
+* 整数: int8/16/32/64, unsigned 时为 uint8/16/32/64, MEDIUMINT 为 int32/uint32
+* FLOAT / DOUBLE: float32 / float64
+* DECIMAL: 精确的十进制 string
+* DATE / TIME / DATETIME / TIMESTAMP: MySQL 格式的 string, TIMESTAMP 为 UTC
+* YEAR: int, ENUM: 序号 int64, SET / BIT: int64
+* CHAR / VARCHAR: string, BLOB / TEXT / GEOMETRY: []byte, JSON: 文本 JSON string
+ */
+func decodeValue(data []byte, columnType int, meta uint16, unsigned bool) (interface{}, int, error) {
+	length := 0
+	if columnType == protocol.MYSQL_TYPE_STRING {
+		columnType, length = decodeStringMeta(meta)
+	}
+
+	switch columnType {
+	case protocol.MYSQL_TYPE_NULL:
+		return nil, 0, nil
+	case protocol.MYSQL_TYPE_TINY:
+		if err := needBytes(data, 1); err != nil {
+			return nil, 0, err
+		}
+		if unsigned {
+			return uint8(data[0]), 1, nil
+		}
+		return int8(data[0]), 1, nil
+	case protocol.MYSQL_TYPE_SHORT:
+		if err := needBytes(data, 2); err != nil {
+			return nil, 0, err
+		}
+		v := binary.LittleEndian.Uint16(data)
+		if unsigned {
+			return v, 2, nil
+		}
+		return int16(v), 2, nil
+	case protocol.MYSQL_TYPE_INT24:
+		if err := needBytes(data, 3); err != nil {
+			return nil, 0, err
+		}
+		v := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+		if unsigned {
+			return v, 3, nil
+		}
+		if v&0x800000 != 0 {
+			v |= 0xff000000
+		}
+		return int32(v), 3, nil
+	case protocol.MYSQL_TYPE_LONG:
+		if err := needBytes(data, 4); err != nil {
+			return nil, 0, err
+		}
+		v := binary.LittleEndian.Uint32(data)
+		if unsigned {
+			return v, 4, nil
+		}
+		return int32(v), 4, nil
+	case protocol.MYSQL_TYPE_LONGLONG:
+		if err := needBytes(data, 8); err != nil {
+			return nil, 0, err
+		}
+		v := binary.LittleEndian.Uint64(data)
+		if unsigned {
+			return v, 8, nil
+		}
+		return int64(v), 8, nil
+	case protocol.MYSQL_TYPE_FLOAT:
+		if err := needBytes(data, 4); err != nil {
+			return nil, 0, err
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(data)), 4, nil
+	case protocol.MYSQL_TYPE_DOUBLE:
+		if err := needBytes(data, 8); err != nil {
+			return nil, 0, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), 8, nil
+	case protocol.MYSQL_TYPE_YEAR:
+		if err := needBytes(data, 1); err != nil {
+			return nil, 0, err
+		}
+		if data[0] == 0 {
+			return 0, 1, nil
+		}
+		return int(data[0]) + 1900, 1, nil
+	case protocol.MYSQL_TYPE_VARCHAR, protocol.MYSQL_TYPE_VAR_STRING:
+		return decodeString(data, int(meta))
+	case protocol.MYSQL_TYPE_STRING:
+		return decodeString(data, length)
+	case protocol.MYSQL_TYPE_ENUM:
+		return decodeEnum(data, length)
+	case protocol.MYSQL_TYPE_SET:
+		return decodeSet(data, length)
+	case protocol.MYSQL_TYPE_BIT:
+		nbits := int(meta>>8)*8 + int(meta&0xff)
+		return decodeBitValue(data, (nbits+7)/8)
+	case protocol.MYSQL_TYPE_BLOB, protocol.MYSQL_TYPE_TINY_BLOB, protocol.MYSQL_TYPE_MEDIUM_BLOB,
+		protocol.MYSQL_TYPE_LONG_BLOB, protocol.MYSQL_TYPE_GEOMETRY:
+		return decodeBlob(data, int(meta))
+	case protocol.MYSQL_TYPE_JSON:
+		value, size, err := decodeBlob(data, int(meta))
+		if err != nil {
+			return nil, 0, err
+		}
+		text, err := DecodeJSON(value.([]byte))
+		if err != nil {
+			return nil, 0, err
+		}
+		return text, size, nil
+	case protocol.MYSQL_TYPE_NEWDECIMAL:
+		return decodeNewDecimal(data, int(meta>>8), int(meta&0xff))
+	case protocol.MYSQL_TYPE_TIMESTAMP:
+		return decodeTimestamp(data)
+	case protocol.MYSQL_TYPE_TIMESTAMP2:
+		return decodeTimestamp2(data, int(meta))
+	case protocol.MYSQL_TYPE_DATETIME:
+		return decodeDatetime(data)
+	case protocol.MYSQL_TYPE_DATETIME2:
+		return decodeDatetime2(data, int(meta))
+	case protocol.MYSQL_TYPE_TIME:
+		return decodeTime(data)
+	case protocol.MYSQL_TYPE_TIME2:
+		return decodeTime2(data, int(meta))
+	case protocol.MYSQL_TYPE_DATE, protocol.MYSQL_TYPE_NEWDATE:
+		return decodeDate(data)
+	}
+	return nil, 0, fmt.Errorf("unsupported column type %d", columnType)
+}
+
+func needBytes(data []byte, size int) error {
+	if len(data) < size {
+		return fmt.Errorf("column value too short, need %d bytes, but got %d", size, len(data))
+	}
+	return nil
+}
+
+/*
+* MYSQL_TYPE_STRING 的 metadata: 第一个字节为真实类型, 第二个字节为长度
+* 长度超过 255 的 CHAR 列, 长度的高 2 位异或保存在真实类型的第 4, 5 位
+ */
+func decodeStringMeta(meta uint16) (int, int) {
+	realType := int(meta >> 8)
+	length := int(meta & 0xff)
+	if realType&0x30 != 0x30 {
+		length |= ((realType & 0x30) ^ 0x30) << 4
+		realType |= 0x30
+	}
+	return realType, length
+}
+
+/*
+* 最大长度小于 256 时为 1 字节长度 + 数据, 否则为 2 字节长度 + 数据
+ */
+func decodeString(data []byte, maxLength int) (interface{}, int, error) {
+	prefix := 1
+	if maxLength >= 256 {
+		prefix = 2
+	}
+	if err := needBytes(data, prefix); err != nil {
+		return nil, 0, err
+	}
+	size := int(data[0])
+	if prefix == 2 {
+		size = int(binary.LittleEndian.Uint16(data))
+	}
+	if err := needBytes(data, prefix+size); err != nil {
+		return nil, 0, err
+	}
+	return string(data[prefix : prefix+size]), prefix + size, nil
+}
+
+/*
+* ENUM 为 1 或 2 字节的序号, 从 1 开始
+ */
+func decodeEnum(data []byte, size int) (interface{}, int, error) {
+	if size != 1 && size != 2 {
+		return nil, 0, fmt.Errorf("invalid enum length %d", size)
+	}
+	if err := needBytes(data, size); err != nil {
+		return nil, 0, err
+	}
+	if size == 1 {
+		return int64(data[0]), 1, nil
+	}
+	return int64(binary.LittleEndian.Uint16(data)), 2, nil
+}
+
+/*
+* SET 为 1-8 字节 little-endian 的 bitmap, 第 i 位表示包含第 i 个值
+ */
+func decodeSet(data []byte, size int) (interface{}, int, error) {
+	if size < 1 || size > 8 {
+		return nil, 0, fmt.Errorf("invalid set length %d", size)
+	}
+	if err := needBytes(data, size); err != nil {
+		return nil, 0, err
+	}
+	var v int64
+	for i := size - 1; i >= 0; i-- {
+		v = v<<8 | int64(data[i])
+	}
+	return v, size, nil
+}
+
+/*
+* BIT 为 big-endian
+ */
+func decodeBitValue(data []byte, size int) (interface{}, int, error) {
+	if size < 1 || size > 8 {
+		return nil, 0, fmt.Errorf("invalid bit length %d", size)
+	}
+	if err := needBytes(data, size); err != nil {
+		return nil, 0, err
+	}
+	var v int64
+	for i := 0; i < size; i++ {
+		v = v<<8 | int64(data[i])
+	}
+	return v, size, nil
+}
+
+/*
+* BLOB / TEXT / GEOMETRY / JSON: meta 字节的长度 + 数据
+ */
+func decodeBlob(data []byte, lengthSize int) (interface{}, int, error) {
+	if lengthSize < 1 || lengthSize > 4 {
+		return nil, 0, fmt.Errorf("invalid blob length size %d", lengthSize)
+	}
+	if err := needBytes(data, lengthSize); err != nil {
+		return nil, 0, err
+	}
+	size := 0
+	for i := lengthSize - 1; i >= 0; i-- {
+		size = size<<8 | int(data[i])
+	}
+	if err := needBytes(data, lengthSize+size); err != nil {
+		return nil, 0, err
+	}
+	return data[lengthSize : lengthSize+size], lengthSize + size, nil
+}
+
+/*
+* NEWDECIMAL: 整数部分和小数部分各自按 9 位十进制一组, 每组 4 字节 big-endian, 不足 9 位的部分按 decimalDigitsToBytes 压缩
+* 第一个字节的最高位为符号位, 1 表示非负; 负数所有字节按位取反
+ */
+func decodeNewDecimal(data []byte, precision int, scale int) (interface{}, int, error) {
+	if precision <= 0 || scale < 0 || scale > precision {
+		return nil, 0, fmt.Errorf("invalid decimal precision %d scale %d", precision, scale)
+	}
+	integral := precision - scale
+	uncompIntegral := integral / DIG_PER_DEC
+	compIntegral := integral % DIG_PER_DEC
+	uncompFractional := scale / DIG_PER_DEC
+	compFractional := scale % DIG_PER_DEC
+	size := uncompIntegral*4 + decimalDigitsToBytes[compIntegral] + uncompFractional*4 + decimalDigitsToBytes[compFractional]
+	if err := needBytes(data, size); err != nil {
+		return nil, 0, err
+	}
+
+	buf := make([]byte, size)
+	copy(buf, data[:size])
+	var mask byte = 0
+	negative := buf[0]&0x80 == 0
+	if negative {
+		mask = 0xff
+	}
+	buf[0] ^= 0x80
+	for i := range buf {
+		buf[i] ^= mask
+	}
+
+	var res bytes.Buffer
+	pos := 0
+	readGroup := func(n int) uint32 {
+		var v uint32
+		for i := 0; i < n; i++ {
+			v = v<<8 | uint32(buf[pos+i])
+		}
+		pos += n
+		return v
+	}
+
+	var intPart bytes.Buffer
+	intPart.WriteString(fmt.Sprintf("%d", readGroup(decimalDigitsToBytes[compIntegral])))
+	for i := 0; i < uncompIntegral; i++ {
+		intPart.WriteString(fmt.Sprintf("%09d", readGroup(4)))
+	}
+	intStr := strings.TrimLeft(intPart.String(), "0")
+	if intStr == "" {
+		intStr = "0"
+	}
+
+	if negative {
+		res.WriteString("-")
+	}
+	res.WriteString(intStr)
+	if scale > 0 {
+		res.WriteString(".")
+		for i := 0; i < uncompFractional; i++ {
+			res.WriteString(fmt.Sprintf("%09d", readGroup(4)))
+		}
+		if compFractional > 0 {
+			res.WriteString(fmt.Sprintf("%0*d", compFractional, readGroup(decimalDigitsToBytes[compFractional])))
+		}
+	}
+	return res.String(), size, nil
+}
+
+/*
+* TIMESTAMP2 / DATETIME2 / TIME2 的小数秒: fsp 1-2 为 1 字节, 3-4 为 2 字节, 5-6 为 3 字节, big-endian
+* 返回微秒
+ */
+func decodeFractionalSeconds(data []byte, fsp int) (int, int, error) {
+	if fsp < 0 || fsp > 6 {
+		return 0, 0, fmt.Errorf("invalid fractional seconds precision %d", fsp)
+	}
+	size := (fsp + 1) / 2
+	if err := needBytes(data, size); err != nil {
+		return 0, 0, err
+	}
+	v := 0
+	for i := 0; i < size; i++ {
+		v = v<<8 | int(data[i])
+	}
+	switch size {
+	case 1:
+		v *= 10000
+	case 2:
+		v *= 100
+	}
+	return v, size, nil
+}
+
+/*
+* 按 fsp 位输出小数秒, fsp 为 0 时不输出
+ */
+func formatFractionalSeconds(usec int, fsp int) string {
+	if fsp <= 0 {
+		return ""
+	}
+	for i := fsp; i < 6; i++ {
+		usec /= 10
+	}
+	return fmt.Sprintf(".%0*d", fsp, usec)
+}
+
+/*
+* TIMESTAMP: 4 字节 little-endian 的 unix 时间戳
+ */
+func decodeTimestamp(data []byte) (interface{}, int, error) {
+	if err := needBytes(data, 4); err != nil {
+		return nil, 0, err
+	}
+	sec := binary.LittleEndian.Uint32(data)
+	if sec == 0 {
+		return ZERO_DATETIME, 4, nil
+	}
+	return time.Unix(int64(sec), 0).UTC().Format("2006-01-02 15:04:05"), 4, nil
+}
+
+/*
+* TIMESTAMP2: 4 字节 big-endian 的 unix 时间戳 + 小数秒
+ */
+func decodeTimestamp2(data []byte, fsp int) (interface{}, int, error) {
+	if err := needBytes(data, 4); err != nil {
+		return nil, 0, err
+	}
+	sec := binary.BigEndian.Uint32(data)
+	usec, fracSize, err := decodeFractionalSeconds(data[4:], fsp)
+	if err != nil {
+		return nil, 0, err
+	}
+	frac := formatFractionalSeconds(usec, fsp)
+	if sec == 0 {
+		return ZERO_DATETIME + frac, 4 + fracSize, nil
+	}
+	return time.Unix(int64(sec), 0).UTC().Format("2006-01-02 15:04:05") + frac, 4 + fracSize, nil
+}
+
+/*
+* DATETIME: 8 字节 little-endian, 十进制的 YYYYMMDDhhmmss
+ */
+func decodeDatetime(data []byte) (interface{}, int, error) {
+	if err := needBytes(data, 8); err != nil {
+		return nil, 0, err
+	}
+	v := binary.LittleEndian.Uint64(data)
+	d := v / 1000000
+	t := v % 1000000
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", d/10000, (d%10000)/100, d%100, t/10000, (t%10000)/100, t%100), 8, nil
+}
+
+/*
+* DATETIME2: 5 字节 big-endian + 小数秒
+* 1 bit  sign, 1 表示非负
+* 17 bit year * 13 + month
+* 5 bit  day
+* 5 bit  hour
+* 6 bit  minute
+* 6 bit  second
+ */
+func decodeDatetime2(data []byte, fsp int) (interface{}, int, error) {
+	if err := needBytes(data, 5); err != nil {
+		return nil, 0, err
+	}
+	var v int64
+	for i := 0; i < 5; i++ {
+		v = v<<8 | int64(data[i])
+	}
+	intPart := v - DATETIMEF_INT_OFS
+	usec, fracSize, err := decodeFractionalSeconds(data[5:], fsp)
+	if err != nil {
+		return nil, 0, err
+	}
+	if intPart < 0 {
+		return nil, 0, fmt.Errorf("invalid negative datetime2 %d", intPart)
+	}
+	ymd := intPart >> 17
+	ym := ymd >> 5
+	hms := intPart % (1 << 17)
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d%s", ym/13, ym%13, ymd%(1<<5), hms>>12, (hms>>6)%(1<<6), hms%(1<<6), formatFractionalSeconds(usec, fsp)), 5 + fracSize, nil
+}
+
+/*
+* TIME: 3 字节 little-endian 有符号整数, 十进制的 hhmmss
+ */
+func decodeTime(data []byte) (interface{}, int, error) {
+	if err := needBytes(data, 3); err != nil {
+		return nil, 0, err
+	}
+	v := int32(uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16)
+	if v&0x800000 != 0 {
+		v |= -1 << 24
+	}
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%02d:%02d:%02d", sign, v/10000, (v%10000)/100, v%100), 3, nil
+}
+
+/*
+* TIME2: 3 字节 big-endian + 小数秒, 整体减去偏移量后为有符号数
+* 1 bit  sign, 1 表示非负
+* 1 bit  unused
+* 10 bit hour
+* 6 bit  minute
+* 6 bit  second
+ */
+func decodeTime2(data []byte, fsp int) (interface{}, int, error) {
+	if fsp < 0 || fsp > 6 {
+		return nil, 0, fmt.Errorf("invalid fractional seconds precision %d", fsp)
+	}
+	size := 3 + (fsp+1)/2
+	if err := needBytes(data, size); err != nil {
+		return nil, 0, err
+	}
+	var tmp int64
+	switch fsp {
+	case 0:
+		intPart := int64(data[0])<<16 | int64(data[1])<<8 | int64(data[2]) - TIMEF_INT_OFS
+		tmp = intPart << 24
+	case 1, 2:
+		intPart := int64(data[0])<<16 | int64(data[1])<<8 | int64(data[2]) - TIMEF_INT_OFS
+		frac := int64(data[3])
+		if intPart < 0 && frac > 0 {
+			intPart++
+			frac -= 0x100
+		}
+		tmp = intPart<<24 + frac*10000
+	case 3, 4:
+		intPart := int64(data[0])<<16 | int64(data[1])<<8 | int64(data[2]) - TIMEF_INT_OFS
+		frac := int64(data[3])<<8 | int64(data[4])
+		if intPart < 0 && frac > 0 {
+			intPart++
+			frac -= 0x10000
+		}
+		tmp = intPart<<24 + frac*100
+	default:
+		var v int64
+		for i := 0; i < 6; i++ {
+			v = v<<8 | int64(data[i])
+		}
+		tmp = v - TIMEF_OFS
+	}
+
+	sign := ""
+	if tmp < 0 {
+		sign = "-"
+		tmp = -tmp
+	}
+	hms := tmp >> 24
+	usec := int(tmp % (1 << 24))
+	return fmt.Sprintf("%s%02d:%02d:%02d%s", sign, (hms>>12)%(1<<10), (hms>>6)%(1<<6), hms%(1<<6), formatFractionalSeconds(usec, fsp)), size, nil
+}
+
+/*
+* DATE: 3 字节 little-endian
+* 15 bit year
+* 4 bit  month
+* 5 bit  day
+ */
+func decodeDate(data []byte) (interface{}, int, error) {
+	if err := needBytes(data, 3); err != nil {
+		return nil, 0, err
+	}
+	v := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+	return fmt.Sprintf("%04d-%02d-%02d", v>>9, (v>>5)%16, v%32), 3, nil
+}
@@ -0,0 +1,98 @@
+package event
+
+import (
+	"github.com/goMySQLSemiSync/protocol"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeValue(t *testing.T) {
+	tests := []struct {
+		name       string
+		columnType int
+		meta       uint16
+		unsigned   bool
+		data       []byte
+		expect     interface{}
+		size       int
+	}{
+		{"tiny", protocol.MYSQL_TYPE_TINY, 0, false, []byte{0xff}, int8(-1), 1},
+		{"tiny unsigned", protocol.MYSQL_TYPE_TINY, 0, true, []byte{0xff}, uint8(255), 1},
+		{"short", protocol.MYSQL_TYPE_SHORT, 0, false, []byte{0x00, 0x80}, int16(-32768), 2},
+		{"int24", protocol.MYSQL_TYPE_INT24, 0, false, []byte{0xff, 0xff, 0xff}, int32(-1), 3},
+		{"int24 unsigned", protocol.MYSQL_TYPE_INT24, 0, true, []byte{0xff, 0xff, 0xff}, uint32(16777215), 3},
+		{"long", protocol.MYSQL_TYPE_LONG, 0, false, []byte{0xfe, 0xff, 0xff, 0xff}, int32(-2), 4},
+		{"longlong unsigned", protocol.MYSQL_TYPE_LONGLONG, 0, true, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, uint64(18446744073709551615), 8},
+		{"float", protocol.MYSQL_TYPE_FLOAT, 4, false, []byte{0x00, 0x00, 0xc0, 0x3f}, float32(1.5), 4},
+		{"double", protocol.MYSQL_TYPE_DOUBLE, 8, false, []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0xc0}, float64(-2.5), 8},
+		{"year", protocol.MYSQL_TYPE_YEAR, 0, false, []byte{0x77}, 2019, 1},
+		{"year zero", protocol.MYSQL_TYPE_YEAR, 0, false, []byte{0x00}, 0, 1},
+		{"varchar 1 byte length", protocol.MYSQL_TYPE_VARCHAR, 10, false, []byte{0x02, 'a', 'b'}, "ab", 3},
+		{"varchar 2 byte length", protocol.MYSQL_TYPE_VARCHAR, 300, false, []byte{0x02, 0x00, 'a', 'b'}, "ab", 4},
+		{"char", protocol.MYSQL_TYPE_STRING, 0xfe0a, false, []byte{0x03, 'a', 'b', 'c'}, "abc", 4},
+		{"char over 255", protocol.MYSQL_TYPE_STRING, 0xee2c, false, []byte{0x01, 0x00, 'a'}, "a", 3},
+		{"enum", protocol.MYSQL_TYPE_STRING, 0xf701, false, []byte{0x02}, int64(2), 1},
+		{"enum 2 bytes", protocol.MYSQL_TYPE_STRING, 0xf702, false, []byte{0x01, 0x01}, int64(257), 2},
+		{"set", protocol.MYSQL_TYPE_STRING, 0xf802, false, []byte{0x05, 0x01}, int64(0x0105), 2},
+		{"bit", protocol.MYSQL_TYPE_BIT, 0x0102, false, []byte{0x02, 0x01}, int64(0x0201), 2},
+		{"blob", protocol.MYSQL_TYPE_BLOB, 2, false, []byte{0x03, 0x00, 'a', 'b', 'c'}, []byte("abc"), 5},
+		{"geometry", protocol.MYSQL_TYPE_GEOMETRY, 4, false, []byte{0x01, 0x00, 0x00, 0x00, 0x01}, []byte{0x01}, 5},
+		{"decimal", protocol.MYSQL_TYPE_NEWDECIMAL, 14<<8 | 4, false, []byte{0x81, 0x0d, 0xfb, 0x38, 0xd2, 0x04, 0xd2}, "1234567890.1234", 7},
+		{"decimal negative", protocol.MYSQL_TYPE_NEWDECIMAL, 14<<8 | 4, false, []byte{0x7e, 0xf2, 0x04, 0xc7, 0x2d, 0xfb, 0x2d}, "-1234567890.1234", 7},
+		{"decimal small negative", protocol.MYSQL_TYPE_NEWDECIMAL, 5<<8 | 2, false, []byte{0x7f, 0xfe, 0xcd}, "-1.50", 3},
+		{"decimal fraction", protocol.MYSQL_TYPE_NEWDECIMAL, 20<<8 | 12, false, []byte{0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x7b}, "0.000000000123", 10},
+		{"decimal integer", protocol.MYSQL_TYPE_NEWDECIMAL, 20 << 8, false, []byte{0x8c, 0x14, 0x9a, 0xa4, 0x35, 0x0d, 0xfb, 0x38, 0xd2}, "12345678901234567890", 9},
+		{"date", protocol.MYSQL_TYPE_DATE, 0, false, []byte{0x47, 0xc7, 0x0f}, "2019-10-07", 3},
+		{"datetime", protocol.MYSQL_TYPE_DATETIME, 0, false, []byte{0x11, 0xf8, 0xce, 0x15, 0x5d, 0x12, 0x00, 0x00}, "2019-10-07 14:39:53", 8},
+		{"datetime2", protocol.MYSQL_TYPE_DATETIME2, 0, false, []byte{0x99, 0xa4, 0x4e, 0xe9, 0xf5}, "2019-10-07 14:39:53", 5},
+		{"datetime2 fsp 3", protocol.MYSQL_TYPE_DATETIME2, 3, false, []byte{0x99, 0xa4, 0x4e, 0xe9, 0xf5, 0x04, 0xce}, "2019-10-07 14:39:53.123", 7},
+		{"timestamp", protocol.MYSQL_TYPE_TIMESTAMP, 0, false, []byte{0x39, 0x4e, 0x9b, 0x5d}, "2019-10-07 14:39:53", 4},
+		{"timestamp zero", protocol.MYSQL_TYPE_TIMESTAMP, 0, false, []byte{0x00, 0x00, 0x00, 0x00}, ZERO_DATETIME, 4},
+		{"timestamp2 fsp 6", protocol.MYSQL_TYPE_TIMESTAMP2, 6, false, []byte{0x5d, 0x9b, 0x4e, 0x39, 0x01, 0xe2, 0x40}, "2019-10-07 14:39:53.123456", 7},
+		{"time", protocol.MYSQL_TYPE_TIME, 0, false, []byte{0x25, 0xd8, 0xff}, "-01:02:03", 3},
+		{"time2", protocol.MYSQL_TYPE_TIME2, 0, false, []byte{0x80, 0xe9, 0xf5}, "14:39:53", 3},
+		{"time2 negative", protocol.MYSQL_TYPE_TIME2, 0, false, []byte{0x7f, 0xf0, 0x00}, "-01:00:00", 3},
+		{"time2 max", protocol.MYSQL_TYPE_TIME2, 0, false, []byte{0xb4, 0x6e, 0xfb}, "838:59:59", 3},
+		{"time2 negative fsp 3", protocol.MYSQL_TYPE_TIME2, 3, false, []byte{0x7f, 0xff, 0xfe, 0xec, 0x78}, "-00:00:01.500", 5},
+		{"time2 negative fsp 6", protocol.MYSQL_TYPE_TIME2, 6, false, []byte{0x7f, 0x37, 0x47, 0xf3, 0xf5, 0xec}, "-12:34:56.789012", 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, size, err := decodeValue(tt.data, tt.columnType, tt.meta, tt.unsigned)
+			if err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			if !reflect.DeepEqual(value, tt.expect) {
+				t.Errorf("expect %#v, but got %#v", tt.expect, value)
+			}
+			if size != tt.size {
+				t.Errorf("expect size %d, but got %d", tt.size, size)
+			}
+		})
+	}
+}
+
+func TestDecodeValueTooShort(t *testing.T) {
+	tests := []struct {
+		name       string
+		columnType int
+		meta       uint16
+		data       []byte
+	}{
+		{"long", protocol.MYSQL_TYPE_LONG, 0, []byte{0x01, 0x02}},
+		{"varchar", protocol.MYSQL_TYPE_VARCHAR, 10, []byte{0x05, 'a'}},
+		{"blob", protocol.MYSQL_TYPE_BLOB, 2, []byte{0x05}},
+		{"decimal", protocol.MYSQL_TYPE_NEWDECIMAL, 14<<8 | 4, []byte{0x81, 0x0d}},
+		{"datetime2", protocol.MYSQL_TYPE_DATETIME2, 6, []byte{0x99, 0xa4, 0x4e, 0xe9, 0xf5, 0x01}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := decodeValue(tt.data, tt.columnType, tt.meta, false)
+			if err == nil {
+				t.Errorf("expect error for short data %v", tt.data)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package event
+
+import (
+	"fmt"
+	"github.com/goMySQLSemiSync/constants"
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+const (
+	ROWS_HEADER_LENGTH_V1 = 8
+	ROWS_HEADER_LENGTH_V2 = 10
+)
+
+// rows event flags
+const (
+	STMT_END_F              = 0x0001
+	NO_FOREIGN_KEY_CHECKS_F = 0x0002
+	RELAXED_UNIQUE_CHECKS_F = 0x0004
+	COMPLETE_ROWS_F         = 0x0008
+)
+
+// PARTIAL_UPDATE_ROWS_EVENT after image 的 value options
+const PARTIAL_JSON_UPDATES = 0x0001
+
+/*
+* 需要 TABLE_MAP_EVENT 才能解码的 event, Decoder 在 Decode 之前设置
+ */
+type tableMapConsumer interface {
+	setTableMaps(tableMaps *TableMapCache)
+}
+
+/*
+* WRITE_ROWS_EVENT / UPDATE_ROWS_EVENT / DELETE_ROWS_EVENT, v1 和 v2
+* https://dev.mysql.com/doc/internals/en/rows-event.html
+* post-header:
+* 6              table id, post-header 长度为 6 时为 4 字节
+* 2              flags
+* 2              extra-data length, v2, 包含自身的 2 字节
+* string[len-2]  extra-data, v2
+* payload:
+* lenenc-int     column count
+* string.var_len columns-present-bitmap1, length: (column count + 7) / 8
+* string.var_len columns-present-bitmap2, UPDATE_ROWS_EVENT
+* rows:
+* string.var_len nul-bitmap, length: (bits set in columns-present-bitmap + 7) / 8
+* string.var_len value of each field as defined in table-map
+* UPDATE_ROWS_EVENT 每一行为 before image + after image
+*
+* PARTIAL_UPDATE_ROWS_EVENT 与 UPDATE_ROWS_EVENT v2 相同, after image 的 NULL-bitmask 之前有:
+* lenenc-int     value options
+* string.var_len partial bits, PARTIAL_JSON_UPDATES 时, 每个 JSON 列一位, length: (JSON 列数 + 7) / 8
+* partial bit 为 1 的 JSON 列的值为 []*JsonDiff
+*
+* 每个 image 为 column count 个 Go 值, NULL 和没有出现在 image 中的列为 nil
+ */
+type RowsEvent struct {
+	*BaseEvent
+	version              int
+	tableId              uint64
+	flags                uint16
+	extraData            []byte
+	columnCount          int
+	columnsPresent       []byte
+	columnsPresentUpdate []byte
+	table                *TableMapEvent
+	beforeImages         [][]interface{}
+	afterImages          [][]interface{}
+	tableMaps            *TableMapCache
+}
+
+func NewRowsEvent() *RowsEvent {
+	return &RowsEvent{
+		BaseEvent:            NewBaseEvent(),
+		version:              2,
+		tableId:              0,
+		flags:                0,
+		extraData:            nil,
+		columnCount:          0,
+		columnsPresent:       nil,
+		columnsPresentUpdate: nil,
+		table:                nil,
+		beforeImages:         make([][]interface{}, 0),
+		afterImages:          make([][]interface{}, 0),
+		tableMaps:            nil,
+	}
+}
+
+func (this *RowsEvent) setTableMaps(tableMaps *TableMapCache) {
+	this.tableMaps = tableMaps
+}
+
+func (this *RowsEvent) GetVersion() int {
+	return this.version
+}
+
+func (this *RowsEvent) GetTableId() uint64 {
+	return this.tableId
+}
+
+func (this *RowsEvent) GetFlags() uint16 {
+	return this.flags
+}
+
+func (this *RowsEvent) IsStmtEnd() bool {
+	return this.flags&STMT_END_F != 0
+}
+
+func (this *RowsEvent) GetExtraData() []byte {
+	return this.extraData
+}
+
+func (this *RowsEvent) GetColumnCount() int {
+	return this.columnCount
+}
+
+func (this *RowsEvent) GetTable() *TableMapEvent {
+	return this.table
+}
+
+/*
+* DELETE_ROWS_EVENT 删除的行和 UPDATE_ROWS_EVENT 更新前的行
+ */
+func (this *RowsEvent) GetBeforeImages() [][]interface{} {
+	return this.beforeImages
+}
+
+/*
+* WRITE_ROWS_EVENT 插入的行和 UPDATE_ROWS_EVENT 更新后的行
+ */
+func (this *RowsEvent) GetAfterImages() [][]interface{} {
+	return this.afterImages
+}
+
+func (this *RowsEvent) IsColumnPresent(i int) bool {
+	return isBitSet(this.columnsPresent, i)
+}
+
+/*
+* UPDATE_ROWS_EVENT 的 after image 中是否包含第 i 列
+ */
+func (this *RowsEvent) IsColumnPresentUpdate(i int) bool {
+	return isBitSet(this.columnsPresentUpdate, i)
+}
+
+func (this *RowsEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	eventType := this.GetHeader().EventType
+	defaultLength := ROWS_HEADER_LENGTH_V2
+	this.version = 2
+	switch eventType {
+	case constants.WRITE_ROWS_EVENT_V1, constants.UPDATE_ROWS_EVENT_V1, constants.DELETE_ROWS_EVENT_V1:
+		defaultLength = ROWS_HEADER_LENGTH_V1
+		this.version = 1
+	}
+	postHeaderLength := format.GetPostHeaderLength(eventType, defaultLength)
+	tableIdLength := 6
+	if postHeaderLength == 6 {
+		tableIdLength = 4
+	}
+	if len(body) < tableIdLength+2 {
+		return fmt.Errorf("rows event too short, length: %d", len(body))
+	}
+
+	proto := protocol.NewProto(body, 0)
+	need := func(size int) error {
+		if size < 0 || proto.GetOffset()+size > len(body) {
+			return fmt.Errorf("rows event too short, length: %d", len(body))
+		}
+		return nil
+	}
+	this.tableId = uint64(proto.Get_fixed_int(tableIdLength))
+	this.flags = uint16(proto.Get_fixed_int(2))
+	if this.version == 2 {
+		if err := need(2); err != nil {
+			return err
+		}
+		extraDataLength := proto.Get_fixed_int(2)
+		if extraDataLength < 2 {
+			return fmt.Errorf("invalid rows event extra data length %d", extraDataLength)
+		}
+		if err := need(extraDataLength - 2); err != nil {
+			return err
+		}
+		this.extraData = proto.Read(extraDataLength - 2)
+	}
+
+	columnCount, err := readLenencInt(proto, need)
+	if err != nil {
+		return err
+	}
+	this.columnCount = columnCount
+	bitmapLength := (this.columnCount + 7) / 8
+	if err = need(bitmapLength); err != nil {
+		return err
+	}
+	this.columnsPresent = proto.Read(bitmapLength)
+	isUpdate := eventType == constants.UPDATE_ROWS_EVENT || eventType == constants.UPDATE_ROWS_EVENT_V1 || eventType == constants.PARTIAL_UPDATE_ROWS_EVENT
+	if isUpdate {
+		if err = need(bitmapLength); err != nil {
+			return err
+		}
+		this.columnsPresentUpdate = proto.Read(bitmapLength)
+	}
+
+	if this.tableMaps == nil {
+		return fmt.Errorf("no table map cache for rows event, table id: %d", this.tableId)
+	}
+	table, ok := this.tableMaps.Get(this.tableId)
+	if !ok {
+		return fmt.Errorf("no table map for rows event, table id: %d", this.tableId)
+	}
+	if table.GetColumnCount() != this.columnCount {
+		return fmt.Errorf("column count mismatch for table %s.%s, table map: %d, rows event: %d", table.GetSchema(), table.GetTable(), table.GetColumnCount(), this.columnCount)
+	}
+	this.table = table
+
+	unsigned := table.UnsignedMap()
+	for proto.Has_remaining_data() {
+		switch eventType {
+		case constants.WRITE_ROWS_EVENT, constants.WRITE_ROWS_EVENT_V1:
+			row, err := this.decodeImage(proto, need, this.columnsPresent, unsigned, false)
+			if err != nil {
+				return err
+			}
+			this.afterImages = append(this.afterImages, row)
+		case constants.DELETE_ROWS_EVENT, constants.DELETE_ROWS_EVENT_V1:
+			row, err := this.decodeImage(proto, need, this.columnsPresent, unsigned, false)
+			if err != nil {
+				return err
+			}
+			this.beforeImages = append(this.beforeImages, row)
+		default:
+			before, err := this.decodeImage(proto, need, this.columnsPresent, unsigned, false)
+			if err != nil {
+				return err
+			}
+			after, err := this.decodeImage(proto, need, this.columnsPresentUpdate, unsigned, eventType == constants.PARTIAL_UPDATE_ROWS_EVENT)
+			if err != nil {
+				return err
+			}
+			this.beforeImages = append(this.beforeImages, before)
+			this.afterImages = append(this.afterImages, after)
+		}
+	}
+	return nil
+}
+
+func (this *RowsEvent) decodeImage(proto *protocol.Proto, need func(size int) error, columnsPresent []byte, unsigned map[int]bool, partial bool) ([]interface{}, error) {
+	var partialBits []byte
+	if partial {
+		valueOptions, err := readLenencInt(proto, need)
+		if err != nil {
+			return nil, err
+		}
+		if valueOptions&PARTIAL_JSON_UPDATES != 0 {
+			jsonCount := 0
+			for i := 0; i < this.columnCount; i++ {
+				if int(this.table.GetColumnTypes()[i]) == protocol.MYSQL_TYPE_JSON {
+					jsonCount++
+				}
+			}
+			if err = need((jsonCount + 7) / 8); err != nil {
+				return nil, err
+			}
+			partialBits = proto.Read((jsonCount + 7) / 8)
+		}
+	}
+
+	presentCount := 0
+	for i := 0; i < this.columnCount; i++ {
+		if isBitSet(columnsPresent, i) {
+			presentCount++
+		}
+	}
+	if err := need((presentCount + 7) / 8); err != nil {
+		return nil, err
+	}
+	nullBitmap := proto.Read((presentCount + 7) / 8)
+
+	row := make([]interface{}, this.columnCount)
+	n := 0
+	jsonIndex := 0
+	for i := 0; i < this.columnCount; i++ {
+		isPartialJSON := false
+		if int(this.table.GetColumnTypes()[i]) == protocol.MYSQL_TYPE_JSON {
+			isPartialJSON = isBitSet(partialBits, jsonIndex)
+			jsonIndex++
+		}
+		if !isBitSet(columnsPresent, i) {
+			continue
+		}
+		isNull := isBitSet(nullBitmap, n)
+		n++
+		if isNull {
+			continue
+		}
+		data := proto.GetPacket()[proto.GetOffset():]
+		if isPartialJSON {
+			value, size, err := decodeBlob(data, int(this.table.GetColumnMeta()[i]))
+			if err != nil {
+				return nil, fmt.Errorf("decode column %d of table %s.%s error, err: %w", i, this.table.GetSchema(), this.table.GetTable(), err)
+			}
+			diffs, err := DecodeJSONDiff(value.([]byte))
+			if err != nil {
+				return nil, fmt.Errorf("decode json diff of column %d of table %s.%s error, err: %w", i, this.table.GetSchema(), this.table.GetTable(), err)
+			}
+			proto.Get_filler(size)
+			row[i] = diffs
+			continue
+		}
+		value, size, err := decodeValue(data, int(this.table.GetColumnTypes()[i]), this.table.GetColumnMeta()[i], unsigned[i])
+		if err != nil {
+			return nil, fmt.Errorf("decode column %d of table %s.%s error, err: %w", i, this.table.GetSchema(), this.table.GetTable(), err)
+		}
+		proto.Get_filler(size)
+		row[i] = value
+	}
+	return row, nil
+}
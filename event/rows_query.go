@@ -0,0 +1,34 @@
+package event
+
+import (
+	"fmt"
+)
+
+/*
+* ROWS_QUERY_LOG_EVENT, binlog_rows_query_log_events=ON 时在 TABLE_MAP_EVENT 之前记录原始 SQL
+* 1              length, 超过 255 时被截断, 不可信
+* string[EOF]    query
+ */
+type RowsQueryEvent struct {
+	*BaseEvent
+	query string
+}
+
+func NewRowsQueryEvent() *RowsQueryEvent {
+	return &RowsQueryEvent{
+		BaseEvent: NewBaseEvent(),
+		query:     "",
+	}
+}
+
+func (this *RowsQueryEvent) GetQuery() string {
+	return this.query
+}
+
+func (this *RowsQueryEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	if len(body) < 1 {
+		return fmt.Errorf("rows query event too short, length: %d", len(body))
+	}
+	this.query = string(body[1:])
+	return nil
+}
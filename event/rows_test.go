@@ -0,0 +1,199 @@
+package event
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/goMySQLSemiSync/constants"
+)
+
+func newTestTableMaps(t *testing.T, body []byte) *TableMapCache {
+	table := NewTableMapEvent()
+	if err := table.Decode(NewFormatDescriptionEvent(), body); err != nil {
+		t.Fatalf("decode table map event error: %v", err)
+	}
+	tableMaps := NewTableMapCache()
+	tableMaps.Set(table)
+	return tableMaps
+}
+
+func decodeTestRowsEvent(tableMaps *TableMapCache, eventType int, body []byte) (*RowsEvent, error) {
+	header := NewEventHeader()
+	header.EventType = eventType
+	ev := NewRowsEvent()
+	ev.SetData(header, nil)
+	ev.setTableMaps(tableMaps)
+	return ev, ev.Decode(NewFormatDescriptionEvent(), body)
+}
+
+func TestRowsEventTruncated(t *testing.T) {
+	tableMaps := newTestTableMaps(t, buildTestTableMapBody())
+	// INSERT INTO test.t1 VALUES (1, 'ab', NULL)
+	body := []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x02, 0x00}
+	body = append(body, 3, 0x07)
+	body = append(body, 0x04, 0x01, 0x00, 0x00, 0x00, 0x02, 'a', 'b')
+	if _, err := decodeTestRowsEvent(tableMaps, constants.WRITE_ROWS_EVENT, body); err != nil {
+		t.Fatalf("decode rows event error: %v", err)
+	}
+	// 直接调用 Decode, 不经过 Decoder 的 recover, 截断的 event 必须返回 error
+	for i := 0; i < len(body); i++ {
+		// 只有 header 和 columns-present bitmap, 没有行
+		if i == 12 {
+			continue
+		}
+		if _, err := decodeTestRowsEvent(tableMaps, constants.WRITE_ROWS_EVENT, body[:i]); err == nil {
+			t.Errorf("expect error for rows event truncated to %d bytes", i)
+		}
+	}
+	// extra data 长度超过 event
+	invalid := append([]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x10, 0x00}, body[10:]...)
+	if _, err := decodeTestRowsEvent(tableMaps, constants.WRITE_ROWS_EVENT, invalid); err == nil {
+		t.Errorf("expect error for extra data over event")
+	}
+}
+
+/*
+* test.t1 (id int, name varchar(20), doc json) 的 rows event, v1 没有 extra data
+ */
+func buildTestRowsBody(version int, extraData []byte, bitmaps []byte, rows ...[]byte) []byte {
+	body := []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, byte(STMT_END_F), 0x00}
+	if version == 2 {
+		body = append(body, byte(len(extraData)+2), 0x00)
+		body = append(body, extraData...)
+	}
+	body = append(body, 3)
+	body = append(body, bitmaps...)
+	for _, row := range rows {
+		body = append(body, row...)
+	}
+	return body
+}
+
+func TestRowsEventDecode(t *testing.T) {
+	// doc 为 JSON int16, 4 字节长度 + 值
+	docValue := []byte{0x03, 0x00, 0x00, 0x00, 0x05, 0x01, 0x00}
+	// JSON_REPLACE(doc, '$.a', 2)
+	docDiff := []byte{0x09, 0x00, 0x00, 0x00, 0x00, 0x03, '$', '.', 'a', 0x03, 0x05, 0x02, 0x00}
+	fullRow := append([]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 'a', 'b'}, docValue...)
+
+	tests := []struct {
+		name      string
+		eventType int
+		body      []byte
+		extraData []byte
+		before    [][]interface{}
+		after     [][]interface{}
+	}{
+		{"write v2 with null", constants.WRITE_ROWS_EVENT,
+			buildTestRowsBody(2, nil, []byte{0x07}, []byte{0x04, 0x01, 0x00, 0x00, 0x00, 0x02, 'a', 'b'}, fullRow),
+			[]byte{},
+			[][]interface{}{},
+			[][]interface{}{{int32(1), "ab", nil}, {int32(1), "ab", "1"}}},
+		{"write v2 with extra data", constants.WRITE_ROWS_EVENT,
+			buildTestRowsBody(2, []byte{0x00, 0x01}, []byte{0x01}, []byte{0x00, 0xff, 0xff, 0xff, 0xff}),
+			[]byte{0x00, 0x01},
+			[][]interface{}{},
+			[][]interface{}{{int32(-1), nil, nil}}},
+		{"delete v1", constants.DELETE_ROWS_EVENT_V1,
+			buildTestRowsBody(1, nil, []byte{0x07}, fullRow),
+			nil,
+			[][]interface{}{{int32(1), "ab", "1"}},
+			[][]interface{}{}},
+		// binlog_row_image=MINIMAL, before image 只有主键, after image 只有修改的列
+		{"update v2 with different present bitmaps", constants.UPDATE_ROWS_EVENT,
+			buildTestRowsBody(2, nil, []byte{0x01, 0x02},
+				[]byte{0x00, 0x01, 0x00, 0x00, 0x00}, []byte{0x00, 0x02, 'c', 'd'},
+				[]byte{0x00, 0x02, 0x00, 0x00, 0x00}, []byte{0x01}),
+			[]byte{},
+			[][]interface{}{{int32(1), nil, nil}, {int32(2), nil, nil}},
+			[][]interface{}{{nil, "cd", nil}, {nil, nil, nil}}},
+		{"update v1", constants.UPDATE_ROWS_EVENT_V1,
+			buildTestRowsBody(1, nil, []byte{0x07, 0x07}, fullRow, []byte{0x06, 0x03, 0x00, 0x00, 0x00}),
+			nil,
+			[][]interface{}{{int32(1), "ab", "1"}},
+			[][]interface{}{{int32(3), nil, nil}}},
+		// binlog_row_value_options=PARTIAL_JSON, after image 中 doc 为 JSON diff
+		{"partial update with json diff", constants.PARTIAL_UPDATE_ROWS_EVENT,
+			buildTestRowsBody(2, nil, []byte{0x07, 0x05},
+				fullRow, append([]byte{PARTIAL_JSON_UPDATES, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00}, docDiff...)),
+			[]byte{},
+			[][]interface{}{{int32(1), "ab", "1"}},
+			[][]interface{}{{int32(1), nil, []*JsonDiff{{Operation: JSON_DIFF_OPERATION_REPLACE, Path: "$.a", Value: "2"}}}}},
+		// partial bit 为 0 的 JSON 列为完整的值
+		{"partial update without json diff", constants.PARTIAL_UPDATE_ROWS_EVENT,
+			buildTestRowsBody(2, nil, []byte{0x07, 0x05},
+				fullRow, append([]byte{PARTIAL_JSON_UPDATES, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00}, docValue...)),
+			[]byte{},
+			[][]interface{}{{int32(1), "ab", "1"}},
+			[][]interface{}{{int32(1), nil, "1"}}},
+		// value options 为 0 时没有 partial bits
+		{"partial update without value options", constants.PARTIAL_UPDATE_ROWS_EVENT,
+			buildTestRowsBody(2, nil, []byte{0x07, 0x01},
+				fullRow, []byte{0x00, 0x00, 0x05, 0x00, 0x00, 0x00}),
+			[]byte{},
+			[][]interface{}{{int32(1), "ab", "1"}},
+			[][]interface{}{{int32(5), nil, nil}}},
+	}
+
+	tableMaps := newTestTableMaps(t, buildTestTableMapBody())
+	for _, tt := range tests {
+		ev, err := decodeTestRowsEvent(tableMaps, tt.eventType, tt.body)
+		if err != nil {
+			t.Errorf("%s: decode error: %v", tt.name, err)
+			continue
+		}
+		if ev.GetTableId() != 1 || !ev.IsStmtEnd() || ev.GetColumnCount() != 3 || ev.GetTable().GetTable() != "t1" {
+			t.Errorf("%s: unexpected header: table id %d, flags %d, %d columns", tt.name, ev.GetTableId(), ev.GetFlags(), ev.GetColumnCount())
+		}
+		if !reflect.DeepEqual(ev.GetExtraData(), tt.extraData) {
+			t.Errorf("%s: expect extra data %v, got %v", tt.name, tt.extraData, ev.GetExtraData())
+		}
+		if !reflect.DeepEqual(ev.GetBeforeImages(), tt.before) {
+			t.Errorf("%s: expect before images %v, got %v", tt.name, tt.before, ev.GetBeforeImages())
+		}
+		if !reflect.DeepEqual(ev.GetAfterImages(), tt.after) {
+			t.Errorf("%s: expect after images %v, got %v", tt.name, tt.after, ev.GetAfterImages())
+		}
+	}
+}
+
+func TestRowsEventPresentBitmaps(t *testing.T) {
+	tableMaps := newTestTableMaps(t, buildTestTableMapBody())
+	body := buildTestRowsBody(2, nil, []byte{0x01, 0x06}, []byte{0x00, 0x01, 0x00, 0x00, 0x00}, []byte{0x02, 0x02, 'c', 'd'})
+	ev, err := decodeTestRowsEvent(tableMaps, constants.UPDATE_ROWS_EVENT, body)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	for i, expect := range []bool{true, false, false} {
+		if ev.IsColumnPresent(i) != expect {
+			t.Errorf("expect column %d present in before image: %v", i, expect)
+		}
+	}
+	for i, expect := range []bool{false, true, true} {
+		if ev.IsColumnPresentUpdate(i) != expect {
+			t.Errorf("expect column %d present in after image: %v", i, expect)
+		}
+	}
+	if expect := [][]interface{}{{nil, "cd", nil}}; !reflect.DeepEqual(ev.GetAfterImages(), expect) {
+		t.Errorf("expect after images %v, got %v", expect, ev.GetAfterImages())
+	}
+}
+
+func TestRowsEventTableMapMismatch(t *testing.T) {
+	tableMaps := newTestTableMaps(t, buildTestTableMapBody())
+	// 没有 table id 为 2 的 TABLE_MAP_EVENT
+	body := buildTestRowsBody(2, nil, []byte{0x07})
+	body[0] = 0x02
+	if _, err := decodeTestRowsEvent(tableMaps, constants.WRITE_ROWS_EVENT, body); err == nil {
+		t.Errorf("expect error for unknown table id")
+	}
+	// column count 与 TABLE_MAP_EVENT 不同
+	body = buildTestRowsBody(2, nil, []byte{0x03})
+	body[10] = 2
+	if _, err := decodeTestRowsEvent(tableMaps, constants.WRITE_ROWS_EVENT, body); err == nil {
+		t.Errorf("expect error for column count mismatch")
+	}
+	if _, err := decodeTestRowsEvent(nil, constants.WRITE_ROWS_EVENT, buildTestRowsBody(2, nil, []byte{0x07})); err == nil {
+		t.Errorf("expect error without table map cache")
+	}
+}
@@ -0,0 +1,627 @@
+package event
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/goMySQLSemiSync/constants"
+	"github.com/goMySQLSemiSync/protocol"
+	"sync"
+)
+
+const TABLE_MAP_HEADER_LENGTH = 8
+
+// TABLE_MAP_EVENT optional metadata 类型, binlog_row_metadata=FULL 时记录全部, MINIMAL 时只记录部分
+const (
+	TABLE_MAP_SIGNEDNESS                   = 1
+	TABLE_MAP_DEFAULT_CHARSET              = 2
+	TABLE_MAP_COLUMN_CHARSET               = 3
+	TABLE_MAP_COLUMN_NAME                  = 4
+	TABLE_MAP_SET_STR_VALUE                = 5
+	TABLE_MAP_ENUM_STR_VALUE               = 6
+	TABLE_MAP_GEOMETRY_TYPE                = 7
+	TABLE_MAP_SIMPLE_PRIMARY_KEY           = 8
+	TABLE_MAP_PRIMARY_KEY_WITH_PREFIX      = 9
+	TABLE_MAP_ENUM_AND_SET_DEFAULT_CHARSET = 10
+	TABLE_MAP_ENUM_AND_SET_COLUMN_CHARSET  = 11
+	TABLE_MAP_COLUMN_VISIBILITY            = 12
+)
+
+/*
+* TABLE_MAP_EVENT
+* https://dev.mysql.com/doc/internals/en/table-map-event.html
+* post-header:
+* 6              table id, post-header 长度为 6 时为 4 字节
+* 2              flags
+* payload:
+* 1              schema name length
+* string         schema name
+* 1              [00]
+* 1              table name length
+* string         table name
+* 1              [00]
+* lenenc-int     column-count
+* string.var_len [length=$column-count] column-def
+* lenenc-str     column-meta-def
+* n              NULL-bitmask, length: (column-count + 7) / 8
+* string[EOF]    optional metadata, 每一项为 1 字节类型 + lenenc 长度 + 值
+ */
+type TableMapEvent struct {
+	*BaseEvent
+	tableId     uint64
+	flags       uint16
+	schema      string
+	table       string
+	columnCount int
+	columnTypes []byte
+	columnMeta  []uint16
+	nullBitmap  []byte
+
+	// optional metadata
+	signedness               []bool // 按数值列的顺序, true 表示 unsigned
+	defaultCharset           int
+	charsetCollations        map[int]int // 字符列序号 => collation, 与 defaultCharset 不同的列
+	columnCharset            []int       // 按字符列的顺序
+	columnNames              []string
+	setStrValues             [][]string // 按 set 列的顺序
+	enumStrValues            [][]string // 按 enum 列的顺序
+	geometryTypes            []int      // 按 geometry 列的顺序
+	primaryKey               []int
+	primaryKeyPrefix         []int // 与 primaryKey 对应, 0 表示整列
+	enumSetDefaultCharset    int
+	enumSetCharsetCollations map[int]int
+	enumSetColumnCharset     []int
+	visibility               []bool
+}
+
+func NewTableMapEvent() *TableMapEvent {
+	return &TableMapEvent{
+		BaseEvent:                NewBaseEvent(),
+		tableId:                  0,
+		flags:                    0,
+		schema:                   "",
+		table:                    "",
+		columnCount:              0,
+		columnTypes:              nil,
+		columnMeta:               nil,
+		nullBitmap:               nil,
+		signedness:               nil,
+		defaultCharset:           0,
+		charsetCollations:        nil,
+		columnCharset:            nil,
+		columnNames:              nil,
+		setStrValues:             nil,
+		enumStrValues:            nil,
+		geometryTypes:            nil,
+		primaryKey:               nil,
+		primaryKeyPrefix:         nil,
+		enumSetDefaultCharset:    0,
+		enumSetCharsetCollations: nil,
+		enumSetColumnCharset:     nil,
+		visibility:               nil,
+	}
+}
+
+func (this *TableMapEvent) GetTableId() uint64 {
+	return this.tableId
+}
+
+func (this *TableMapEvent) GetFlags() uint16 {
+	return this.flags
+}
+
+func (this *TableMapEvent) GetSchema() string {
+	return this.schema
+}
+
+func (this *TableMapEvent) GetTable() string {
+	return this.table
+}
+
+func (this *TableMapEvent) GetColumnCount() int {
+	return this.columnCount
+}
+
+func (this *TableMapEvent) GetColumnTypes() []byte {
+	return this.columnTypes
+}
+
+func (this *TableMapEvent) GetColumnMeta() []uint16 {
+	return this.columnMeta
+}
+
+func (this *TableMapEvent) GetColumnNames() []string {
+	return this.columnNames
+}
+
+func (this *TableMapEvent) GetSetStrValues() [][]string {
+	return this.setStrValues
+}
+
+func (this *TableMapEvent) GetEnumStrValues() [][]string {
+	return this.enumStrValues
+}
+
+func (this *TableMapEvent) GetGeometryTypes() []int {
+	return this.geometryTypes
+}
+
+func (this *TableMapEvent) GetPrimaryKey() []int {
+	return this.primaryKey
+}
+
+func (this *TableMapEvent) GetPrimaryKeyPrefix() []int {
+	return this.primaryKeyPrefix
+}
+
+func (this *TableMapEvent) IsNullable(i int) bool {
+	return isBitSet(this.nullBitmap, i)
+}
+
+/*
+* 列的真实类型, MYSQL_TYPE_STRING 的 metadata 中保存了 ENUM / SET 的真实类型
+ */
+func (this *TableMapEvent) GetRealType(i int) int {
+	columnType := int(this.columnTypes[i])
+	if columnType == protocol.MYSQL_TYPE_STRING {
+		realType := int(this.columnMeta[i] >> 8)
+		if realType == protocol.MYSQL_TYPE_ENUM || realType == protocol.MYSQL_TYPE_SET {
+			return realType
+		}
+	}
+	return columnType
+}
+
+func (this *TableMapEvent) isNumericColumn(i int) bool {
+	switch int(this.columnTypes[i]) {
+	case protocol.MYSQL_TYPE_TINY, protocol.MYSQL_TYPE_SHORT, protocol.MYSQL_TYPE_INT24,
+		protocol.MYSQL_TYPE_LONG, protocol.MYSQL_TYPE_LONGLONG, protocol.MYSQL_TYPE_NEWDECIMAL,
+		protocol.MYSQL_TYPE_FLOAT, protocol.MYSQL_TYPE_DOUBLE:
+		return true
+	}
+	return false
+}
+
+func (this *TableMapEvent) isCharacterColumn(i int) bool {
+	switch this.GetRealType(i) {
+	case protocol.MYSQL_TYPE_STRING, protocol.MYSQL_TYPE_VAR_STRING, protocol.MYSQL_TYPE_VARCHAR,
+		protocol.MYSQL_TYPE_BLOB:
+		return true
+	}
+	return false
+}
+
+func (this *TableMapEvent) isEnumOrSetColumn(i int) bool {
+	realType := this.GetRealType(i)
+	return realType == protocol.MYSQL_TYPE_ENUM || realType == protocol.MYSQL_TYPE_SET
+}
+
+/*
+* 列序号 => 是否 unsigned, 只包含数值列, 没有 SIGNEDNESS metadata 时返回 nil
+ */
+func (this *TableMapEvent) UnsignedMap() map[int]bool {
+	if this.signedness == nil {
+		return nil
+	}
+	ret := make(map[int]bool)
+	n := 0
+	for i := 0; i < this.columnCount; i++ {
+		if !this.isNumericColumn(i) {
+			continue
+		}
+		if n < len(this.signedness) {
+			ret[i] = this.signedness[n]
+		}
+		n++
+	}
+	return ret
+}
+
+/*
+* 列序号 => collation, 只包含字符列, 没有 charset metadata 时返回 nil
+ */
+func (this *TableMapEvent) CollationMap() map[int]int {
+	return collationMap(this.columnCount, this.isCharacterColumn, this.defaultCharset, this.charsetCollations, this.columnCharset)
+}
+
+/*
+* 列序号 => collation, 只包含 enum / set 列, 没有 charset metadata 时返回 nil
+ */
+func (this *TableMapEvent) EnumSetCollationMap() map[int]int {
+	return collationMap(this.columnCount, this.isEnumOrSetColumn, this.enumSetDefaultCharset, this.enumSetCharsetCollations, this.enumSetColumnCharset)
+}
+
+func collationMap(columnCount int, match func(i int) bool, defaultCharset int, charsetCollations map[int]int, columnCharset []int) map[int]int {
+	if charsetCollations == nil && columnCharset == nil {
+		return nil
+	}
+	ret := make(map[int]int)
+	n := 0
+	for i := 0; i < columnCount; i++ {
+		if !match(i) {
+			continue
+		}
+		if columnCharset != nil {
+			if n < len(columnCharset) {
+				ret[i] = columnCharset[n]
+			}
+		} else if collation, ok := charsetCollations[n]; ok {
+			ret[i] = collation
+		} else {
+			ret[i] = defaultCharset
+		}
+		n++
+	}
+	return ret
+}
+
+/*
+* 列序号 => 是否可见, 没有 COLUMN_VISIBILITY metadata 时返回 nil
+ */
+func (this *TableMapEvent) VisibilityMap() map[int]bool {
+	if this.visibility == nil {
+		return nil
+	}
+	ret := make(map[int]bool)
+	for i := 0; i < this.columnCount && i < len(this.visibility); i++ {
+		ret[i] = this.visibility[i]
+	}
+	return ret
+}
+
+func (this *TableMapEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	postHeaderLength := format.GetPostHeaderLength(constants.TABLE_MAP_EVENT, TABLE_MAP_HEADER_LENGTH)
+	tableIdLength := 6
+	if postHeaderLength == 6 {
+		tableIdLength = 4
+	}
+	if len(body) < tableIdLength+2 {
+		return fmt.Errorf("table map event too short, length: %d", len(body))
+	}
+	proto := protocol.NewProto(body, 0)
+	need := func(size int) error {
+		if size < 0 || proto.GetOffset()+size > len(body) {
+			return fmt.Errorf("table map event too short, length: %d", len(body))
+		}
+		return nil
+	}
+	this.tableId = uint64(proto.Get_fixed_int(tableIdLength))
+	this.flags = uint16(proto.Get_fixed_int(2))
+
+	var err error
+	this.schema, err = readLengthPrefixedStr(proto, need)
+	if err != nil {
+		return err
+	}
+	if err = need(1); err != nil {
+		return err
+	}
+	proto.Get_filler(1)
+	this.table, err = readLengthPrefixedStr(proto, need)
+	if err != nil {
+		return err
+	}
+	if err = need(1); err != nil {
+		return err
+	}
+	proto.Get_filler(1)
+
+	this.columnCount, err = readLenencInt(proto, need)
+	if err != nil {
+		return err
+	}
+	if err = need(this.columnCount); err != nil {
+		return err
+	}
+	this.columnTypes = proto.Read(this.columnCount)
+
+	metaLength, err := readLenencInt(proto, need)
+	if err != nil {
+		return err
+	}
+	if err = need(metaLength); err != nil {
+		return err
+	}
+	err = this.decodeColumnMeta(proto.Read(metaLength))
+	if err != nil {
+		return err
+	}
+
+	if err = need((this.columnCount + 7) / 8); err != nil {
+		return err
+	}
+	this.nullBitmap = proto.Read((this.columnCount + 7) / 8)
+
+	if proto.Has_remaining_data() {
+		return this.decodeOptionalMeta(body[proto.GetOffset():])
+	}
+	return nil
+}
+
+/*
+* 每一列的 metadata, 长度由列类型决定
+* STRING / ENUM / SET: 2 字节, 第一个字节为真实类型, 第二个字节为长度
+* NEWDECIMAL: 2 字节, precision + scale
+* VARCHAR / VAR_STRING / BIT: 2 字节 little-endian
+* BLOB / FLOAT / DOUBLE / GEOMETRY / JSON / TIMESTAMP2 / DATETIME2 / TIME2: 1 字节
+ */
+func (this *TableMapEvent) decodeColumnMeta(data []byte) error {
+	this.columnMeta = make([]uint16, this.columnCount)
+	pos := 0
+	for i := 0; i < this.columnCount; i++ {
+		size := 0
+		switch int(this.columnTypes[i]) {
+		case protocol.MYSQL_TYPE_STRING, protocol.MYSQL_TYPE_ENUM, protocol.MYSQL_TYPE_SET,
+			protocol.MYSQL_TYPE_NEWDECIMAL:
+			size = 2
+			if pos+size <= len(data) {
+				this.columnMeta[i] = uint16(data[pos])<<8 | uint16(data[pos+1])
+			}
+		case protocol.MYSQL_TYPE_VARCHAR, protocol.MYSQL_TYPE_VAR_STRING, protocol.MYSQL_TYPE_BIT:
+			size = 2
+			if pos+size <= len(data) {
+				this.columnMeta[i] = binary.LittleEndian.Uint16(data[pos:])
+			}
+		case protocol.MYSQL_TYPE_BLOB, protocol.MYSQL_TYPE_TINY_BLOB, protocol.MYSQL_TYPE_MEDIUM_BLOB,
+			protocol.MYSQL_TYPE_LONG_BLOB, protocol.MYSQL_TYPE_FLOAT, protocol.MYSQL_TYPE_DOUBLE,
+			protocol.MYSQL_TYPE_GEOMETRY, protocol.MYSQL_TYPE_JSON, protocol.MYSQL_TYPE_TIMESTAMP2,
+			protocol.MYSQL_TYPE_DATETIME2, protocol.MYSQL_TYPE_TIME2:
+			size = 1
+			if pos+size <= len(data) {
+				this.columnMeta[i] = uint16(data[pos])
+			}
+		}
+		pos += size
+		if pos > len(data) {
+			return fmt.Errorf("table map event column meta too short, length: %d", len(data))
+		}
+	}
+	return nil
+}
+
+func (this *TableMapEvent) decodeOptionalMeta(data []byte) error {
+	proto := protocol.NewProto(data, 0)
+	need := func(size int) error {
+		if size < 0 || proto.GetOffset()+size > len(data) {
+			return fmt.Errorf("table map event optional metadata too short, length: %d", len(data))
+		}
+		return nil
+	}
+	for proto.Has_remaining_data() {
+		metaType := proto.Get_fixed_int(1)
+		length, err := readLenencInt(proto, need)
+		if err != nil {
+			return err
+		}
+		if proto.GetOffset()+length > len(data) {
+			return fmt.Errorf("table map event optional metadata %d too short, length: %d", metaType, length)
+		}
+		value := proto.Read(length)
+		switch metaType {
+		case TABLE_MAP_SIGNEDNESS:
+			this.signedness = decodeBitmapMSB(value, len(value)*8)
+		case TABLE_MAP_DEFAULT_CHARSET:
+			this.defaultCharset, this.charsetCollations, err = decodeDefaultCharset(value)
+		case TABLE_MAP_COLUMN_CHARSET:
+			this.columnCharset, err = decodeLenencInts(value)
+		case TABLE_MAP_COLUMN_NAME:
+			this.columnNames, err = decodeLenencStrs(value)
+		case TABLE_MAP_SET_STR_VALUE:
+			this.setStrValues, err = decodeStrValues(value)
+		case TABLE_MAP_ENUM_STR_VALUE:
+			this.enumStrValues, err = decodeStrValues(value)
+		case TABLE_MAP_GEOMETRY_TYPE:
+			this.geometryTypes, err = decodeLenencInts(value)
+		case TABLE_MAP_SIMPLE_PRIMARY_KEY:
+			this.primaryKey, err = decodeLenencInts(value)
+			this.primaryKeyPrefix = make([]int, len(this.primaryKey))
+		case TABLE_MAP_PRIMARY_KEY_WITH_PREFIX:
+			var pairs []int
+			pairs, err = decodeLenencInts(value)
+			this.primaryKey = make([]int, 0, len(pairs)/2)
+			this.primaryKeyPrefix = make([]int, 0, len(pairs)/2)
+			for i := 0; i+1 < len(pairs); i += 2 {
+				this.primaryKey = append(this.primaryKey, pairs[i])
+				this.primaryKeyPrefix = append(this.primaryKeyPrefix, pairs[i+1])
+			}
+		case TABLE_MAP_ENUM_AND_SET_DEFAULT_CHARSET:
+			this.enumSetDefaultCharset, this.enumSetCharsetCollations, err = decodeDefaultCharset(value)
+		case TABLE_MAP_ENUM_AND_SET_COLUMN_CHARSET:
+			this.enumSetColumnCharset, err = decodeLenencInts(value)
+		case TABLE_MAP_COLUMN_VISIBILITY:
+			this.visibility = decodeBitmapMSB(value, len(value)*8)
+		}
+		if err != nil {
+			return fmt.Errorf("decode table map event optional metadata %d error, err: %w", metaType, err)
+		}
+	}
+	return nil
+}
+
+/*
+* optional metadata 中的 bitmap 从每个字节的最高位开始
+ */
+func decodeBitmapMSB(data []byte, count int) []bool {
+	ret := make([]bool, count)
+	for i := 0; i < count; i++ {
+		ret[i] = data[i/8]&(0x80>>uint(i%8)) != 0
+	}
+	return ret
+}
+
+/*
+* default collation + (字符列序号, collation) 列表
+ */
+func decodeDefaultCharset(data []byte) (int, map[int]int, error) {
+	ints, err := decodeLenencInts(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	collations := make(map[int]int)
+	if len(ints) == 0 {
+		return 0, collations, nil
+	}
+	for i := 1; i+1 < len(ints); i += 2 {
+		collations[ints[i]] = ints[i+1]
+	}
+	return ints[0], collations, nil
+}
+
+/*
+* 读取 lenenc-int, 数据不足或第一个字节不是合法的长度前缀时返回错误
+ */
+func readLenencInt(proto *protocol.Proto, need func(size int) error) (int, error) {
+	err := need(1)
+	if err != nil {
+		return 0, err
+	}
+	var size int
+	switch first := proto.GetPacket()[proto.GetOffset()]; {
+	case first < 251:
+		size = 1
+	case first == 252:
+		size = 3
+	case first == 253:
+		size = 4
+	case first == 254:
+		size = 9
+	default:
+		return 0, fmt.Errorf("invalid length-encoded integer prefix 0x%02x", first)
+	}
+	err = need(size)
+	if err != nil {
+		return 0, err
+	}
+	value := proto.Get_lenenc_int()
+	if value < 0 {
+		return 0, fmt.Errorf("length-encoded integer overflow")
+	}
+	return value, nil
+}
+
+func newLenencProto(data []byte) (*protocol.Proto, func(size int) error) {
+	proto := protocol.NewProto(data, 0)
+	need := func(size int) error {
+		if size < 0 || proto.GetOffset()+size > len(data) {
+			return fmt.Errorf("length-encoded list too short, length: %d", len(data))
+		}
+		return nil
+	}
+	return proto, need
+}
+
+func decodeLenencInts(data []byte) ([]int, error) {
+	proto, need := newLenencProto(data)
+	ret := make([]int, 0)
+	for proto.Has_remaining_data() {
+		value, err := readLenencInt(proto, need)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, value)
+	}
+	return ret, nil
+}
+
+func decodeLenencStrs(data []byte) ([]string, error) {
+	proto, need := newLenencProto(data)
+	ret := make([]string, 0)
+	for proto.Has_remaining_data() {
+		value, err := readLenencStr(proto, need)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, value)
+	}
+	return ret, nil
+}
+
+func readLenencStr(proto *protocol.Proto, need func(size int) error) (string, error) {
+	length, err := readLenencInt(proto, need)
+	if err != nil {
+		return "", err
+	}
+	err = need(length)
+	if err != nil {
+		return "", err
+	}
+	return proto.Get_fixed_str(length), nil
+}
+
+/*
+* 每个 enum / set 列: lenenc 个数 + lenenc 字符串列表
+ */
+func decodeStrValues(data []byte) ([][]string, error) {
+	proto, need := newLenencProto(data)
+	ret := make([][]string, 0)
+	for proto.Has_remaining_data() {
+		count, err := readLenencInt(proto, need)
+		if err != nil {
+			return nil, err
+		}
+		// 每个字符串至少 1 字节长度
+		err = need(count)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]string, 0, count)
+		for i := 0; i < count; i++ {
+			value, err := readLenencStr(proto, need)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		ret = append(ret, values)
+	}
+	return ret, nil
+}
+
+/*
+* NULL-bitmask 等 bitmap 从每个字节的最低位开始
+ */
+func isBitSet(bitmap []byte, i int) bool {
+	if i/8 >= len(bitmap) {
+		return false
+	}
+	return bitmap[i/8]&(1<<uint(i%8)) != 0
+}
+
+/*
+* table id => TABLE_MAP_EVENT, rows event 按 table id 查找表结构
+* 语句结束 (rows event 带有 STMT_END_F) 后 table id 失效, 清空缓存
+ */
+type TableMapCache struct {
+	mu     sync.RWMutex
+	tables map[uint64]*TableMapEvent
+}
+
+func NewTableMapCache() *TableMapCache {
+	return &TableMapCache{
+		tables: make(map[uint64]*TableMapEvent),
+	}
+}
+
+func (this *TableMapCache) Get(tableId uint64) (*TableMapEvent, bool) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	table, ok := this.tables[tableId]
+	return table, ok
+}
+
+func (this *TableMapCache) Set(table *TableMapEvent) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.tables[table.GetTableId()] = table
+}
+
+func (this *TableMapCache) Clear() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.tables = make(map[uint64]*TableMapEvent)
+}
+
+func (this *TableMapCache) Len() int {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return len(this.tables)
+}
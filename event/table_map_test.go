@@ -0,0 +1,171 @@
+package event
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+/*
+* test.t1 (id int, name varchar(20), doc json), table id 1
+ */
+func buildTestTableMapBody() []byte {
+	body := []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00}
+	body = append(body, 4, 't', 'e', 's', 't', 0)
+	body = append(body, 2, 't', '1', 0)
+	body = append(body, 3, byte(protocol.MYSQL_TYPE_LONG), byte(protocol.MYSQL_TYPE_VARCHAR), byte(protocol.MYSQL_TYPE_JSON))
+	body = append(body, 3, 0x50, 0x00, 0x04)
+	return append(body, 0x06)
+}
+
+func TestTableMapEventTruncated(t *testing.T) {
+	body := buildTestTableMapBody()
+	ev := NewTableMapEvent()
+	if err := ev.Decode(NewFormatDescriptionEvent(), body); err != nil {
+		t.Fatalf("decode table map event error: %v", err)
+	}
+	// 直接调用 Decode, 不经过 Decoder 的 recover, 截断的 event 必须返回 error
+	for i := 0; i < len(body); i++ {
+		if err := NewTableMapEvent().Decode(NewFormatDescriptionEvent(), body[:i]); err == nil {
+			t.Errorf("expect error for table map event truncated to %d bytes", i)
+		}
+	}
+}
+
+func TestTableMapEventInvalidOptionalMeta(t *testing.T) {
+	tests := []struct {
+		name string
+		meta []byte
+	}{
+		{"length over data", []byte{TABLE_MAP_COLUMN_NAME, 10, 2, 'i', 'd'}},
+		{"invalid lenenc prefix", []byte{TABLE_MAP_COLUMN_NAME, 0xfb}},
+		{"column name over value", []byte{TABLE_MAP_COLUMN_NAME, 3, 5, 'i', 'd'}},
+		{"enum count over value", []byte{TABLE_MAP_ENUM_STR_VALUE, 2, 3, 1}},
+		{"charset truncated lenenc", []byte{TABLE_MAP_COLUMN_CHARSET, 1, 0xfc}},
+	}
+	for _, tt := range tests {
+		body := append(buildTestTableMapBody(), tt.meta...)
+		if err := NewTableMapEvent().Decode(NewFormatDescriptionEvent(), body); err == nil {
+			t.Errorf("%s: expect error", tt.name)
+		}
+	}
+}
+
+/*
+* test.t2 (id int unsigned primary key, name varchar(20), price decimal(10,2), color enum('r','g'), tags set('a','b'), pt point)
+ */
+func buildTestFullTableMapBody() []byte {
+	body := []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00}
+	body = append(body, 4, 't', 'e', 's', 't', 0)
+	body = append(body, 2, 't', '2', 0)
+	body = append(body, 6, byte(protocol.MYSQL_TYPE_LONG), byte(protocol.MYSQL_TYPE_VARCHAR), byte(protocol.MYSQL_TYPE_NEWDECIMAL),
+		byte(protocol.MYSQL_TYPE_STRING), byte(protocol.MYSQL_TYPE_STRING), byte(protocol.MYSQL_TYPE_GEOMETRY))
+	body = append(body, 9, 0x50, 0x00, 0x0a, 0x02, 0xf7, 0x01, 0xf8, 0x01, 0x04)
+	return append(body, 0x3e)
+}
+
+func buildTestOptionalMeta(metaType byte, value ...byte) []byte {
+	return append([]byte{metaType, byte(len(value))}, value...)
+}
+
+func TestTableMapEventFullMetadata(t *testing.T) {
+	columnNames := buildTestOptionalMeta(TABLE_MAP_COLUMN_NAME,
+		2, 'i', 'd', 4, 'n', 'a', 'm', 'e', 5, 'p', 'r', 'i', 'c', 'e', 5, 'c', 'o', 'l', 'o', 'r', 4, 't', 'a', 'g', 's', 2, 'p', 't')
+	common := append(buildTestOptionalMeta(TABLE_MAP_SIGNEDNESS, 0x80), columnNames...)
+	common = append(common, buildTestOptionalMeta(TABLE_MAP_SET_STR_VALUE, 2, 1, 'a', 1, 'b')...)
+	common = append(common, buildTestOptionalMeta(TABLE_MAP_ENUM_STR_VALUE, 2, 1, 'r', 1, 'g')...)
+	common = append(common, buildTestOptionalMeta(TABLE_MAP_GEOMETRY_TYPE, 1)...)
+
+	// binlog_row_metadata=FULL, 字符集与表的默认字符集相同
+	defaultCharset := append([]byte(nil), common...)
+	defaultCharset = append(defaultCharset, buildTestOptionalMeta(TABLE_MAP_DEFAULT_CHARSET, 0xfc, 0xff, 0x00)...)
+	defaultCharset = append(defaultCharset, buildTestOptionalMeta(TABLE_MAP_SIMPLE_PRIMARY_KEY, 0)...)
+	defaultCharset = append(defaultCharset, buildTestOptionalMeta(TABLE_MAP_ENUM_AND_SET_DEFAULT_CHARSET, 8, 1, 33)...)
+	defaultCharset = append(defaultCharset, buildTestOptionalMeta(TABLE_MAP_COLUMN_VISIBILITY, 0xf8)...)
+
+	// 每列字符集不同, 主键带前缀
+	columnCharset := append([]byte(nil), common...)
+	columnCharset = append(columnCharset, buildTestOptionalMeta(TABLE_MAP_COLUMN_CHARSET, 46)...)
+	columnCharset = append(columnCharset, buildTestOptionalMeta(TABLE_MAP_PRIMARY_KEY_WITH_PREFIX, 0, 0, 1, 10)...)
+	columnCharset = append(columnCharset, buildTestOptionalMeta(TABLE_MAP_ENUM_AND_SET_COLUMN_CHARSET, 8, 33)...)
+	// 不认识的类型被跳过
+	columnCharset = append(columnCharset, buildTestOptionalMeta(0x7f, 0x01, 0x02)...)
+
+	tests := []struct {
+		name              string
+		meta              []byte
+		collations        map[int]int
+		enumSetCollations map[int]int
+		primaryKey        []int
+		primaryKeyPrefix  []int
+		visibility        map[int]bool
+	}{
+		{"default charset", defaultCharset, map[int]int{1: 255}, map[int]int{3: 8, 4: 33}, []int{0}, []int{0},
+			map[int]bool{0: true, 1: true, 2: true, 3: true, 4: true, 5: false}},
+		{"column charset", columnCharset, map[int]int{1: 46}, map[int]int{3: 8, 4: 33}, []int{0, 1}, []int{0, 10}, nil},
+	}
+
+	for _, tt := range tests {
+		ev := NewTableMapEvent()
+		if err := ev.Decode(NewFormatDescriptionEvent(), append(buildTestFullTableMapBody(), tt.meta...)); err != nil {
+			t.Errorf("%s: decode error: %v", tt.name, err)
+			continue
+		}
+		if ev.GetTableId() != 2 || ev.GetSchema() != "test" || ev.GetTable() != "t2" || ev.GetColumnCount() != 6 {
+			t.Errorf("%s: unexpected table: id %d, %s.%s, %d columns", tt.name, ev.GetTableId(), ev.GetSchema(), ev.GetTable(), ev.GetColumnCount())
+		}
+		if expect := []uint16{0, 80, 0x0a02, 0xf701, 0xf801, 4}; !reflect.DeepEqual(ev.GetColumnMeta(), expect) {
+			t.Errorf("%s: expect column meta %v, got %v", tt.name, expect, ev.GetColumnMeta())
+		}
+		if ev.GetRealType(3) != protocol.MYSQL_TYPE_ENUM || ev.GetRealType(4) != protocol.MYSQL_TYPE_SET {
+			t.Errorf("%s: expect enum and set, got %d and %d", tt.name, ev.GetRealType(3), ev.GetRealType(4))
+		}
+		if ev.IsNullable(0) || !ev.IsNullable(5) {
+			t.Errorf("%s: unexpected null bitmap", tt.name)
+		}
+		if expect := map[int]bool{0: true, 2: false}; !reflect.DeepEqual(ev.UnsignedMap(), expect) {
+			t.Errorf("%s: expect unsigned %v, got %v", tt.name, expect, ev.UnsignedMap())
+		}
+		if expect := []string{"id", "name", "price", "color", "tags", "pt"}; !reflect.DeepEqual(ev.GetColumnNames(), expect) {
+			t.Errorf("%s: expect column names %v, got %v", tt.name, expect, ev.GetColumnNames())
+		}
+		if expect := [][]string{{"r", "g"}}; !reflect.DeepEqual(ev.GetEnumStrValues(), expect) {
+			t.Errorf("%s: expect enum values %v, got %v", tt.name, expect, ev.GetEnumStrValues())
+		}
+		if expect := [][]string{{"a", "b"}}; !reflect.DeepEqual(ev.GetSetStrValues(), expect) {
+			t.Errorf("%s: expect set values %v, got %v", tt.name, expect, ev.GetSetStrValues())
+		}
+		if expect := []int{1}; !reflect.DeepEqual(ev.GetGeometryTypes(), expect) {
+			t.Errorf("%s: expect geometry types %v, got %v", tt.name, expect, ev.GetGeometryTypes())
+		}
+		if !reflect.DeepEqual(ev.CollationMap(), tt.collations) {
+			t.Errorf("%s: expect collations %v, got %v", tt.name, tt.collations, ev.CollationMap())
+		}
+		if !reflect.DeepEqual(ev.EnumSetCollationMap(), tt.enumSetCollations) {
+			t.Errorf("%s: expect enum and set collations %v, got %v", tt.name, tt.enumSetCollations, ev.EnumSetCollationMap())
+		}
+		if !reflect.DeepEqual(ev.GetPrimaryKey(), tt.primaryKey) || !reflect.DeepEqual(ev.GetPrimaryKeyPrefix(), tt.primaryKeyPrefix) {
+			t.Errorf("%s: expect primary key %v %v, got %v %v", tt.name, tt.primaryKey, tt.primaryKeyPrefix, ev.GetPrimaryKey(), ev.GetPrimaryKeyPrefix())
+		}
+		if !reflect.DeepEqual(ev.VisibilityMap(), tt.visibility) {
+			t.Errorf("%s: expect visibility %v, got %v", tt.name, tt.visibility, ev.VisibilityMap())
+		}
+	}
+}
+
+/*
+* binlog_row_metadata=MINIMAL 或 5.7 之前没有 optional metadata
+ */
+func TestTableMapEventWithoutOptionalMetadata(t *testing.T) {
+	ev := NewTableMapEvent()
+	if err := ev.Decode(NewFormatDescriptionEvent(), buildTestFullTableMapBody()); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if ev.UnsignedMap() != nil || ev.CollationMap() != nil || ev.EnumSetCollationMap() != nil || ev.VisibilityMap() != nil {
+		t.Errorf("expect nil maps without optional metadata")
+	}
+	if ev.GetColumnNames() != nil || ev.GetPrimaryKey() != nil {
+		t.Errorf("expect no column names and primary key without optional metadata")
+	}
+}
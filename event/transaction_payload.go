@@ -0,0 +1,129 @@
+package event
+
+import (
+	"fmt"
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+// TRANSACTION_PAYLOAD_EVENT header 中的字段类型
+const (
+	OTW_PAYLOAD_HEADER_END_MARK   = 0
+	OTW_PAYLOAD_SIZE_FIELD        = 1
+	OTW_PAYLOAD_COMPRESSION_TYPE  = 2
+	OTW_PAYLOAD_UNCOMPRESSED_SIZE = 3
+)
+
+// TRANSACTION_PAYLOAD_EVENT 的压缩算法
+const (
+	PAYLOAD_COMPRESSION_ZSTD = 0
+	PAYLOAD_COMPRESSION_NONE = 255
+)
+
+/*
+* TRANSACTION_PAYLOAD_EVENT, binlog_transaction_compression=ON 时把整个事务的 event 压缩后放在一个 event 中
+* header 由若干个字段组成, 以 OTW_PAYLOAD_HEADER_END_MARK 结束, 每个字段为:
+* lenenc_int     type
+* lenenc_int     length
+* lenenc_int     value
+* 之后到 event 结束为压缩后的 payload, 解压后是连续的完整 event, 不带 checksum
+* payload 中的 event 由 Decoder 解码后放入 events
+ */
+type TransactionPayloadEvent struct {
+	*BaseEvent
+	payloadSize      uint64
+	compressionType  uint64
+	uncompressedSize uint64
+	payload          []byte
+	events           []Event
+}
+
+func NewTransactionPayloadEvent() *TransactionPayloadEvent {
+	return &TransactionPayloadEvent{
+		BaseEvent:        NewBaseEvent(),
+		payloadSize:      0,
+		compressionType:  PAYLOAD_COMPRESSION_NONE,
+		uncompressedSize: 0,
+		payload:          nil,
+		events:           make([]Event, 0),
+	}
+}
+
+func (this *TransactionPayloadEvent) GetPayloadSize() uint64 {
+	return this.payloadSize
+}
+
+func (this *TransactionPayloadEvent) GetCompressionType() uint64 {
+	return this.compressionType
+}
+
+func (this *TransactionPayloadEvent) GetUncompressedSize() uint64 {
+	return this.uncompressedSize
+}
+
+/*
+* 压缩后的 payload
+ */
+func (this *TransactionPayloadEvent) GetPayload() []byte {
+	return this.payload
+}
+
+/*
+* payload 中解码后的 event
+ */
+func (this *TransactionPayloadEvent) GetEvents() []Event {
+	return this.events
+}
+
+func (this *TransactionPayloadEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	proto := protocol.NewProto(body, 0)
+	need := func(size int) error {
+		if size < 0 || proto.GetOffset()+size > len(body) {
+			return fmt.Errorf("transaction payload event header too short, length: %d", len(body))
+		}
+		return nil
+	}
+	for {
+		if !proto.Has_remaining_data() {
+			return fmt.Errorf("transaction payload event header without end mark")
+		}
+		fieldType, err := readLenencInt(proto, need)
+		if err != nil {
+			return err
+		}
+		if fieldType == OTW_PAYLOAD_HEADER_END_MARK {
+			break
+		}
+		fieldLength, err := readLenencInt(proto, need)
+		if err != nil {
+			return err
+		}
+		fieldEnd := proto.GetOffset() + fieldLength
+		if fieldEnd > len(body) {
+			return fmt.Errorf("transaction payload event field %d too long, length: %d", fieldType, fieldLength)
+		}
+		var value int
+		switch fieldType {
+		case OTW_PAYLOAD_SIZE_FIELD, OTW_PAYLOAD_COMPRESSION_TYPE, OTW_PAYLOAD_UNCOMPRESSED_SIZE:
+			value, err = readLenencInt(proto, need)
+			if err != nil {
+				return err
+			}
+		}
+		switch fieldType {
+		case OTW_PAYLOAD_SIZE_FIELD:
+			this.payloadSize = uint64(value)
+		case OTW_PAYLOAD_COMPRESSION_TYPE:
+			this.compressionType = uint64(value)
+		case OTW_PAYLOAD_UNCOMPRESSED_SIZE:
+			this.uncompressedSize = uint64(value)
+		}
+		// 跳过不认识的字段
+		proto.SetOffset(fieldEnd)
+	}
+
+	this.payload = body[proto.GetOffset():]
+	if this.payloadSize != 0 && uint64(len(this.payload)) != this.payloadSize {
+		return fmt.Errorf("transaction payload size mismatch, expect: %d, actual: %d", this.payloadSize, len(this.payload))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package event
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/goMySQLSemiSync/constants"
+	"github.com/goMySQLSemiSync/protocol"
+	"github.com/klauspost/compress/zstd"
+)
+
+func buildTestEvent(eventType int, body []byte) []byte {
+	data := make([]byte, EVENT_HEADER_LENGTH, EVENT_HEADER_LENGTH+len(body))
+	data[4] = byte(eventType)
+	binary.LittleEndian.PutUint32(data[9:13], uint32(EVENT_HEADER_LENGTH+len(body)))
+	return append(data, body...)
+}
+
+func buildTestPayloadBody(uncompressedSize int, compressed []byte) []byte {
+	body := make([]byte, 0)
+	body = append(body, protocol.Build_lenenc_int(OTW_PAYLOAD_COMPRESSION_TYPE)...)
+	body = append(body, 1, PAYLOAD_COMPRESSION_ZSTD)
+	body = append(body, protocol.Build_lenenc_int(OTW_PAYLOAD_UNCOMPRESSED_SIZE)...)
+	size := protocol.Build_lenenc_int(uncompressedSize)
+	body = append(body, protocol.Build_lenenc_int(len(size))...)
+	body = append(body, size...)
+	body = append(body, protocol.Build_lenenc_int(OTW_PAYLOAD_SIZE_FIELD)...)
+	size = protocol.Build_lenenc_int(len(compressed))
+	body = append(body, protocol.Build_lenenc_int(len(size))...)
+	body = append(body, size...)
+	body = append(body, OTW_PAYLOAD_HEADER_END_MARK)
+	return append(body, compressed...)
+}
+
+func TestTransactionPayloadEventDecode(t *testing.T) {
+	xid := make([]byte, 8)
+	binary.LittleEndian.PutUint64(xid, 42)
+	inner := append(buildTestEvent(constants.QUERY_EVENT, append([]byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, "BEGIN"...)),
+		buildTestEvent(constants.XID_EVENT, xid)...)
+
+	encoder, _ := zstd.NewWriter(nil)
+	compressed := encoder.EncodeAll(inner, nil)
+
+	body := buildTestPayloadBody(len(inner), compressed)
+
+	decoder := NewDecoder()
+	decoder.SetChecksumAlg(constants.BINLOG_CHECKSUM_ALG_OFF)
+	ev, err := decoder.Decode(buildTestEvent(constants.TRANSACTION_PAYLOAD_EVENT, body))
+	if err != nil {
+		t.Fatalf("decode transaction payload error: %v", err)
+	}
+	events := ev.(*TransactionPayloadEvent).GetEvents()
+	if len(events) != 2 {
+		t.Fatalf("expect 2 inner events, got %d", len(events))
+	}
+	if query, ok := events[0].(*QueryEvent); !ok || !query.IsBegin() {
+		t.Errorf("expect BEGIN query event, got %#v", events[0])
+	}
+	if xidEvent, ok := events[1].(*XidEvent); !ok || xidEvent.GetXid() != 42 {
+		t.Errorf("expect xid event 42, got %#v", events[1])
+	}
+}
+
+func TestTransactionPayloadEventUncompressedSize(t *testing.T) {
+	xid := make([]byte, 8)
+	binary.LittleEndian.PutUint64(xid, 42)
+	inner := buildTestEvent(constants.XID_EVENT, xid)
+	encoder, _ := zstd.NewWriter(nil)
+	compressed := encoder.EncodeAll(inner, nil)
+
+	cases := []struct {
+		name             string
+		uncompressedSize int
+		ok               bool
+	}{
+		{"exact size", len(inner), true},
+		{"size mismatch", len(inner) + 1, false},
+		// header 声明的长度不可信, 不能按它分配内存
+		{"size larger than limit", MAX_PAYLOAD_UNCOMPRESSED_SIZE + 1, false},
+		{"size within limit but much larger than payload", MAX_PAYLOAD_UNCOMPRESSED_SIZE, false},
+	}
+	decoder := NewDecoder()
+	decoder.SetChecksumAlg(constants.BINLOG_CHECKSUM_ALG_OFF)
+	defer decoder.Close()
+	for _, c := range cases {
+		_, err := decoder.Decode(buildTestEvent(constants.TRANSACTION_PAYLOAD_EVENT, buildTestPayloadBody(c.uncompressedSize, compressed)))
+		if c.ok && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%s: expect error", c.name)
+		}
+		// Close 之后仍可以解码, 解压器重新创建
+		decoder.Close()
+	}
+}
+
+func TestTransactionPayloadEventTruncatedHeader(t *testing.T) {
+	body := buildTestPayloadBody(16, []byte{0x01, 0x02})
+	// header 到 end mark 为止
+	headerLength := len(body) - 2
+	for i := 0; i < headerLength; i++ {
+		if err := NewTransactionPayloadEvent().Decode(NewFormatDescriptionEvent(), body[:i]); err == nil {
+			t.Errorf("expect error for transaction payload header truncated to %d bytes", i)
+		}
+	}
+	// 字段值的 lenenc-int 超出 event
+	invalid := append(protocol.Build_lenenc_int(OTW_PAYLOAD_UNCOMPRESSED_SIZE), 0x01, 0xfe)
+	if err := NewTransactionPayloadEvent().Decode(NewFormatDescriptionEvent(), invalid); err == nil {
+		t.Errorf("expect error for truncated field value")
+	}
+}
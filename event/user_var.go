@@ -0,0 +1,162 @@
+package event
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// USER_VAR_EVENT 的值类型, 即 server 中的 Item_result
+const (
+	STRING_RESULT  = 0
+	REAL_RESULT    = 1
+	INT_RESULT     = 2
+	ROW_RESULT     = 3
+	DECIMAL_RESULT = 4
+)
+
+// USER_VAR_EVENT 的 flags
+const (
+	USER_VAR_UNSIGNED_F = 0x01
+)
+
+/*
+* USER_VAR_EVENT, 基于语句复制时, 在 QUERY_EVENT 之前记录语句用到的用户变量
+* 4              name length
+* string[len]    name
+* 1              is_null
+* 值不为 NULL 时:
+* 1              type, Item_result
+* 4              charset number
+* 4              value length
+* string[len]    value
+* 1              flags, 可选, 5.6 以后才有
+ */
+type UserVarEvent struct {
+	*BaseEvent
+	name    string
+	isNull  bool
+	varType uint8
+	charset uint32
+	value   interface{}
+	flags   uint8
+}
+
+func NewUserVarEvent() *UserVarEvent {
+	return &UserVarEvent{
+		BaseEvent: NewBaseEvent(),
+		name:      "",
+		isNull:    false,
+		varType:   STRING_RESULT,
+		charset:   0,
+		value:     nil,
+		flags:     0,
+	}
+}
+
+func (this *UserVarEvent) GetName() string {
+	return this.name
+}
+
+func (this *UserVarEvent) IsNull() bool {
+	return this.isNull
+}
+
+func (this *UserVarEvent) GetType() uint8 {
+	return this.varType
+}
+
+func (this *UserVarEvent) GetCharset() uint32 {
+	return this.charset
+}
+
+func (this *UserVarEvent) GetFlags() uint8 {
+	return this.flags
+}
+
+func (this *UserVarEvent) IsUnsigned() bool {
+	return this.flags&USER_VAR_UNSIGNED_F != 0
+}
+
+/*
+* 变量的值, NULL 时为 nil
+* STRING_RESULT 为 []byte, 按 charset 解释; REAL_RESULT 为 float64
+* INT_RESULT 为 int64, 带 USER_VAR_UNSIGNED_F 时为 uint64; DECIMAL_RESULT 为精确的字符串
+ */
+func (this *UserVarEvent) GetValue() interface{} {
+	return this.value
+}
+
+func (this *UserVarEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	if len(body) < 5 {
+		return fmt.Errorf("user var event too short, length: %d", len(body))
+	}
+	pos := 0
+	nameLength := int(binary.LittleEndian.Uint32(body[pos : pos+4]))
+	pos += 4
+	if len(body) < pos+nameLength+1 {
+		return fmt.Errorf("user var event too short, name length: %d, length: %d", nameLength, len(body))
+	}
+	this.name = string(body[pos : pos+nameLength])
+	pos += nameLength
+	this.isNull = body[pos] != 0
+	pos += 1
+	if this.isNull {
+		this.value = nil
+		return nil
+	}
+
+	if len(body) < pos+9 {
+		return fmt.Errorf("user var event too short, length: %d", len(body))
+	}
+	this.varType = body[pos]
+	pos += 1
+	this.charset = binary.LittleEndian.Uint32(body[pos : pos+4])
+	pos += 4
+	valueLength := int(binary.LittleEndian.Uint32(body[pos : pos+4]))
+	pos += 4
+	if len(body) < pos+valueLength {
+		return fmt.Errorf("user var event too short, value length: %d, length: %d", valueLength, len(body))
+	}
+	data := body[pos : pos+valueLength]
+	pos += valueLength
+	if len(body) > pos {
+		this.flags = body[pos]
+	}
+
+	value, err := this.decodeUserVarValue(data)
+	if err != nil {
+		return err
+	}
+	this.value = value
+	return nil
+}
+
+func (this *UserVarEvent) decodeUserVarValue(data []byte) (interface{}, error) {
+	switch this.varType {
+	case STRING_RESULT:
+		return data, nil
+	case REAL_RESULT:
+		if len(data) < 8 {
+			return nil, fmt.Errorf("user var %s real value too short, length: %d", this.name, len(data))
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data[0:8])), nil
+	case INT_RESULT:
+		if len(data) < 8 {
+			return nil, fmt.Errorf("user var %s int value too short, length: %d", this.name, len(data))
+		}
+		if this.IsUnsigned() {
+			return binary.LittleEndian.Uint64(data[0:8]), nil
+		}
+		return int64(binary.LittleEndian.Uint64(data[0:8])), nil
+	case DECIMAL_RESULT:
+		// 1 字节 precision, 1 字节 scale, 之后是与 NEWDECIMAL 列相同的二进制格式
+		if len(data) < 2 {
+			return nil, fmt.Errorf("user var %s decimal value too short, length: %d", this.name, len(data))
+		}
+		value, _, err := decodeNewDecimal(data[2:], int(data[0]), int(data[1]))
+		return value, err
+	default:
+		return nil, fmt.Errorf("user var %s has unknown type %d", this.name, this.varType)
+	}
+}
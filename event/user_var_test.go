@@ -0,0 +1,43 @@
+package event
+
+import (
+	"testing"
+)
+
+func buildUserVarBody(name string, varType byte, value []byte, flags byte) []byte {
+	body := []byte{byte(len(name)), 0, 0, 0}
+	body = append(body, name...)
+	body = append(body, 0, varType, 33, 0, 0, 0, byte(len(value)), 0, 0, 0)
+	body = append(body, value...)
+	return append(body, flags)
+}
+
+func TestUserVarEventDecode(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   []byte
+		expect interface{}
+	}{
+		{"string", buildUserVarBody("a", STRING_RESULT, []byte("abc"), 0), "abc"},
+		{"real", buildUserVarBody("b", REAL_RESULT, []byte{0, 0, 0, 0, 0, 0, 0xf8, 0x3f}, 0), float64(1.5)},
+		{"int", buildUserVarBody("c", INT_RESULT, []byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, 0), int64(-2)},
+		{"unsigned", buildUserVarBody("d", INT_RESULT, []byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, USER_VAR_UNSIGNED_F), uint64(18446744073709551614)},
+		{"decimal", buildUserVarBody("e", DECIMAL_RESULT, []byte{8, 4, 0x84, 0xd2, 0x16, 0x2e}, 0), "1234.5678"},
+		{"null", []byte{1, 0, 0, 0, 'f', 1}, nil},
+	}
+	for _, c := range cases {
+		ev := NewUserVarEvent()
+		err := ev.Decode(NewFormatDescriptionEvent(), c.body)
+		if err != nil {
+			t.Errorf("%s: decode error: %v", c.name, err)
+			continue
+		}
+		value := ev.GetValue()
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		if value != c.expect {
+			t.Errorf("%s: expect %v (%T), got %v (%T)", c.name, c.expect, c.expect, value, value)
+		}
+	}
+}
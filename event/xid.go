@@ -0,0 +1,34 @@
+package event
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+* XID_EVENT, 事务引擎的事务提交时写入, 代替 COMMIT 语句
+* 8              xid
+ */
+type XidEvent struct {
+	*BaseEvent
+	xid uint64
+}
+
+func NewXidEvent() *XidEvent {
+	return &XidEvent{
+		BaseEvent: NewBaseEvent(),
+		xid:       0,
+	}
+}
+
+func (this *XidEvent) GetXid() uint64 {
+	return this.xid
+}
+
+func (this *XidEvent) Decode(format *FormatDescriptionEvent, body []byte) error {
+	if len(body) < 8 {
+		return fmt.Errorf("xid event too short, length: %d", len(body))
+	}
+	this.xid = binary.LittleEndian.Uint64(body[0:8])
+	return nil
+}
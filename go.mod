@@ -3,6 +3,8 @@ module github.com/goMySQLSemiSync
 go 1.14
 
 require (
+	github.com/go-sql-driver/mysql v1.5.0
+	github.com/klauspost/compress v1.11.13
 	github.com/mailru/easyjson v0.7.6
 	github.com/wonderivan/logger v1.0.0
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
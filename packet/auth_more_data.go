@@ -0,0 +1,45 @@
+package packet
+
+import (
+	"fmt"
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+/* AuthMoreData packet
+1              [01]
+string[EOF]    plugin provided data
+*/
+type AuthMoreData struct {
+	*protocol.Packet
+	authData []byte
+}
+
+func NewAuthMoreData() *AuthMoreData {
+	return &AuthMoreData{
+		Packet:   protocol.NewPacket(),
+		authData: []byte{},
+	}
+}
+
+func (a *AuthMoreData) GetAuthData() []byte {
+	return a.authData
+}
+
+func (a *AuthMoreData) GetPayload() []byte {
+	payload := make([]byte, 0)
+	payload = append(payload, protocol.Build_byte(byte(protocol.AUTH_MORE_DATA))...)
+	payload = append(payload, a.authData...)
+	return payload
+}
+
+func LoadFromPacketToAuthMoreData(packet *protocol.Packet) (*AuthMoreData, error) {
+	if len(packet.Payload) == 0 || packet.GetType() != byte(protocol.AUTH_MORE_DATA) {
+		return nil, fmt.Errorf("not an auth more data packet")
+	}
+
+	a := NewAuthMoreData()
+	a.Packet = packet
+	a.SequenceId = packet.SequenceId
+	a.authData = packet.Payload[1:]
+	return a, nil
+}
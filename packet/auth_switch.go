@@ -0,0 +1,64 @@
+package packet
+
+import (
+	"fmt"
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+/* AuthSwitchRequest packet
+1              [fe]
+string[NUL]    plugin name
+string[EOF]    auth plugin data
+*/
+type AuthSwitchRequest struct {
+	*protocol.Packet
+	pluginName string
+	authData   []byte
+}
+
+func NewAuthSwitchRequest() *AuthSwitchRequest {
+	return &AuthSwitchRequest{
+		Packet:     protocol.NewPacket(),
+		pluginName: "",
+		authData:   []byte{},
+	}
+}
+
+func (a *AuthSwitchRequest) GetPluginName() string {
+	return a.pluginName
+}
+
+func (a *AuthSwitchRequest) GetAuthData() []byte {
+	return a.authData
+}
+
+func (a *AuthSwitchRequest) GetPayload() []byte {
+	payload := make([]byte, 0)
+	payload = append(payload, protocol.Build_byte(byte(protocol.EOF))...)
+	payload = append(payload, protocol.Build_null_str(a.pluginName)...)
+	payload = append(payload, a.authData...)
+	return payload
+}
+
+func LoadFromPacketToAuthSwitchRequest(packet *protocol.Packet) (*AuthSwitchRequest, error) {
+	if len(packet.Payload) == 0 || packet.GetType() != byte(protocol.EOF) {
+		return nil, fmt.Errorf("not an auth switch request packet")
+	}
+	// 只有 0xfe 一个字节的是 old password 的 AuthSwitchRequest, 不支持
+	if len(packet.Payload) == 1 {
+		return nil, fmt.Errorf("server requested the unsupported mysql_old_password auth method")
+	}
+
+	a := NewAuthSwitchRequest()
+	a.Packet = packet
+	proto := protocol.NewProto(packet.ToPacket(), 3)
+	a.SequenceId = proto.Get_fixed_int(1)
+	proto.Get_filler(1)
+	a.pluginName = proto.Get_null_str()
+	a.authData = proto.Read(len(proto.GetPacket()) - proto.GetOffset())
+	// auth data 以 NUL 结尾
+	if len(a.authData) > 0 && a.authData[len(a.authData)-1] == 0x00 {
+		a.authData = a.authData[:len(a.authData)-1]
+	}
+	return a, nil
+}
@@ -127,7 +127,7 @@ func (c *Challenge)  getPayload() []byte{
 	if c.hasCapabilityFlag(protocol.CLIENT_PLUGIN_AUTH) {
 		payload = append(payload, protocol.Build_fixed_int(1, c.authPluginDataLength)...)
 	} else {
-		payload = append(protocol.Build_filler(1, 0x00))
+		payload = append(payload, protocol.Build_filler(1, 0x00)...)
 	}
 	payload = append(payload, protocol.Build_filler(10, 0x00)...)
 
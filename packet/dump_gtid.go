@@ -3,8 +3,8 @@ package packet
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"github.com/goMySQLSemiSync/protocol"
-	"strings"
 )
 
 type DumpGtid struct {
@@ -85,8 +85,14 @@ func NewDumpGtid() *DumpGtid{
 //# In this gtid, 19d69c1e-ae97-4b8c-a1ef-9e12ba966457 is the sid
 //# and have two intervals, 1-3 and 8-10, 1 is the start position of
 //# the first interval 3 is the stop position of the first interval.
-func (d *DumpGtid) GetPayload() []byte {
+//
+//# 这个格式没有 gtid tag, 带 tag 的 gtid 集合返回错误
+func (d *DumpGtid) GetPayload() ([]byte, error) {
 	gtidSet := d.gtidSet
+	encoded_data, err := gtidSet.Encoded()
+	if err != nil {
+		return nil, err
+	}
 	encoded_data_size := gtidSet.EncodeLength()
 	header_size := (1 +
 		2 +    //binlog_flags
@@ -137,9 +143,9 @@ func (d *DumpGtid) GetPayload() []byte {
 	buf.Write(b)
 
 	//encoded_data
-	buf.Write(gtidSet.Encoded())
+	buf.Write(encoded_data)
 
-	return  buf.Bytes()
+	return  buf.Bytes(), nil
 }
 
 //func (d *DumpGtid) GetPayload() []byte {
@@ -174,16 +180,17 @@ func (d *DumpGtid) GetPayload() []byte {
 //	return data
 //}
 
-func (this *DumpGtid) GetPurgedGtidSet(gtid_purged string) *protocol.GtidSet{
-	gtidSet := protocol.NewGtidSet()
-	if gtid_purged == "" {
-		return gtidSet
+/*
+* 解析配置中的 gtid_purged, 格式错误时返回带位置的错误
+*/
+func (this *DumpGtid) GetPurgedGtidSet(gtid_purged string) (*protocol.GtidSet, error){
+	gtidSet, err := protocol.ParseGtidSet(gtid_purged)
+	if err != nil {
+		return nil, err
 	}
-
-	purged_gtid_slice := strings.Split(gtid_purged, ",")
-	for _, gtidStr := range purged_gtid_slice {
-		gtid := protocol.Parse(gtidStr)
-		gtidSet.Add(gtid)
+	// tag 只用于解析, COM_BINLOG_DUMP_GTID 的编码格式没有 tag
+	if gtidSet.HasTags() {
+		return nil, fmt.Errorf("tagged gtid is not supported by COM_BINLOG_DUMP_GTID, gtid_purged: %s", gtid_purged)
 	}
-	return gtidSet
-}
\ No newline at end of file
+	return gtidSet, nil
+}
@@ -12,6 +12,7 @@ type DumpPos struct {
 	serverId int
 	logFile string
 	logPos int64
+	flags int
 }
 
 func NewDumpPos() *DumpPos {
@@ -20,6 +21,7 @@ func NewDumpPos() *DumpPos {
 		serverId: 0,
 		logFile:  "",
 		logPos:   0,
+		flags:    0,
 	}
 }
 
@@ -35,6 +37,10 @@ func (this *DumpPos) SetLogPos(logPos int64) {
 	this.logPos = logPos
 }
 
+func (this *DumpPos) SetFlags(flags int) {
+	this.flags = flags
+}
+
 //func NewDumpPos(serverId int, logFile string, logPos int64) *DumpPos {
 //	return &DumpPos{
 //		Packet:   protocol.NewPacket(),
@@ -57,8 +63,7 @@ func (this *DumpPos) GetPayload() []byte {
 	buf.WriteByte(byte(constants.COM_BINLOG_DUMP))
 
 	binary.Write(&buf, binary.LittleEndian, uint32(this.logPos))
-	flags := 0
-	binary.Write(&buf, binary.LittleEndian, uint16(flags))
+	binary.Write(&buf, binary.LittleEndian, uint16(this.flags))
 	binary.Write(&buf, binary.LittleEndian, uint32(this.serverId))
 	buf.WriteString(this.logFile)
 
@@ -7,18 +7,101 @@ import (
 	"github.com/goMySQLSemiSync/protocol"
 )
 
+const (
+	LOGICAL_TIMESTAMP_TYPECODE = 2
+	// immediate_commit_timestamp 的最高位为 1 时, 后面有 original_commit_timestamp
+	ENCODED_COMMIT_TIMESTAMP_LENGTH = 55
+	// immediate_server_version 的最高位为 1 时, 后面有 original_server_version
+	ENCODED_SERVER_VERSION_LENGTH = 31
+)
+
+/*
+* GTID_LOG_EVENT / ANONYMOUS_GTID_LOG_EVENT
+* 1              flags, 1 表示 commit
+* 16             sid
+* 8              gno
+* 1              lt_type, 5.7 之后, LOGICAL_TIMESTAMP_TYPECODE
+* 8              last_committed, 5.7 之后
+* 8              sequence_number, 5.7 之后
+* 7              immediate_commit_timestamp, 8.0.1 之后, 微秒, 最高位为 1 时后面有 original_commit_timestamp
+* 7              original_commit_timestamp, 可选
+* lenenc-int     transaction_length, 8.0.2 之后
+* 4              immediate_server_version, 8.0.14 之后, 最高位为 1 时后面有 original_server_version
+* 4              original_server_version, 可选
+ */
 type GtidEvent struct {
 	*protocol.Packet
 	commit_flag bool
 	sid string
 	gno uint64
 	gtid string
+	lt_type int
+	last_committed int64
+	sequence_number int64
+	immediate_commit_timestamp uint64
+	original_commit_timestamp uint64
+	transaction_length uint64
+	immediate_server_version uint32
+	original_server_version uint32
 }
 
 func (this *GtidEvent) GetGtid() string {
 	return this.gtid
 }
 
+func (this *GtidEvent) GetCommitFlag() bool {
+	return this.commit_flag
+}
+
+func (this *GtidEvent) GetSid() string {
+	return this.sid
+}
+
+func (this *GtidEvent) GetGno() uint64 {
+	return this.gno
+}
+
+func (this *GtidEvent) GetLtType() int {
+	return this.lt_type
+}
+
+func (this *GtidEvent) GetLastCommitted() int64 {
+	return this.last_committed
+}
+
+func (this *GtidEvent) GetSequenceNumber() int64 {
+	return this.sequence_number
+}
+
+/*
+* 当前服务器提交的时间, unix 微秒, 0 表示没有记录
+ */
+func (this *GtidEvent) GetImmediateCommitTimestamp() uint64 {
+	return this.immediate_commit_timestamp
+}
+
+/*
+* 事务在源头服务器提交的时间, unix 微秒, 0 表示没有记录
+ */
+func (this *GtidEvent) GetOriginalCommitTimestamp() uint64 {
+	return this.original_commit_timestamp
+}
+
+/*
+* 事务的总长度, 包含 GTID_LOG_EVENT 本身
+ */
+func (this *GtidEvent) GetTransactionLength() uint64 {
+	return this.transaction_length
+}
+
+func (this *GtidEvent) GetImmediateServerVersion() uint32 {
+	return this.immediate_server_version
+}
+
+func (this *GtidEvent) GetOriginalServerVersion() uint32 {
+	return this.original_server_version
+}
+
 func NewGtidEvent() *GtidEvent {
 	return &GtidEvent{
 		Packet:      protocol.NewPacket(),
@@ -26,10 +109,44 @@ func NewGtidEvent() *GtidEvent {
 		sid:         "",
 		gno:         0,
 		gtid:        "",
+		lt_type:     0,
+		last_committed: 0,
+		sequence_number: 0,
+		immediate_commit_timestamp: 0,
+		original_commit_timestamp: 0,
+		transaction_length: 0,
+		immediate_server_version: 0,
+		original_server_version: 0,
+	}
+}
+
+/*
+* 读取 lenenc int, 长度超出 packet 时返回错误
+ */
+func readGtidLenencInt(proto *protocol.Proto, remaining int) (uint64, error) {
+	prefix := proto.Get_fixed_int(1)
+	size := 0
+	switch {
+	case prefix < 251:
+		return uint64(prefix), nil
+	case prefix == 252:
+		size = 2
+	case prefix == 253:
+		size = 3
+	case prefix == 254:
+		size = 8
+	default:
+		return 0, fmt.Errorf("invalid length-encoded integer prefix 0x%x", prefix)
+	}
+	if remaining < 1 + size {
+		return 0, fmt.Errorf("length-encoded integer needs %d bytes, but %d bytes remain", 1 + size, remaining)
 	}
+	value := make([]byte, 8)
+	copy(value, proto.Read(size))
+	return binary.LittleEndian.Uint64(value), nil
 }
 
-func (this *GtidEvent) LoadFromPacket(packet []byte) {
+func (this *GtidEvent) LoadFromPacket(packet []byte) error {
 	proto := protocol.NewProto(packet, 0)
 	this.commit_flag = (proto.Get_fixed_int(1) == 1)
 	this.sid = string(proto.Read(16))
@@ -37,5 +154,57 @@ func (this *GtidEvent) LoadFromPacket(packet []byte) {
 
 	hexSidData := hex.EncodeToString([]byte(this.sid))
 	this.gtid = fmt.Sprintf("%s-%s-%s-%s-%s:%d", hexSidData[:8], hexSidData[8:12], hexSidData[12:16], hexSidData[16:20], hexSidData[20:], this.gno)
-}
 
+	remaining := func() int {
+		return len(packet) - proto.GetOffset()
+	}
+
+	// 5.7 logical clock
+	if remaining() < 1 + 8 + 8 {
+		return nil
+	}
+	this.lt_type = proto.Get_fixed_int(1)
+	if this.lt_type == LOGICAL_TIMESTAMP_TYPECODE {
+		this.last_committed = int64(binary.LittleEndian.Uint64(proto.Read(8)))
+		this.sequence_number = int64(binary.LittleEndian.Uint64(proto.Read(8)))
+	}
+
+	// 8.0.1 commit timestamps
+	if remaining() < 7 {
+		return nil
+	}
+	this.immediate_commit_timestamp = uint64(proto.Get_fixed_int(7))
+	this.original_commit_timestamp = this.immediate_commit_timestamp
+	if this.immediate_commit_timestamp & (1 << ENCODED_COMMIT_TIMESTAMP_LENGTH) != 0 {
+		this.immediate_commit_timestamp &^= 1 << ENCODED_COMMIT_TIMESTAMP_LENGTH
+		if remaining() < 7 {
+			return nil
+		}
+		this.original_commit_timestamp = uint64(proto.Get_fixed_int(7))
+	}
+
+	// 8.0.2 transaction length
+	if remaining() < 1 {
+		return nil
+	}
+	transaction_length, err := readGtidLenencInt(proto, remaining())
+	if err != nil {
+		return fmt.Errorf("invalid transaction_length in gtid event, %s", err.Error())
+	}
+	this.transaction_length = transaction_length
+
+	// 8.0.14 server versions
+	if remaining() < 4 {
+		return nil
+	}
+	this.immediate_server_version = uint32(proto.Get_fixed_int(4))
+	this.original_server_version = this.immediate_server_version
+	if this.immediate_server_version & (1 << ENCODED_SERVER_VERSION_LENGTH) != 0 {
+		this.immediate_server_version &^= 1 << ENCODED_SERVER_VERSION_LENGTH
+		if remaining() < 4 {
+			return nil
+		}
+		this.original_server_version = uint32(proto.Get_fixed_int(4))
+	}
+	return nil
+}
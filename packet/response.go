@@ -14,6 +14,7 @@ type Response struct {
 	schema string
 	pluginName string
 	clientAttributes map[string]string
+	zstdCompressionLevel int
 }
 
 func NewResponse() *Response{
@@ -27,6 +28,7 @@ func NewResponse() *Response{
 		schema:           "",
 		pluginName:       "",
 		clientAttributes: make(map[string]string),
+		zstdCompressionLevel: 0,
 	}
 }
 
@@ -94,6 +96,13 @@ func (r *Response) GetClientAttributes() map[string]string{
 	return r.clientAttributes
 }
 
+func (r *Response) SetZstdCompressionLevel(zstdCompressionLevel int) {
+	r.zstdCompressionLevel = zstdCompressionLevel
+}
+
+func (r *Response) GetZstdCompressionLevel() int{
+	return r.zstdCompressionLevel
+}
 
 func (r *Response) AddCapablityFlag(flag int) {
 	r.capabilityFlags |= flag
@@ -147,6 +156,10 @@ func (r *Response) GetPayload() []byte{
 			payload = append(payload, protocol.Build_lenenc_int(len(attributes))...)
 			payload = append(payload, attributes...)
 		}
+
+		if r.HasCapablityFlag(protocol.CLIENT_ZSTD_COMPRESSION_ALGORITHM) {
+			payload = append(payload, protocol.Build_fixed_int(1, r.zstdCompressionLevel)...)
+		}
 	} else {
 		payload = append(payload, protocol.Build_fixed_int(2, r.capabilityFlags)...)
 		payload = append(payload, protocol.Build_fixed_int(3, r.maxPacketSize)...)
@@ -194,9 +207,10 @@ func LoadFromPacketToResponse(packet *protocol.Packet) *Response{
 		}
 
 		if r.HasCapablityFlag(protocol.CLIENT_CONNECT_ATTRS) {
-			proto.Get_lenenc_int()
+			attributesEnd := proto.Get_lenenc_int()
+			attributesEnd += proto.GetOffset()
 			for {
-					if proto.Has_remaining_data() {
+					if proto.Has_remaining_data() && proto.GetOffset() < attributesEnd {
 						key := proto.Get_lenenc_str()
 						value := proto.Get_lenenc_str()
 						r.clientAttributes[key] = value
@@ -205,6 +219,10 @@ func LoadFromPacketToResponse(packet *protocol.Packet) *Response{
 					}
 			}
 		}
+
+		if r.HasCapablityFlag(protocol.CLIENT_ZSTD_COMPRESSION_ALGORITHM) && proto.Has_remaining_data() {
+			r.zstdCompressionLevel = proto.Get_fixed_int(1)
+		}
 	} else {
 		r.capabilityFlags = proto.Get_fixed_int(2)
 		r.maxPacketSize = proto.Get_fixed_int(3)
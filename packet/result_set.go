@@ -0,0 +1,65 @@
+package packet
+
+import (
+	"fmt"
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+/*
+* COM_QUERY 返回的文本协议结果集
+* column count packet -> column definition packets -> [EOF] -> row packets -> EOF/OK(0xfe)
+*/
+
+// 文本协议的一行, NULL 值对应 nulls[i] == true
+type TextRow struct {
+	*protocol.Packet
+	values []string
+	nulls  []bool
+}
+
+func (r *TextRow) GetValues() []string {
+	return r.values
+}
+
+func (r *TextRow) IsNull(i int) bool {
+	return r.nulls[i]
+}
+
+/*
+* 结果集中的 EOF packet, 以及 CLIENT_DEPRECATE_EOF 下代替 EOF 的 OK packet (header 为 0xfe)
+*/
+func IsEOFPacket(p *protocol.Packet) bool {
+	return len(p.Payload) > 0 && len(p.Payload) < 9 && p.GetType() == byte(protocol.EOF)
+}
+
+func LoadFromPacketToColumnCount(p *protocol.Packet) (int, error) {
+	if len(p.Payload) == 0 || p.GetType() == byte(protocol.OK) || p.GetType() == byte(protocol.ERR) {
+		return 0, fmt.Errorf("not a column count packet")
+	}
+	proto := protocol.NewProto(p.Payload, 0)
+	return proto.Get_lenenc_int(), nil
+}
+
+func LoadFromPacketToTextRow(p *protocol.Packet, columnCount int) (*TextRow, error) {
+	r := &TextRow{
+		Packet: p,
+		values: make([]string, 0, columnCount),
+		nulls:  make([]bool, 0, columnCount),
+	}
+	proto := protocol.NewProto(p.Payload, 0)
+	for i := 0; i < columnCount; i++ {
+		if !proto.Has_remaining_data() {
+			return nil, fmt.Errorf("text row has %d columns, expect %d", i, columnCount)
+		}
+		// 0xfb 表示 NULL
+		if p.Payload[proto.GetOffset()] == 0xfb {
+			proto.Get_filler(1)
+			r.values = append(r.values, "")
+			r.nulls = append(r.nulls, true)
+			continue
+		}
+		r.values = append(r.values, proto.Get_lenenc_str())
+		r.nulls = append(r.nulls, false)
+	}
+	return r, nil
+}
@@ -5,6 +5,12 @@ import (
 	"github.com/goMySQLSemiSync/protocol"
 )
 
+const (
+	// 半同步复制时 binlog event 前的 2 字节: magic 和是否需要 ack 的标志
+	SEMI_SYNC_MAGIC = 0xef
+	SEMI_SYNC_NEED_ACK = 0x01
+)
+
 type SemiAck struct {
 	*protocol.Packet
 	logFile string
@@ -34,7 +40,7 @@ func (this *SemiAck) SetLogPos(logPos uint32) {
 */
 func (this *SemiAck) GetPayload() []byte {
 	var buf bytes.Buffer
-	buf.Write(protocol.Build_byte(0xef))
+	buf.Write(protocol.Build_byte(SEMI_SYNC_MAGIC))
 	buf.Write(protocol.Build_fixed_int(8, int(this.logPos)))
 	buf.Write(protocol.Build_eof_str(this.logFile))
 
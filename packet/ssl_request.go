@@ -0,0 +1,52 @@
+package packet
+
+import (
+	"github.com/goMySQLSemiSync/protocol"
+)
+
+/* SSLRequest packet
+4              capability flags, CLIENT_SSL always set
+4              max-packet size
+1              character set
+string[23]     reserved (all [0])
+*/
+type SSLRequest struct {
+	*protocol.Packet
+	capabilityFlags int
+	maxPacketSize   int
+	characterSet    int
+}
+
+func NewSSLRequest() *SSLRequest {
+	return &SSLRequest{
+		Packet:          protocol.NewPacket(),
+		capabilityFlags: protocol.CLIENT_PROTOCOL_41 | protocol.CLIENT_SSL,
+		maxPacketSize:   0,
+		characterSet:    0,
+	}
+}
+
+func (s *SSLRequest) SetCapablityFlag(flag int) {
+	s.capabilityFlags = flag | protocol.CLIENT_SSL
+}
+
+func (s *SSLRequest) GetCapablityFlag() int {
+	return s.capabilityFlags
+}
+
+func (s *SSLRequest) SetMaxPacketSize(maxPacketSize int) {
+	s.maxPacketSize = maxPacketSize
+}
+
+func (s *SSLRequest) SetCharacterSet(characterSet int) {
+	s.characterSet = characterSet
+}
+
+func (s *SSLRequest) GetPayload() []byte {
+	payload := make([]byte, 0)
+	payload = append(payload, protocol.Build_fixed_int(4, s.capabilityFlags)...)
+	payload = append(payload, protocol.Build_fixed_int(4, s.maxPacketSize)...)
+	payload = append(payload, protocol.Build_fixed_int(1, s.characterSet)...)
+	payload = append(payload, protocol.Build_filler(23, 0x00)...)
+	return payload
+}
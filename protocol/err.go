@@ -1,5 +1,23 @@
 package protocol
 
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// 认证失败
+	ErrAuthFailed = errors.New("auth failed")
+	// 服务端返回的数据不符合协议
+	ErrProtocolViolation = errors.New("protocol violation")
+)
+
+// master 读取 binlog 出错, 如请求的 binlog 已被 purge, 重连不能恢复
+const ER_MASTER_FATAL_ERROR_READING_BINLOG = 1236
+
+/*
+* ERR packet, 同时实现 error 接口, 服务端返回 ERR 时直接作为 error 返回
+*/
 type Err struct {
 	sequenceId int
 	errCode int
@@ -40,6 +58,10 @@ func (e *Err) SetErrorMessage(errorMessage string) {
 }
 
 
+func (e *Err) Error() string {
+	return fmt.Sprintf("mysql error %d (%s): %s", e.errCode, e.sqlState, e.errorMessage)
+}
+
 func NewErr() *Err{
 	return &Err{
 		sequenceId:   2,
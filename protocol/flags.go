@@ -63,6 +63,7 @@ OK                                      = 0x00
 ERR                                     = 0xff
 EOF                                     = 0xfe
 LOCAL_INFILE                            = 0xfb
+AUTH_MORE_DATA                          = 0x01
 
 SERVER_STATUS_IN_TRANS                  = 0x0001
 SERVER_STATUS_AUTOCOMMIT                = 0x0002
@@ -101,6 +102,10 @@ CLIENT_PLUGIN_AUTH                      = 0x00080000
 CLIENT_CONNECT_ATTRS                    = 1 << 20
 CLIENT_PLUGIN_AUTH_LENENC_CLIENT_DATA   = 1 << 21
 CLIENT_CAN_HANDLE_EXPIRED_PASSWORDS     = 1 << 22
+CLIENT_SESSION_TRACK                    = 1 << 23
+CLIENT_DEPRECATE_EOF                    = 1 << 24
+CLIENT_OPTIONAL_RESULTSET_METADATA      = 1 << 25
+CLIENT_ZSTD_COMPRESSION_ALGORITHM       = 1 << 26
 CLIENT_SSL_VERIFY_SERVER_CERT           = 0x40000000
 CLIENT_REMEMBER_OPTIONS                 = 0x80000000
 
@@ -124,6 +129,8 @@ MYSQL_TYPE_BIT                          = 0x10
 MYSQL_TYPE_TIMESTAMP2                   = 0x11
 MYSQL_TYPE_DATETIME2                    = 0x12
 MYSQL_TYPE_TIME2                        = 0x13
+MYSQL_TYPE_TYPED_ARRAY                  = 0x14
+MYSQL_TYPE_JSON                         = 0xf5
 MYSQL_TYPE_NEWDECIMAL                   = 0xf6
 MYSQL_TYPE_ENUM                         = 0xf7
 MYSQL_TYPE_SET                          = 0xf8
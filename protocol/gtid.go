@@ -5,17 +5,9 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
-	"regexp"
 	"sort"
-	"strconv"
-	"strings"
 )
 
-//   1:1500    1400:2800
-func overlap(itvl1, itvl2 *Interval) bool{
-	return itvl1.Start < itvl2.Stop &&  itvl1.Stop > itvl2.Start
-}
-
 // itvl1 contains itvl2        1 1000   2 200
 func contains(itvl1, itvl2 *Interval) bool {
 	return itvl2.Start >= itvl1.Start && itvl2.Stop <= itvl1.Stop
@@ -33,7 +25,7 @@ func (this IntervalSlice) Less(i, j int) bool {
 	} else if this[i].Start > this[j].Start {
 		return false
 	} else {
-		return this[j].Stop < this[j].Stop
+		return this[i].Stop < this[j].Stop
 	}
 }
 
@@ -47,9 +39,16 @@ func Normalize(s IntervalSlice) []*Interval {
 		return new
 	}
 	sort.Sort(s)
-	new = append(new, s[0])
 
-	for i := 1; i < len(s); i++ {
+	for i := 0; i < len(s); i++ {
+		// 空区间 [5,5)
+		if s[i].Start >= s[i].Stop {
+			continue
+		}
+		if len(new) == 0 {
+			new = append(new, s[i])
+			continue
+		}
 		last := new[len(new) - 1]
 		// [1,5] [6,10]
 		if s[i].Start > last.Stop {
@@ -67,6 +66,9 @@ func Normalize(s IntervalSlice) []*Interval {
 	return new
 }
 
+/*
+* gno 区间 [Start, Stop), 不包含 Stop
+ */
 type Interval struct {
 	Start int64
 	Stop int64
@@ -76,18 +78,73 @@ func (this *Interval) String() string{
 	if this.Stop == this.Start + 1 {
 		return fmt.Sprintf("%d", this.Start)
 	} else {
-		return fmt.Sprintf("%d-%d", this.Start, this.Stop)
+		return fmt.Sprintf("%d-%d", this.Start, this.Stop - 1)
 	}
 }
 
+/*
+* a 和 b 都是 Normalize 之后的区间
+ */
+func subtractIntervals(a, b []*Interval) []*Interval {
+	result := make([]*Interval, 0, len(a))
+	j := 0
+	for _, itvl := range a {
+		start := itvl.Start
+		for j < len(b) && b[j].Stop <= start {
+			j++
+		}
+		for k := j; k < len(b) && b[k].Start < itvl.Stop; k++ {
+			if b[k].Start > start {
+				result = append(result, &Interval{Start: start, Stop: b[k].Start})
+			}
+			if b[k].Stop > start {
+				start = b[k].Stop
+			}
+		}
+		if start < itvl.Stop {
+			result = append(result, &Interval{Start: start, Stop: itvl.Stop})
+		}
+	}
+	return result
+}
+
+/*
+* a 和 b 都是 Normalize 之后的区间
+ */
+func intersectIntervals(a, b []*Interval) []*Interval {
+	result := make([]*Interval, 0)
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		start := a[i].Start
+		if b[j].Start > start {
+			start = b[j].Start
+		}
+		stop := a[i].Stop
+		if b[j].Stop < stop {
+			stop = b[j].Stop
+		}
+		if start < stop {
+			result = append(result, &Interval{Start: start, Stop: stop})
+		}
+		if a[i].Stop < b[j].Stop {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
+
 type Gtid struct {
 	sid string
+	tag string             // MySQL 8.4 的 gtid tag, 没有 tag 时为空
 	intervals []*Interval
 }
 
 func NewGtid() *Gtid{
 	return &Gtid{
 		sid:       "",
+		tag:       "",
 		intervals: []*Interval{},
 	}
 }
@@ -100,10 +157,22 @@ func (g *Gtid) GetSid() string {
 	return g.sid
 }
 
-func (g *Gtid) SetIntervals(intervals []*Interval) {
+func (g *Gtid) SetTag(tag string) {
+	g.tag = tag
+}
+
+func (g *Gtid) GetTag() string {
+	return g.tag
+}
+
+func (g *Gtid) SetIntervals(intervals []*Interval) error {
 	for _, interval := range intervals {
-		g.AddInterval(interval)
+		err := g.AddInterval(interval)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 func (g *Gtid) GetIntervals() []*Interval {
@@ -111,99 +180,74 @@ func (g *Gtid) GetIntervals() []*Interval {
 }
 
 /*
-*"1-64"   [1,64]
+*"1-64"   [1,65)
  */
-func Parse_interval(interval string) *Interval{
-	re := regexp.MustCompile("^([0-9]+)(?:-([0-9]+))?$")
-	matchs := re.FindAllStringSubmatch(interval, -1)
-	a, _ := strconv.ParseInt(matchs[0][1],10, 64)
-	b := a
-	if len(matchs[0]) >= 2 && matchs[0][2] != "" {
-		b, _ = strconv.ParseInt(matchs[0][2],10, 64)
+func Parse_interval(interval string) (*Interval, error) {
+	parser := &gtidSetParser{
+		input: interval,
+		pos:   0,
+	}
+	parser.skipWhitespace()
+	itvl, err := parser.parseInterval()
+	if err != nil {
+		return nil, err
+	}
+	parser.skipWhitespace()
+	if parser.pos != len(parser.input) {
+		return nil, parser.errorf(parser.pos, "unexpected %q after interval", parser.peek())
 	}
-	return &Interval{Start:a, Stop: b + 1}
+	return itvl, nil
 }
 
 /*  a8111585-297e-11eb-91d3-005056ae71c5:1-4:5:7-10
-*   return a8111585-297e-11eb-91d3-005056ae71c5 [[1,4],[5,6],[7,10]]
+*   return a8111585-297e-11eb-91d3-005056ae71c5 [[1,11)]
+*   只能有一个 tag, 如 a8111585-297e-11eb-91d3-005056ae71c5:abc:1-3, 多个 sid 或 tag 使用 ParseGtidSet
+*   输入不合法时返回 *GtidParseError
 */
-func Parse(gtid string) *Gtid{
-	re := regexp.MustCompile("^([0-9a-fA-F]{8}(?:-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12})((?::[0-9-]+)+)$")
-	matchs := re.FindAllStringSubmatch(gtid, -1)
-
-	sid := matchs[0][1]
-	intervalParsed := make([]*Interval, 0, 1)
-	intervals := matchs[0][2]
-	for _, interval := range strings.Split(intervals[1:], ":") {
-		interval_Sp := Parse_interval(interval)
-		intervalParsed = append(intervalParsed, interval_Sp)
+func Parse(gtid string) (*Gtid, error) {
+	parser := &gtidSetParser{
+		input: gtid,
+		pos:   0,
 	}
-	return &Gtid{
-		sid:       sid,
-		intervals: intervalParsed,
+	parser.skipWhitespace()
+	gtids, err := parser.parseSidGroup()
+	if err != nil {
+		return nil, err
+	}
+	parser.skipWhitespace()
+	if parser.pos != len(parser.input) {
+		return nil, parser.errorf(parser.pos, "unexpected %q after gtid, use ParseGtidSet for more than one uuid", parser.peek())
 	}
-	//return sid, intervalParsed
+	if len(gtids) != 1 {
+		return nil, parser.errorf(0, "gtid has %d tags, use ParseGtidSet for more than one tag", len(gtids))
+	}
+	return gtids[0], nil
 }
 
-func (g *Gtid) AddInterval(itvl *Interval) {
+/*
+* 与已有区间重叠或相邻时合并
+ */
+func (g *Gtid) AddInterval(itvl *Interval) error {
 	// [10, 5]
 	if itvl.Start > itvl.Stop {
-		panic(fmt.Sprintf("gtid malformed interval %v", itvl))
+		return fmt.Errorf("gtid malformed interval [%d, %d)", itvl.Start, itvl.Stop)
 	}
-	// [[1:5][8:10][12:15]]     itvl [4:9]
-	for _, interval := range g.intervals {
-		if overlap(interval, itvl) {
-			panic(fmt.Sprintf("Overlapping interval %v", itvl))
-		}
-	}
-	g.intervals = append(g.intervals, itvl)
-	g.intervals = Normalize(g.intervals)
+	g.intervals = Normalize(append(g.intervals, &Interval{Start: itvl.Start, Stop: itvl.Stop}))
+	return nil
 }
 
-func (g *Gtid) SubInterval(itvl *Interval) {
-	new := make([]*Interval, 0, 1)
+func (g *Gtid) SubInterval(itvl *Interval) error {
 	// [10, 5]
 	if itvl.Start > itvl.Stop {
-		panic(fmt.Sprintf("gtid malformed interval %v", itvl))
-	}
-
-	flag := false
-	for _, interval := range g.intervals {
-		if overlap(interval, itvl) {
-			flag = true
-			break
-		}
-	}
-	if !flag {
-		return
-	}
-
-	g.intervals = Normalize(g.intervals)
-	for _, existing := range g.intervals {
-		if overlap(existing, itvl) {
-			if existing.Start < itvl.Start {
-				new = append(new, &Interval{
-					Start: existing.Start,
-					Stop:  itvl.Start,
-				})
-			}
-
-			if existing.Stop > itvl.Stop {
-				new = append(new, &Interval{
-					Start: itvl.Stop,
-					Stop:  existing.Stop,
-				})
-			}
-		} else {
-			new = append(new, existing)
-		}
+		return fmt.Errorf("gtid malformed interval [%d, %d)", itvl.Start, itvl.Stop)
 	}
-	g.intervals = new
+	g.intervals = subtractIntervals(Normalize(g.intervals), Normalize([]*Interval{itvl}))
+	return nil
 }
 
 // Gtid g contains gtid other
 func (g *Gtid) Contains(other *Gtid) bool {
-	if g.sid != other.sid {
+	if g.sid != other.sid || g.tag != other.tag {
 		return false
 	}
 
@@ -221,56 +265,113 @@ func (g *Gtid) Contains(other *Gtid) bool {
 	return true
 }
 
-func (g *Gtid) Add(other *Gtid) {
-	if other.sid != g.sid {
-		panic(fmt.Sprintf("attempt to merge different sid, %s != %s", other.sid, g.sid))
+func (g *Gtid) Add(other *Gtid) error {
+	if other.sid != g.sid || other.tag != g.tag {
+		return fmt.Errorf("attempt to merge different sid, %s != %s", other.sidWithTag(), g.sidWithTag())
 	}
 
 	for _, interval := range other.intervals {
-		g.AddInterval(interval)
+		err := g.AddInterval(interval)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (g *Gtid) Sub(other *Gtid) {
-	if other.sid != g.sid {
-		panic(fmt.Sprintf("attempt to sub different sid, %s != %s", other.sid, g.sid))
+func (g *Gtid) Sub(other *Gtid) error {
+	if other.sid != g.sid || other.tag != g.tag {
+		return fmt.Errorf("attempt to sub different sid, %s != %s", other.sidWithTag(), g.sidWithTag())
 	}
 
 	for _, interval := range other.intervals {
-		g.SubInterval(interval)
+		err := g.SubInterval(interval)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Gtid) sidWithTag() string {
+	if g.tag == "" {
+		return g.sid
+	}
+	return g.sid + ":" + g.tag
+}
+
+/*
+* a8111585-297e-11eb-91d3-005056ae71c5:1-4:7-10, 有 tag 时为 a8111585-297e-11eb-91d3-005056ae71c5:tag:1-4:7-10
+ */
+func (g *Gtid) String() string {
+	return string(g.Bytes())
+}
+
+func (g *Gtid) Clone() *Gtid {
+	intervals := make([]*Interval, 0, len(g.intervals))
+	for _, interval := range g.intervals {
+		intervals = append(intervals, &Interval{Start: interval.Start, Stop: interval.Stop})
+	}
+	return &Gtid{
+		sid:       g.sid,
+		tag:       g.tag,
+		intervals: intervals,
 	}
 }
 
 func (g *Gtid) Bytes() []byte {
 	var buf bytes.Buffer
 	buf.WriteString(g.sid)
+	g.writeIntervals(&buf)
+	return buf.Bytes()
+}
+
+func (g *Gtid) writeIntervals(buf *bytes.Buffer) {
+	if g.tag != "" {
+		buf.WriteString(":")
+		buf.WriteString(g.tag)
+	}
 	for _, interval := range g.intervals {
 		buf.WriteString(":")
 		buf.WriteString(interval.String())
 	}
-	return buf.Bytes()
 }
 
-func (g *Gtid) Encode() []byte {
+/*
+* 编码为 COM_BINLOG_DUMP_GTID 和 PREVIOUS_GTIDS_LOG_EVENT 中的格式
+* 这个格式没有 tag, 带 tag 的 gtid 返回错误; tag 目前只用于解析和集合运算, 没有实现 MySQL 8.4 带 tag 的编码格式
+ */
+func (g *Gtid) Encode() ([]byte, error) {
+	if g.tag != "" {
+		return nil, fmt.Errorf("tagged gtid %s can not be encoded", g.sidWithTag())
+	}
+	sid, err := g.DecodeSidToHex()
+	if err != nil {
+		return nil, err
+	}
 	var buf bytes.Buffer
-	buf.Write(g.DecodeSidToHex())
+	buf.Write(sid)
 	n := int64(len(g.intervals))
 	binary.Write(&buf, binary.LittleEndian, n)
 	for _, i := range g.intervals {
 		binary.Write(&buf, binary.LittleEndian, i.Start)
 		binary.Write(&buf, binary.LittleEndian, i.Stop)
 	}
-	return buf.Bytes()
+	return buf.Bytes(), nil
 }
 
-func (g *Gtid) DecodeSidToHex() []byte{
+func (g *Gtid) DecodeSidToHex() ([]byte, error) {
+	if len(g.sid) != 36 || g.sid[8] != '-' || g.sid[13] != '-' || g.sid[18] != '-' || g.sid[23] != '-' {
+		return nil, fmt.Errorf("invalid gtid sid %q", g.sid)
+	}
 	buf := make([]byte, 16)
-	hex.Decode(buf[0:4], []byte(g.sid[0:8]))
-	hex.Decode(buf[4:6], []byte(g.sid[9:13]))
-	hex.Decode(buf[6:8], []byte(g.sid[14:18]))
-	hex.Decode(buf[8:10], []byte(g.sid[19:23]))
-	hex.Decode(buf[10:16], []byte(g.sid[24:36]))
-	return buf
+	for _, part := range [][4]int{{0, 4, 0, 8}, {4, 6, 9, 13}, {6, 8, 14, 18}, {8, 10, 19, 23}, {10, 16, 24, 36}} {
+		_, err := hex.Decode(buf[part[0]:part[1]], []byte(g.sid[part[2]:part[3]]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gtid sid %q, err: %w", g.sid, err)
+		}
+	}
+	return buf, nil
 }
 
 func (g *Gtid) EncodeLength() int{
@@ -284,26 +385,36 @@ func (g *Gtid) Decode(data []byte) error{
 	}
 
 	pos := 0
-	g.sid = string(data[0:16])
+	g.sid = EncodeSidFromHex(data[0:16])
 	pos += 16
-	n := int64(binary.LittleEndian.Uint64(data[pos:pos + 8]))
+	n := binary.LittleEndian.Uint64(data[pos:pos + 8])
 	pos += 8
-	if len(data) < int(16 * n) + pos {
-		return fmt.Errorf("invalid uuid set buffer, must %d, but %d", pos + int(16 * n), len(data))
+	// 先比较个数, 避免 16 * n 溢出
+	if n > uint64(len(data) - pos) / 16 {
+		return fmt.Errorf("invalid uuid set buffer, %d intervals, but %d bytes", n, len(data) - pos)
 	}
 
 	g.intervals = make([]*Interval, 0, n)
-	var in *Interval
-	for i := int64(0); i < n; i++ {
+	for i := uint64(0); i < n; i++ {
+		in := &Interval{}
 		in.Start = int64(binary.LittleEndian.Uint64(data[pos:pos+8]))
 		pos += 8
 		in.Stop = int64(binary.LittleEndian.Uint64(data[pos:pos+8]))
 		pos += 8
 		g.intervals = append(g.intervals, in)
 	}
+	g.intervals = Normalize(g.intervals)
 	return nil
 }
 
+/*
+* 16 字节的 sid 转换为 a8111585-297e-11eb-91d3-005056ae71c5 格式
+ */
+func EncodeSidFromHex(sid []byte) string {
+	hexSid := hex.EncodeToString(sid)
+	return fmt.Sprintf("%s-%s-%s-%s-%s", hexSid[:8], hexSid[8:12], hexSid[12:16], hexSid[16:20], hexSid[20:])
+}
+
 type GtidSet struct {
 	gtids []*Gtid
 }
@@ -312,6 +423,10 @@ func (this *GtidSet) SetGtids(gtids []*Gtid) {
 	this.gtids = gtids
 }
 
+func (this *GtidSet) GetGtids() []*Gtid {
+	return this.gtids
+}
+
 func NewGtidSet() *GtidSet {
 	return &GtidSet{
 		gtids: []*Gtid{},
@@ -319,17 +434,148 @@ func NewGtidSet() *GtidSet {
 }
 
 func (this *GtidSet) merge_gtid(gtid *Gtid) {
-	isNew := true
-	for _, existing := range this.gtids {
-		if existing.sid == gtid.sid {
-			isNew = false
-			existing.Add(gtid)
+	existing := this.find(gtid.sid, gtid.tag)
+	if existing == nil {
+		this.gtids = append(this.gtids, gtid)
+		return
+	}
+	// 与已有区间重叠时合并, 不再 panic
+	existing.intervals = Normalize(append(existing.intervals, gtid.Clone().intervals...))
+}
+
+func (this *GtidSet) find(sid string, tag string) *Gtid {
+	for _, gtid := range this.gtids {
+		if gtid.sid == sid && gtid.tag == tag {
+			return gtid
+		}
+	}
+	return nil
+}
+
+/*
+* 按 sid 和 tag 排序, 没有 tag 的在前, 去掉没有区间的 sid
+ */
+func (this *GtidSet) sortedGtids() []*Gtid {
+	gtids := make([]*Gtid, 0, len(this.gtids))
+	for _, gtid := range this.gtids {
+		if len(gtid.intervals) > 0 {
+			gtids = append(gtids, gtid)
 		}
 	}
+	sort.Slice(gtids, func(i, j int) bool {
+		if gtids[i].sid != gtids[j].sid {
+			return gtids[i].sid < gtids[j].sid
+		}
+		return gtids[i].tag < gtids[j].tag
+	})
+	return gtids
+}
 
-	if isNew {
-		this.gtids = append(this.gtids, gtid)
+/*
+* 与 MySQL 的 @@gtid_executed 格式相同: 按 sid 排序, sid 之间用 ",\n" 分隔, 空集合为空字符串
+* 同一个 sid 的 tag 跟在没有 tag 的区间之后, 如 a8111585-297e-11eb-91d3-005056ae71c5:1-5:abc:1-3
+ */
+func (this *GtidSet) String() string {
+	var buf bytes.Buffer
+	gtids := this.sortedGtids()
+	for i, gtid := range gtids {
+		if i == 0 || gtids[i-1].sid != gtid.sid {
+			if i > 0 {
+				buf.WriteString(",\n")
+			}
+			buf.WriteString(gtid.sid)
+		}
+		gtid.writeIntervals(&buf)
+	}
+	return buf.String()
+}
+
+/*
+* 是否包含带 tag 的 gtid, COM_BINLOG_DUMP_GTID 和 Encoded 只支持没有 tag 的 gtid, tag 只用于解析和集合运算
+ */
+func (this *GtidSet) HasTags() bool {
+	for _, gtid := range this.gtids {
+		if gtid.tag != "" {
+			return true
+		}
 	}
+	return false
+}
+
+func (this *GtidSet) Clone() *GtidSet {
+	clone := NewGtidSet()
+	for _, gtid := range this.gtids {
+		gtid = gtid.Clone()
+		gtid.intervals = Normalize(gtid.intervals)
+		clone.gtids = append(clone.gtids, gtid)
+	}
+	clone.gtids = clone.sortedGtids()
+	return clone
+}
+
+/*
+* 并集, 不修改 this 和 other
+ */
+func (this *GtidSet) Union(other *GtidSet) *GtidSet {
+	result := this.Clone()
+	for _, gtid := range other.gtids {
+		existing := result.find(gtid.sid, gtid.tag)
+		if existing == nil {
+			existing = &Gtid{sid: gtid.sid, tag: gtid.tag, intervals: []*Interval{}}
+			result.gtids = append(result.gtids, existing)
+		}
+		existing.intervals = Normalize(append(existing.intervals, gtid.Clone().intervals...))
+	}
+	result.gtids = result.sortedGtids()
+	return result
+}
+
+/*
+* 差集 this - other, 不修改 this 和 other
+ */
+func (this *GtidSet) Subtract(other *GtidSet) *GtidSet {
+	result := NewGtidSet()
+	for _, gtid := range this.gtids {
+		intervals := Normalize(gtid.Clone().intervals)
+		if existing := other.find(gtid.sid, gtid.tag); existing != nil {
+			intervals = subtractIntervals(intervals, Normalize(existing.Clone().intervals))
+		}
+		result.gtids = append(result.gtids, &Gtid{sid: gtid.sid, tag: gtid.tag, intervals: intervals})
+	}
+	result.gtids = result.sortedGtids()
+	return result
+}
+
+/*
+* 交集, 不修改 this 和 other
+ */
+func (this *GtidSet) Intersect(other *GtidSet) *GtidSet {
+	result := NewGtidSet()
+	for _, gtid := range this.gtids {
+		existing := other.find(gtid.sid, gtid.tag)
+		if existing == nil {
+			continue
+		}
+		intervals := intersectIntervals(Normalize(gtid.Clone().intervals), Normalize(existing.Clone().intervals))
+		result.gtids = append(result.gtids, &Gtid{sid: gtid.sid, tag: gtid.tag, intervals: intervals})
+	}
+	result.gtids = result.sortedGtids()
+	return result
+}
+
+func (this *GtidSet) IsEmpty() bool {
+	return len(this.sortedGtids()) == 0
+}
+
+/*
+* this 中的每个 gtid 都在 other 中
+ */
+func (this *GtidSet) IsSubset(other *GtidSet) bool {
+	return this.Subtract(other).IsEmpty()
+}
+
+func (this *GtidSet) Equal(other *GtidSet) bool {
+	return this.IsSubset(other) && other.IsSubset(this)
 }
 
 func (this *GtidSet) Contains(other *Gtid) bool{
@@ -354,11 +600,42 @@ func (this *GtidSet) EncodeLength() int{
 	return length
 }
 
-func (this *GtidSet) Encoded() []byte{
+/*
+* 编码格式见 DecodeGtidSet, 包含带 tag 的 gtid 时返回错误
+ */
+func (this *GtidSet) Encoded() ([]byte, error) {
 	var buf bytes.Buffer
 	binary.Write(&buf, binary.LittleEndian, uint64(len(this.gtids)))
 	for _, gtid := range this.gtids {
-		buf.Write(gtid.Encode())
+		encoded, err := gtid.Encode()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encoded)
 	}
-	return buf.Bytes()
-}
\ No newline at end of file
+	return buf.Bytes(), nil
+}
+/*
+* 解析 Encoded 格式的 gtid 集合, 如 PREVIOUS_GTIDS_LOG_EVENT 和 COM_BINLOG_DUMP_GTID 中的 gtid 集合
+* 8              n_sids
+* n_sids 个 Gtid.Encode
+ */
+func DecodeGtidSet(data []byte) (*GtidSet, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("invalid gtid set buffer, less 8")
+	}
+	n := binary.LittleEndian.Uint64(data[0:8])
+	pos := 8
+	gtidSet := NewGtidSet()
+	for i := uint64(0); i < n; i++ {
+		gtid := NewGtid()
+		err := gtid.Decode(data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		// Decode 会合并区间, 按 buffer 中原始的区间个数前进
+		pos += 16 + 8 + 2 * 8 * int(binary.LittleEndian.Uint64(data[pos + 16:pos + 24]))
+		gtidSet = gtidSet.Union(&GtidSet{gtids: []*Gtid{gtid}})
+	}
+	return gtidSet, nil
+}
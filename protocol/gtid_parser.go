@@ -0,0 +1,246 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// gno 的最大值, 与 MySQL 的 GNO_END - 1 相同
+const MAX_GNO = math.MaxInt64 - 1
+
+// MySQL 8.4 gtid tag 的最大长度
+const MAX_GTID_TAG_LENGTH = 32
+
+/*
+* 解析 gtid 集合时的错误, Pos 为出错字符在输入中的下标 (从 0 开始)
+ */
+type GtidParseError struct {
+	Input string
+	Pos   int
+	Msg   string
+}
+
+func (e *GtidParseError) Error() string {
+	return fmt.Sprintf("invalid gtid set at position %d: %s, input: %q", e.Pos, e.Msg, e.Input)
+}
+
+type gtidSetParser struct {
+	input string
+	pos   int
+}
+
+/*
+* 解析 gtid 集合, 格式与 @@gtid_executed 相同, 出错时返回 *GtidParseError, 不会 panic
+*   3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7,
+*   a8111585-297e-11eb-91d3-005056ae71c5:1-10:abc:1-3
+* 逗号, 冒号和横杠前后可以有空白和换行, 重叠或乱序的区间会被合并
+* MySQL 8.4 的 tag 作用于它之后的区间, 直到下一个 tag; tag 不区分大小写, 统一转换为小写
+* tag 只用于解析和集合运算, 带 tag 的集合不能编码, 不能用于 COM_BINLOG_DUMP_GTID
+* 空字符串为空集合
+ */
+func ParseGtidSet(gtidSet string) (*GtidSet, error) {
+	parser := &gtidSetParser{
+		input: gtidSet,
+		pos:   0,
+	}
+	return parser.parse()
+}
+
+func (p *gtidSetParser) errorf(pos int, format string, args ...interface{}) error {
+	return &GtidParseError{
+		Input: p.input,
+		Pos:   pos,
+		Msg:   fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *gtidSetParser) skipWhitespace() {
+	for p.pos < len(p.input) && strings.IndexByte(" \t\r\n", p.input[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *gtidSetParser) peek() byte {
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *gtidSetParser) parse() (*GtidSet, error) {
+	result := NewGtidSet()
+	p.skipWhitespace()
+	if p.pos == len(p.input) {
+		return result, nil
+	}
+	for {
+		gtids, err := p.parseSidGroup()
+		if err != nil {
+			return nil, err
+		}
+		result = result.Union(&GtidSet{gtids: gtids})
+
+		p.skipWhitespace()
+		if p.pos == len(p.input) {
+			return result, nil
+		}
+		if p.peek() != ',' {
+			return nil, p.errorf(p.pos, "expect ',' or end of input, got %q", p.peek())
+		}
+		p.pos++
+		p.skipWhitespace()
+	}
+}
+
+/*
+* uuid (':' (tag | interval))+
+ */
+func (p *gtidSetParser) parseSidGroup() ([]*Gtid, error) {
+	sid, err := p.parseSid()
+	if err != nil {
+		return nil, err
+	}
+	gtids := make([]*Gtid, 0, 1)
+	current := &Gtid{sid: sid, tag: "", intervals: []*Interval{}}
+	tagPos := -1
+	for {
+		p.skipWhitespace()
+		if p.peek() != ':' {
+			break
+		}
+		p.pos++
+		p.skipWhitespace()
+		c := p.peek()
+		if c >= '0' && c <= '9' {
+			interval, err := p.parseInterval()
+			if err != nil {
+				return nil, err
+			}
+			current.intervals = append(current.intervals, interval)
+			continue
+		}
+		if isTagStart(c) {
+			if tagPos >= 0 && len(current.intervals) == 0 {
+				return nil, p.errorf(tagPos, "tag %q has no intervals", current.tag)
+			}
+			if len(current.intervals) > 0 {
+				gtids = append(gtids, current)
+			}
+			tagPos = p.pos
+			tag, err := p.parseTag()
+			if err != nil {
+				return nil, err
+			}
+			current = &Gtid{sid: sid, tag: tag, intervals: []*Interval{}}
+			continue
+		}
+		return nil, p.errorf(p.pos, "expect interval or tag after ':'")
+	}
+	if len(current.intervals) == 0 {
+		if tagPos >= 0 {
+			return nil, p.errorf(tagPos, "tag %q has no intervals", current.tag)
+		}
+		if len(gtids) == 0 {
+			return nil, p.errorf(p.pos, "expect ':' and interval after uuid %s", sid)
+		}
+	} else {
+		gtids = append(gtids, current)
+	}
+	for _, gtid := range gtids {
+		gtid.intervals = Normalize(gtid.intervals)
+	}
+	return gtids, nil
+}
+
+/*
+* a8111585-297e-11eb-91d3-005056ae71c5, 转换为小写
+ */
+func (p *gtidSetParser) parseSid() (string, error) {
+	start := p.pos
+	const sidLength = 36
+	if len(p.input)-start < sidLength {
+		return "", p.errorf(start, "expect uuid, got %q", p.input[start:])
+	}
+	for i := 0; i < sidLength; i++ {
+		c := p.input[start+i]
+		if i == 8 || i == 13 || i == 18 || i == 23 {
+			if c != '-' {
+				return "", p.errorf(start+i, "expect '-' in uuid, got %q", c)
+			}
+			continue
+		}
+		if !isHexDigit(c) {
+			return "", p.errorf(start+i, "expect hex digit in uuid, got %q", c)
+		}
+	}
+	p.pos += sidLength
+	return strings.ToLower(p.input[start:p.pos]), nil
+}
+
+/*
+* [a-zA-Z_][a-zA-Z0-9_]*, 最长 32 个字符
+ */
+func (p *gtidSetParser) parseTag() (string, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (isTagStart(p.input[p.pos]) || (p.input[p.pos] >= '0' && p.input[p.pos] <= '9')) {
+		p.pos++
+	}
+	if p.pos-start > MAX_GTID_TAG_LENGTH {
+		return "", p.errorf(start, "tag %q is longer than %d characters", p.input[start:p.pos], MAX_GTID_TAG_LENGTH)
+	}
+	return strings.ToLower(p.input[start:p.pos]), nil
+}
+
+/*
+* start 或 start-end, 1 <= start <= end <= MAX_GNO
+ */
+func (p *gtidSetParser) parseInterval() (*Interval, error) {
+	startPos := p.pos
+	start, err := p.parseGno()
+	if err != nil {
+		return nil, err
+	}
+	end := start
+	p.skipWhitespace()
+	if p.peek() == '-' {
+		p.pos++
+		p.skipWhitespace()
+		endPos := p.pos
+		end, err = p.parseGno()
+		if err != nil {
+			return nil, err
+		}
+		if end < start {
+			return nil, p.errorf(endPos, "interval end %d is less than start %d", end, start)
+		}
+	}
+	if start == 0 {
+		return nil, p.errorf(startPos, "gno must be greater than 0")
+	}
+	return &Interval{Start: start, Stop: end + 1}, nil
+}
+
+func (p *gtidSetParser) parseGno() (int64, error) {
+	start := p.pos
+	for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+		p.pos++
+	}
+	if p.pos == start {
+		return 0, p.errorf(start, "expect number")
+	}
+	gno, err := strconv.ParseInt(p.input[start:p.pos], 10, 64)
+	if err != nil || gno > MAX_GNO {
+		return 0, p.errorf(start, "gno %s is out of range", p.input[start:p.pos])
+	}
+	return gno, nil
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isTagStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
@@ -0,0 +1,425 @@
+package protocol
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDecodeGtidSet(t *testing.T) {
+	gtidSet := NewGtidSet()
+	gtidSet.Add(parseTestGtid(t, "a8111585-297e-11eb-91d3-005056ae71c5:1-10:15-20"))
+	gtidSet.Add(parseTestGtid(t, "b8111585-297e-11eb-91d3-005056ae71c5:7"))
+
+	encoded, err := gtidSet.Encoded()
+	if err != nil {
+		t.Fatalf("encode gtid set error: %v", err)
+	}
+	decoded, err := DecodeGtidSet(encoded)
+	if err != nil {
+		t.Fatalf("decode gtid set error: %v", err)
+	}
+	if len(decoded.GetGtids()) != 2 {
+		t.Fatalf("expect 2 sids, got %d", len(decoded.GetGtids()))
+	}
+	for _, gtid := range gtidSet.GetGtids() {
+		if !decoded.Contains(gtid) {
+			t.Errorf("decoded gtid set does not contain %s", gtid.GetSid())
+		}
+	}
+
+	_, err = DecodeGtidSet(encoded[:30])
+	if err == nil {
+		t.Errorf("expect error for truncated gtid set")
+	}
+	// 区间个数远大于数据长度
+	invalid := append([]byte(nil), encoded[:8+16]...)
+	invalid = append(invalid, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x0f)
+	_, err = DecodeGtidSet(invalid)
+	if err == nil {
+		t.Errorf("expect error for too many intervals")
+	}
+}
+
+func TestDecodeGtidSetUnnormalized(t *testing.T) {
+	// 第一个 sid 的区间相邻未合并: 1-4, 5-10
+	first := &Gtid{sid: "a8111585-297e-11eb-91d3-005056ae71c5", intervals: []*Interval{{Start: 1, Stop: 5}, {Start: 5, Stop: 11}}}
+	second := parseTestGtid(t, "b8111585-297e-11eb-91d3-005056ae71c5:7")
+	encoded, err := (&GtidSet{gtids: []*Gtid{first, second}}).Encoded()
+	if err != nil {
+		t.Fatalf("encode gtid set error: %v", err)
+	}
+	decoded, err := DecodeGtidSet(encoded)
+	if err != nil {
+		t.Fatalf("decode gtid set error: %v", err)
+	}
+	expect := "a8111585-297e-11eb-91d3-005056ae71c5:1-10,\nb8111585-297e-11eb-91d3-005056ae71c5:7"
+	if decoded.String() != expect {
+		t.Errorf("expect %q, got %q", expect, decoded.String())
+	}
+}
+
+func parseTestGtid(t *testing.T, s string) *Gtid {
+	gtid, err := Parse(s)
+	if err != nil {
+		t.Fatalf("parse %q error: %v", s, err)
+	}
+	return gtid
+}
+
+var testSids = []string{
+	"a8111585-297e-11eb-91d3-005056ae71c5",
+	"3e11fa47-71ca-11e1-9e33-c80aa9429562",
+	"cc2ca488-3ba0-11eb-a578-005056ae7c63",
+}
+
+/*
+* 随机生成的 gtid 集合和对应的 gno 集合, 区间可能重叠, 乱序
+ */
+func randomGtidSet(r *rand.Rand) (*GtidSet, map[string]map[int64]bool) {
+	gtidSet := NewGtidSet()
+	model := make(map[string]map[int64]bool)
+	for _, sid := range testSids {
+		if r.Intn(4) == 0 {
+			continue
+		}
+		gtid := &Gtid{sid: sid, intervals: []*Interval{}}
+		model[sid] = make(map[int64]bool)
+		for n := r.Intn(4); n >= 0; n-- {
+			start := int64(r.Intn(40) + 1)
+			stop := start + int64(r.Intn(8)+1)
+			gtid.intervals = append(gtid.intervals, &Interval{Start: start, Stop: stop})
+			for gno := start; gno < stop; gno++ {
+				model[sid][gno] = true
+			}
+		}
+		gtidSet.gtids = append(gtidSet.gtids, gtid)
+	}
+	return gtidSet, model
+}
+
+func gtidSetModel(gtidSet *GtidSet) map[string]map[int64]bool {
+	model := make(map[string]map[int64]bool)
+	for _, gtid := range gtidSet.gtids {
+		for _, interval := range gtid.intervals {
+			for gno := interval.Start; gno < interval.Stop; gno++ {
+				if model[gtid.sid] == nil {
+					model[gtid.sid] = make(map[int64]bool)
+				}
+				model[gtid.sid][gno] = true
+			}
+		}
+	}
+	return model
+}
+
+func modelEqual(a, b map[string]map[int64]bool) bool {
+	for _, sid := range testSids {
+		if len(a[sid]) != len(b[sid]) {
+			return false
+		}
+		for gno := range a[sid] {
+			if !b[sid][gno] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func modelOp(a, b map[string]map[int64]bool, keep func(inA, inB bool) bool) map[string]map[int64]bool {
+	result := make(map[string]map[int64]bool)
+	for _, sid := range testSids {
+		for gno := int64(0); gno < 64; gno++ {
+			if keep(a[sid][gno], b[sid][gno]) {
+				if result[sid] == nil {
+					result[sid] = make(map[int64]bool)
+				}
+				result[sid][gno] = true
+			}
+		}
+	}
+	return result
+}
+
+/*
+* 规范形式: sid 升序, 区间升序, 不重叠也不相邻
+ */
+func checkCanonical(t *testing.T, gtidSet *GtidSet) {
+	for i, gtid := range gtidSet.gtids {
+		if i > 0 && gtidSet.gtids[i-1].sid >= gtid.sid {
+			t.Fatalf("sids not sorted: %s", gtidSet.String())
+		}
+		if len(gtid.intervals) == 0 {
+			t.Fatalf("empty sid %s in %s", gtid.sid, gtidSet.String())
+		}
+		for j, interval := range gtid.intervals {
+			if interval.Start >= interval.Stop || (j > 0 && gtid.intervals[j-1].Stop >= interval.Start) {
+				t.Fatalf("intervals not canonical: %s", gtidSet.String())
+			}
+		}
+	}
+}
+
+func parseTestGtidSet(t *testing.T, s string) *GtidSet {
+	gtidSet := NewGtidSet()
+	if s == "" {
+		return gtidSet
+	}
+	for _, gtidStr := range strings.Split(s, ",\n") {
+		gtidSet.Add(parseTestGtid(t, gtidStr))
+	}
+	return gtidSet
+}
+
+func TestGtidSetAlgebra(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		a, modelA := randomGtidSet(r)
+		b, modelB := randomGtidSet(r)
+		aString := a.Clone().String()
+
+		union := a.Union(b)
+		subtract := a.Subtract(b)
+		intersect := a.Intersect(b)
+		for _, c := range []struct {
+			name   string
+			result *GtidSet
+			expect map[string]map[int64]bool
+		}{
+			{"union", union, modelOp(modelA, modelB, func(inA, inB bool) bool { return inA || inB })},
+			{"subtract", subtract, modelOp(modelA, modelB, func(inA, inB bool) bool { return inA && !inB })},
+			{"intersect", intersect, modelOp(modelA, modelB, func(inA, inB bool) bool { return inA && inB })},
+		} {
+			checkCanonical(t, c.result)
+			if !modelEqual(gtidSetModel(c.result), c.expect) {
+				t.Fatalf("%s of %q and %q is wrong: %q", c.name, a.String(), b.String(), c.result.String())
+			}
+		}
+
+		// 运算不修改参数
+		if a.Clone().String() != aString || !modelEqual(gtidSetModel(a), modelA) {
+			t.Fatalf("operand modified: %q", a.String())
+		}
+
+		if !a.Equal(a.Clone()) || !union.Equal(b.Union(a)) || !intersect.Equal(b.Intersect(a)) {
+			t.Fatalf("equal failed for %q and %q", a.String(), b.String())
+		}
+		if !a.IsSubset(union) || !intersect.IsSubset(a) || !subtract.IsSubset(a) {
+			t.Fatalf("subset failed for %q and %q", a.String(), b.String())
+		}
+		if !subtract.Intersect(b).IsEmpty() || !subtract.Union(intersect).Equal(a) {
+			t.Fatalf("subtract and intersect do not partition %q", a.String())
+		}
+		if a.Equal(b) != modelEqual(modelA, modelB) {
+			t.Fatalf("equal of %q and %q is wrong", a.String(), b.String())
+		}
+
+		// 字符串和 wire 格式往返
+		if parsed := parseTestGtidSet(t, union.String()); !parsed.Equal(union) || parsed.String() != union.String() {
+			t.Fatalf("string round trip of %q failed: %q", union.String(), parsed.String())
+		}
+		encoded, err := union.Encoded()
+		if err != nil {
+			t.Fatalf("encode %q error: %v", union.String(), err)
+		}
+		decoded, err := DecodeGtidSet(encoded)
+		if err != nil || !decoded.Equal(union) || decoded.String() != union.String() {
+			t.Fatalf("wire round trip of %q failed: %v", union.String(), err)
+		}
+	}
+}
+
+func TestGtidSetString(t *testing.T) {
+	gtidSet := NewGtidSet()
+	gtidSet.Add(parseTestGtid(t, "CC2CA488-3BA0-11EB-A578-005056AE7C63:7-9:1-3"))
+	gtidSet.Add(parseTestGtid(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:5"))
+	gtidSet = gtidSet.Union(parseTestGtidSet(t, "cc2ca488-3ba0-11eb-a578-005056ae7c63:4"))
+	expect := "3e11fa47-71ca-11e1-9e33-c80aa9429562:5,\ncc2ca488-3ba0-11eb-a578-005056ae7c63:1-4:7-9"
+	if gtidSet.String() != expect {
+		t.Errorf("expect %q, got %q", expect, gtidSet.String())
+	}
+	if NewGtidSet().String() != "" {
+		t.Errorf("expect empty string for empty gtid set")
+	}
+	if (&Interval{Start: 1, Stop: 5}).String() != "1-4" || (&Interval{Start: 3, Stop: 4}).String() != "3" {
+		t.Errorf("wrong interval string")
+	}
+}
+
+func TestParseGtidSet(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect string
+	}{
+		{"", ""},
+		{" \n ", ""},
+		{"3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5", "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"},
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562:7 : 1 - 3:4,\n  a8111585-297e-11eb-91d3-005056ae71c5:10\n",
+			"3e11fa47-71ca-11e1-9e33-c80aa9429562:1-4:7,\na8111585-297e-11eb-91d3-005056ae71c5:10"},
+		{"a8111585-297e-11eb-91d3-005056ae71c5:1-10,3e11fa47-71ca-11e1-9e33-c80aa9429562:2,a8111585-297e-11eb-91d3-005056ae71c5:5-20",
+			"3e11fa47-71ca-11e1-9e33-c80aa9429562:2,\na8111585-297e-11eb-91d3-005056ae71c5:1-20"},
+		{"a8111585-297e-11eb-91d3-005056ae71c5:Xyz:1-5:abc:3:4, a8111585-297e-11eb-91d3-005056ae71c5:1-2",
+			"a8111585-297e-11eb-91d3-005056ae71c5:1-2:abc:3-4:xyz:1-5"},
+	}
+	for _, c := range cases {
+		gtidSet, err := ParseGtidSet(c.input)
+		if err != nil {
+			t.Errorf("parse %q error: %v", c.input, err)
+			continue
+		}
+		if gtidSet.String() != c.expect {
+			t.Errorf("parse %q, expect %q, got %q", c.input, c.expect, gtidSet.String())
+		}
+		again, err := ParseGtidSet(gtidSet.String())
+		if err != nil || !again.Equal(gtidSet) {
+			t.Errorf("round trip of %q failed: %v", gtidSet.String(), err)
+		}
+	}
+
+	errorCases := []struct {
+		input string
+		pos   int
+	}{
+		{"3e11fa47-71ca-11e1-9e33", 0},
+		{"3e11fa47-71ca-11e1-9e33-c80aa942956z:1", 35},
+		{"3e11fa47_71ca-11e1-9e33-c80aa9429562:1", 8},
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562", 36},
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562:", 37},
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562:0-3", 37},
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562:5-3", 39},
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562:1-", 39},
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562:9223372036854775807", 37},
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562:1;", 38},
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562:1,", 39},
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562:abc:def:1", 37},
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562:1:abc", 39},
+		{"3e11fa47-71ca-11e1-9e33-c80aa9429562:" + strings.Repeat("a", 33) + ":1", 37},
+	}
+	for _, c := range errorCases {
+		_, err := ParseGtidSet(c.input)
+		parseErr, ok := err.(*GtidParseError)
+		if !ok {
+			t.Errorf("parse %q, expect *GtidParseError, got %v", c.input, err)
+			continue
+		}
+		if parseErr.Pos != c.pos {
+			t.Errorf("parse %q, expect error at %d, got %v", c.input, c.pos, err)
+		}
+	}
+}
+
+func TestParseGtid(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect string
+		ok     bool
+	}{
+		{"a8111585-297e-11eb-91d3-005056ae71c5:1-4:5:7-10", "a8111585-297e-11eb-91d3-005056ae71c5:1-5:7-10", true},
+		{"a8111585-297e-11eb-91d3-005056ae71c5:ABC:3", "a8111585-297e-11eb-91d3-005056ae71c5:abc:3", true},
+		{"a8111585-297e-11eb-91d3-005056ae71c5", "", false},
+		{"a8111585-297e-11eb-91d3-005056ae71c5:5-3", "", false},
+		{"a8111585-297e-11eb-91d3-005056ae71c5:1:abc:2", "", false},
+		{"a8111585-297e-11eb-91d3-005056ae71c5:1,b8111585-297e-11eb-91d3-005056ae71c5:1", "", false},
+		{"not a gtid", "", false},
+	}
+	for _, c := range cases {
+		gtid, err := Parse(c.input)
+		if !c.ok {
+			if _, isParseErr := err.(*GtidParseError); !isParseErr {
+				t.Errorf("parse %q, expect *GtidParseError, got %v", c.input, err)
+			}
+			continue
+		}
+		if err != nil || gtid.String() != c.expect {
+			t.Errorf("parse %q, expect %q, got %v %v", c.input, c.expect, gtid, err)
+		}
+	}
+
+	intervalCases := []struct {
+		input  string
+		expect *Interval
+	}{
+		{"1-64", &Interval{Start: 1, Stop: 65}},
+		{"7", &Interval{Start: 7, Stop: 8}},
+		{"", nil},
+		{"0", nil},
+		{"5-3", nil},
+		{"1-2-3", nil},
+		{"a", nil},
+	}
+	for _, c := range intervalCases {
+		interval, err := Parse_interval(c.input)
+		if c.expect == nil {
+			if err == nil {
+				t.Errorf("parse interval %q, expect error", c.input)
+			}
+			continue
+		}
+		if err != nil || *interval != *c.expect {
+			t.Errorf("parse interval %q, expect %v, got %v %v", c.input, c.expect, interval, err)
+		}
+	}
+}
+
+func TestGtidIntervals(t *testing.T) {
+	gtid := parseTestGtid(t, "a8111585-297e-11eb-91d3-005056ae71c5:1-5:10-20")
+	// 与已有区间重叠时合并
+	if err := gtid.AddInterval(&Interval{Start: 4, Stop: 12}); err != nil {
+		t.Fatalf("add interval error: %v", err)
+	}
+	if gtid.String() != "a8111585-297e-11eb-91d3-005056ae71c5:1-20" {
+		t.Errorf("unexpected gtid after add interval: %s", gtid.String())
+	}
+	if err := gtid.SubInterval(&Interval{Start: 3, Stop: 6}); err != nil {
+		t.Fatalf("sub interval error: %v", err)
+	}
+	if gtid.String() != "a8111585-297e-11eb-91d3-005056ae71c5:1-2:6-20" {
+		t.Errorf("unexpected gtid after sub interval: %s", gtid.String())
+	}
+	if gtid.AddInterval(&Interval{Start: 10, Stop: 5}) == nil || gtid.SubInterval(&Interval{Start: 10, Stop: 5}) == nil {
+		t.Errorf("expect error for reversed interval")
+	}
+	if gtid.SetIntervals([]*Interval{{Start: 30, Stop: 31}, {Start: 9, Stop: 1}}) == nil {
+		t.Errorf("expect error for reversed interval in SetIntervals")
+	}
+
+	if err := gtid.Add(parseTestGtid(t, "a8111585-297e-11eb-91d3-005056ae71c5:3-5")); err != nil {
+		t.Fatalf("add gtid error: %v", err)
+	}
+	if err := gtid.Sub(parseTestGtid(t, "a8111585-297e-11eb-91d3-005056ae71c5:10")); err != nil {
+		t.Fatalf("sub gtid error: %v", err)
+	}
+	if gtid.String() != "a8111585-297e-11eb-91d3-005056ae71c5:1-9:11-20:30" {
+		t.Errorf("unexpected gtid after add and sub: %s", gtid.String())
+	}
+	for _, other := range []string{"b8111585-297e-11eb-91d3-005056ae71c5:1", "a8111585-297e-11eb-91d3-005056ae71c5:abc:1"} {
+		if gtid.Add(parseTestGtid(t, other)) == nil || gtid.Sub(parseTestGtid(t, other)) == nil {
+			t.Errorf("expect error for add and sub of %s", other)
+		}
+	}
+}
+
+/*
+* COM_BINLOG_DUMP_GTID 的编码格式没有 tag, 带 tag 的 gtid 不能编码
+ */
+func TestEncodeTaggedGtid(t *testing.T) {
+	gtidSet, err := ParseGtidSet("a8111585-297e-11eb-91d3-005056ae71c5:1-5:abc:1-3")
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if !gtidSet.HasTags() {
+		t.Errorf("expect tags in %s", gtidSet.String())
+	}
+	if _, err := gtidSet.Encoded(); err == nil {
+		t.Errorf("expect error for encoding tagged gtid set")
+	}
+	if _, err := parseTestGtid(t, "a8111585-297e-11eb-91d3-005056ae71c5:abc:1").Encode(); err == nil {
+		t.Errorf("expect error for encoding tagged gtid")
+	}
+	invalid := NewGtid()
+	invalid.SetSid("a8111585")
+	if _, err := invalid.Encode(); err == nil {
+		t.Errorf("expect error for encoding invalid sid")
+	}
+}
@@ -0,0 +1,140 @@
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+* MariaDB 的 gtid, 格式为 domain_id-server_id-sequence_number, 如 0-1-100
+* 同一个 domain 中的 sequence_number 单调递增, 所以每个 domain 只需要记录最后一个 gtid
+ */
+type MariadbGtid struct {
+	domainId       uint32
+	serverId       uint32
+	sequenceNumber uint64
+}
+
+func NewMariadbGtid(domainId uint32, serverId uint32, sequenceNumber uint64) *MariadbGtid {
+	return &MariadbGtid{
+		domainId:       domainId,
+		serverId:       serverId,
+		sequenceNumber: sequenceNumber,
+	}
+}
+
+func (g *MariadbGtid) GetDomainId() uint32 {
+	return g.domainId
+}
+
+func (g *MariadbGtid) GetServerId() uint32 {
+	return g.serverId
+}
+
+func (g *MariadbGtid) GetSequenceNumber() uint64 {
+	return g.sequenceNumber
+}
+
+func (g *MariadbGtid) String() string {
+	return fmt.Sprintf("%d-%d-%d", g.domainId, g.serverId, g.sequenceNumber)
+}
+
+func ParseMariadbGtid(gtid string) (*MariadbGtid, error) {
+	parts := strings.Split(strings.TrimSpace(gtid), "-")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid mariadb gtid %q, expect domain_id-server_id-sequence_number", gtid)
+	}
+	domainId, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid domain_id in mariadb gtid %q, err: %s", gtid, err.Error())
+	}
+	serverId, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server_id in mariadb gtid %q, err: %s", gtid, err.Error())
+	}
+	sequenceNumber, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sequence_number in mariadb gtid %q, err: %s", gtid, err.Error())
+	}
+	return NewMariadbGtid(uint32(domainId), uint32(serverId), sequenceNumber), nil
+}
+
+/*
+* MariaDB 的 gtid 位置, 每个 domain 最后一个 gtid, 用于 @slave_connect_state
+ */
+type MariadbGtidSet struct {
+	gtids map[uint32]*MariadbGtid
+}
+
+func NewMariadbGtidSet() *MariadbGtidSet {
+	return &MariadbGtidSet{
+		gtids: make(map[uint32]*MariadbGtid),
+	}
+}
+
+/*
+* 解析逗号分隔的 gtid 列表, 如 0-1-100,1-2-5, 空字符串为空集合
+ */
+func ParseMariadbGtidSet(gtidSet string) (*MariadbGtidSet, error) {
+	set := NewMariadbGtidSet()
+	if strings.TrimSpace(gtidSet) == "" {
+		return set, nil
+	}
+	for _, gtidStr := range strings.Split(gtidSet, ",") {
+		gtid, err := ParseMariadbGtid(gtidStr)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := set.gtids[gtid.domainId]; ok {
+			return nil, fmt.Errorf("duplicate domain_id %d in mariadb gtid set %q", gtid.domainId, gtidSet)
+		}
+		set.gtids[gtid.domainId] = gtid
+	}
+	return set, nil
+}
+
+/*
+* 更新 gtid 所在 domain 的位置, 同一个 domain 只保留 sequence_number 最大的 gtid
+ */
+func (this *MariadbGtidSet) Update(gtid *MariadbGtid) {
+	existing, ok := this.gtids[gtid.domainId]
+	if ok && existing.sequenceNumber >= gtid.sequenceNumber {
+		return
+	}
+	this.gtids[gtid.domainId] = gtid
+}
+
+func (this *MariadbGtidSet) Contains(gtid *MariadbGtid) bool {
+	existing, ok := this.gtids[gtid.domainId]
+	return ok && existing.sequenceNumber >= gtid.sequenceNumber
+}
+
+func (this *MariadbGtidSet) GetGtids() []*MariadbGtid {
+	domainIds := make([]int, 0, len(this.gtids))
+	for domainId := range this.gtids {
+		domainIds = append(domainIds, int(domainId))
+	}
+	sort.Ints(domainIds)
+	gtids := make([]*MariadbGtid, 0, len(domainIds))
+	for _, domainId := range domainIds {
+		gtids = append(gtids, this.gtids[uint32(domainId)])
+	}
+	return gtids
+}
+
+/*
+* 按 domain_id 排序, 逗号分隔
+ */
+func (this *MariadbGtidSet) String() string {
+	var buf bytes.Buffer
+	for i, gtid := range this.GetGtids() {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(gtid.String())
+	}
+	return buf.String()
+}
@@ -0,0 +1,32 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func TestParseMariadbGtidSet(t *testing.T) {
+	set, err := ParseMariadbGtidSet("1-2-5, 0-1-100")
+	if err != nil {
+		t.Fatalf("parse mariadb gtid set error: %v", err)
+	}
+	if set.String() != "0-1-100,1-2-5" {
+		t.Errorf("unexpected mariadb gtid set %s", set.String())
+	}
+
+	set.Update(NewMariadbGtid(0, 3, 99))
+	set.Update(NewMariadbGtid(1, 3, 6))
+	set.Update(NewMariadbGtid(2, 1, 1))
+	if set.String() != "0-1-100,1-3-6,2-1-1" {
+		t.Errorf("unexpected mariadb gtid set after update %s", set.String())
+	}
+	if !set.Contains(NewMariadbGtid(0, 1, 50)) || set.Contains(NewMariadbGtid(3, 1, 1)) {
+		t.Errorf("unexpected contains result for %s", set.String())
+	}
+
+	for _, invalid := range []string{"0-1", "a-1-2", "0-1-2,0-2-3"} {
+		_, err = ParseMariadbGtidSet(invalid)
+		if err == nil {
+			t.Errorf("expect error for %q", invalid)
+		}
+	}
+}
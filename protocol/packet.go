@@ -4,6 +4,9 @@ import (
 	"encoding/binary"
 )
 
+// 单个packet的最大payload长度, 等于该长度时后面还有续包
+const MAX_PAYLOAD_LENGTH = 0xffffff
+
 // MySQL包
 //Type	Name	Description
 //int<3>	payload_length	Length of the payload. The number of bytes in the packet beyond the initial 4 bytes that make up the packet header.
@@ -1,7 +1,13 @@
 package protocol
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
 	"github.com/wonderivan/logger"
 	"math"
 )
@@ -210,13 +216,10 @@ func (p *Proto) Get_eof_str() string{
 }
 
 func (p *Proto) Get_lenenc_str() string{
-	value := ""
 	size := p.Get_lenenc_int()
-	for i := p.offset; i < p.offset + size; i++ {
-		value += string(p.packet[i])
-		p.offset += 1
-	}
-	return value
+	valSlice := p.packet[p.offset:p.offset + size]
+	p.offset += size
+	return string(valSlice)
 }
 
 
@@ -251,3 +254,55 @@ func Scramble_native_password(password, message []byte) []byte{
 	return scramble
 }
 
+/*
+* caching_sha2_password 的 scramble:
+* XOR(SHA256(password), SHA256(SHA256(SHA256(password)), message))
+*/
+func Scramble_caching_sha2_password(password, message []byte) []byte{
+	if len(password) == 0 {
+		return nil
+	}
+
+	hash := sha256.New()
+	hash.Write(password)
+	stage1 := hash.Sum(nil)
+
+	hash.Reset()
+	hash.Write(stage1)
+	stage2 := hash.Sum(nil)
+
+	hash.Reset()
+	hash.Write(stage2)
+	hash.Write(message[:SCRAMBLE_LENGTH])
+	scramble := hash.Sum(nil)
+
+	for i := range scramble {
+		scramble[i] ^= stage1[i]
+	}
+	return scramble
+}
+
+/*
+* 非加密连接下的完整认证: 用服务端返回的 RSA 公钥加密 (password + NUL) XOR message
+*/
+func Encrypt_password_rsa(password, message, pemKey []byte) ([]byte, error){
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, fmt.Errorf("invalid rsa public key from server")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("the public key from server is not a rsa key")
+	}
+
+	plain := make([]byte, len(password) + 1)
+	copy(plain, password)
+	for i := range plain {
+		plain[i] ^= message[i % SCRAMBLE_LENGTH]
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, rsaPub, plain, nil)
+}
@@ -1,13 +1,13 @@
 package protocol
 
 import (
-	"fmt"
+	"bytes"
 	"testing"
 )
 
 func TestBuild_fixed_int(t *testing.T) {
-	p := newProto(make([]byte, 0), 0)
-	packet := p.build_fixed_int(2, 0xFFFF)
-	fmt.Println(packet)
+	packet := Build_fixed_int(2, 0xFFFF)
+	if !bytes.Equal(packet, []byte{0xff, 0xff}) {
+		t.Errorf("expect [255 255], got %v", packet)
+	}
 }
-
@@ -35,22 +35,25 @@ func ReadConfigFile(filename string) map[string]interface{} {
 }
 
 /*
-* 读取文件最后一行
+* 读取文件最后一行 (忽略空行)
 */
 func ReadLastLine(file *os.File) (string, error){
 	buf := bufio.NewReader(file)
+	lastLine := ""
 	for {
 		line, err := buf.ReadString('\n')
 		line = strings.TrimSpace(line)
-		logger.Debug(line)
+		if line != "" {
+			lastLine = line
+		}
 		if err != nil {
 			if err == io.EOF {
-				return line, nil
+				logger.Debug(lastLine)
+				return lastLine, nil
 			} else {
 				logger.Error("read binlog index file error, err: ", err.Error())
 				return "", err
 			}
 		}
-		return line, nil
 	}
 }